@@ -51,6 +51,8 @@ var (
 					Name:  "publish-demo",
 					Usage: "publish demo video as a loop",
 				},
+				mediaFlag,
+				videoCodecFlag,
 				&cli.StringSliceFlag{
 					Name:      "publish",
 					TakesFile: true,
@@ -160,7 +162,15 @@ func _deprecatedJoinRoom(ctx context.Context, cmd *cli.Command) error {
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	if cmd.Bool("publish-demo") {
-		if err = publishDemo(room); err != nil {
+		media, err := loadMediaLibrary(cmd)
+		if err != nil {
+			return err
+		}
+		videoCodec, err := videoCodecFromFlag(cmd)
+		if err != nil {
+			return err
+		}
+		if err = publishDemo(room, media, videoCodec); err != nil {
 			return err
 		}
 	}
@@ -203,13 +213,51 @@ func handlePublish(room *lksdk.Room,
 	return publishFile(room, name, fps, onPublishComplete)
 }
 
-func publishDemo(room *lksdk.Room) error {
+// loadMediaLibrary returns the media library given with --media, or the built-in media
+func loadMediaLibrary(cmd *cli.Command) (*provider2.MediaLibrary, error) {
+	path := cmd.String("media")
+	if path == "" {
+		return provider2.EmbeddedMedia(), nil
+	}
+	return provider2.LoadMediaLibrary(path)
+}
+
+// videoCodecFromFlag returns the codec given with --video-codec, vp9 and av1 videos are only found in media libraries
+func videoCodecFromFlag(cmd *cli.Command) (string, error) {
+	codec := cmd.String("video-codec")
+	switch codec {
+	case "", "h264", "vp8":
+	case "vp9", "av1":
+		if !cmd.IsSet("media") {
+			return "", fmt.Errorf("--video-codec %s requires a --media library with %s videos", codec, codec)
+		}
+	default:
+		return "", fmt.Errorf("unsupported video codec %q, expected h264, vp8, vp9 or av1", codec)
+	}
+	return codec, nil
+}
+
+func publishDemo(room *lksdk.Room, media *provider2.MediaLibrary, codec string) error {
 	var tracks []*lksdk.LocalTrack
 
-	loopers, err := provider2.CreateVideoLoopers("high", "", true)
+	loopers, err := media.CreateVideoLoopers("high", codec, true)
 	if err != nil {
 		return err
 	}
+	// vp9 and av1 videos are not published with simulcast
+	if provider2.IsSingleTrackVideo(loopers[0]) {
+		track, err := provider2.NewTrack(loopers[0])
+		if err != nil {
+			return err
+		}
+		layer := loopers[0].ToLayer(livekit.VideoQuality_HIGH)
+		_, err = room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{
+			Name:        "demo",
+			VideoWidth:  int(layer.Width),
+			VideoHeight: int(layer.Height),
+		})
+		return err
+	}
 	for i, looper := range loopers {
 		layer := looper.ToLayer(livekit.VideoQuality(i))
 		track, err := lksdk.NewLocalTrack(looper.Codec(),
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -13,6 +15,254 @@ import (
 )
 
 var (
+	loadTestFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:  "room",
+			Usage: "`NAME` of the room (default to random name)",
+		},
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "`TIME` duration to run, 1m, 1h (by default will run until canceled)",
+			Value: 0,
+		},
+		&cli.IntFlag{
+			Name:    "video-publishers",
+			Aliases: []string{"publishers"},
+			Usage:   "`NUMBER` of participants that would publish video tracks",
+		},
+		&cli.IntFlag{
+			Name:  "audio-publishers",
+			Usage: "`NUMBER` of participants that would publish audio tracks",
+		},
+		&cli.IntFlag{
+			Name:  "subscribers",
+			Usage: "`NUMBER` of participants that would subscribe to tracks",
+		},
+		&cli.IntFlag{
+			Name:  "data-publishers",
+			Usage: "`NUMBER` of participants that would send data packets to subscribers",
+		},
+		&cli.FloatFlag{
+			Name:  "data-rate",
+			Usage: "`NUMBER` of data packets each data publisher sends every second",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "data-size",
+			Usage: "Size of data packets in `BYTES`",
+			Value: 100,
+		},
+		&cli.StringFlag{
+			Name:  "data-topics",
+			Usage: "Comma separated `TOPICS` data packets are sent on in turn, reliable unless suffixed with \":lossy\", e.g. chat,cursor:lossy",
+			Value: "loadtest",
+		},
+		&cli.StringFlag{
+			Name:  "identity-prefix",
+			Usage: "Identity `PREFIX` of tester participants (defaults to a random prefix)",
+		},
+		&cli.StringFlag{
+			Name:  "video-resolution",
+			Usage: "Resolution `QUALITY` of video to publish (\"high\", \"medium\", or \"low\")",
+			Value: "high",
+		},
+		videoCodecFlag,
+		&cli.StringFlag{
+			Name:  "publisher-profile",
+			Usage: "`PROFILE` of tracks published by video publishers, \"camera\", \"presenter\" (camera, microphone and screen share) or \"screen\"",
+			Value: "camera",
+		},
+		&cli.FloatFlag{
+			Name:  "num-per-second",
+			Usage: "`NUMBER` of testers to start every second",
+			Value: 5,
+		},
+		&cli.StringFlag{
+			Name:  "layout",
+			Usage: "`LAYOUT` to simulate, choose from \"speaker\", \"3x3\", \"4x4\", \"5x5\"",
+			Value: "speaker",
+		},
+		&cli.BoolFlag{
+			Name:  "no-simulcast",
+			Usage: "Disables simulcast publishing (simulcast is enabled by default)",
+		},
+		&cli.DurationFlag{
+			Name:  "layout-switch-interval",
+			Usage: "Switch subscribers between speaker, grid and hidden layouts every `TIME`, verifying received layers, e.g. 10s",
+		},
+		&cli.BoolFlag{
+			Name:  "simulate-speakers",
+			Usage: "Fire random speaker events to simulate speaker changes",
+		},
+		&cli.BoolFlag{
+			Name:  "synthetic-media",
+			Usage: "Publish timestamped synthetic media instead of video and audio files, to measure publish to receive latency",
+		},
+		&cli.BoolFlag{
+			Name:  "watermark",
+			Usage: "Stamp a frame index in published H.264 video, and report duplicated, skipped and reordered frames and freezes on subscribers",
+		},
+		&cli.BoolFlag{
+			Name:  "require-audio-fec",
+			Usage: "Fail unless published audio carries Opus in-band FEC. FEC is not added, publish a --media library encoded with FEC. Subscribers always report lost and recovered audio frames",
+		},
+		&cli.BoolFlag{
+			Name:  "audio-dtx",
+			Usage: "Suppress published audio packets without voice activity, like Opus DTX",
+		},
+		&cli.BoolFlag{
+			Name:  "dashboard",
+			Usage: "Show a live summary of connected testers, tracks, bitrate, loss and recent errors while the test is running",
+		},
+		&cli.DurationFlag{
+			Name:  "churn-session",
+			Usage: "Average `TIME` subscribers stay connected before leaving the room, e.g. 30s (no churn by default)",
+		},
+		&cli.StringFlag{
+			Name:  "churn-distribution",
+			Usage: "`DISTRIBUTION` of session lengths, \"fixed\", \"uniform\" or \"exponential\"",
+			Value: "fixed",
+		},
+		&cli.FloatFlag{
+			Name:  "churn-rejoin-probability",
+			Usage: "`PROBABILITY` (0-1) that a subscriber joins again after leaving",
+			Value: 1,
+		},
+		&cli.DurationFlag{
+			Name:  "churn-rejoin-delay",
+			Usage: "`TIME` subscribers stay away before joining again",
+			Value: 5 * time.Second,
+		},
+		&cli.FloatFlag{
+			Name:  "churn-rate",
+			Usage: "Maximum `NUMBER` of subscribers leaving or joining every second (defaults to --num-per-second)",
+		},
+		&cli.StringFlag{
+			Name:  "metrics-addr",
+			Usage: "Serve Prometheus metrics of the running testers on `ADDRESS`, e.g. :9090",
+		},
+		&cli.StringFlag{
+			Name:  "network-profile",
+			Usage: "Impair subscriber connections with `PROFILES` \"3g\", \"4g\", \"lossy\" or a YAML or JSON profile file, comma separated profiles are assigned round-robin",
+		},
+		&cli.IntFlag{
+			Name:  "rooms",
+			Usage: "Spread testers over `NUMBER` rooms named after --room, publisher counts apply to each room and the other participants subscribe",
+		},
+		&cli.StringFlag{
+			Name:  "room-size",
+			Usage: "`SIZES` of rooms with --rooms, a size, a range, or weighted sizes and ranges, e.g. \"4\", \"2-10\" or \"2-4:80,8-10:20\"",
+			Value: "2-10",
+		},
+		mediaFlag,
+		&cli.IntFlag{
+			Name:  "seed",
+			Usage: "Replay the random choices of a previous test, such as room names, room sizes and media, with its `SEED`",
+		},
+		&cli.StringFlag{
+			Name:      "scenario",
+			Usage:     "Run the phases described in a YAML or JSON scenario `FILE`, instead of a single test",
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:  "report-format",
+			Usage: "Write a machine-readable report in `FORMAT` \"json\", \"csv\" or \"junit\" when the test ends",
+		},
+		&cli.StringFlag{
+			Name:      "report-file",
+			Usage:     "`PATH` to write the report to, required with --report-format",
+			TakesFile: true,
+		},
+		&cli.FloatFlag{
+			Name:  "max-packet-loss",
+			Usage: "Fail the test when total packet loss exceeds `PERCENT`",
+		},
+		&cli.FloatFlag{
+			Name:  "min-track-ratio",
+			Usage: "Fail the test when the ratio of subscribed to expected tracks is below `RATIO` (0-1)",
+		},
+		&cli.IntFlag{
+			Name:  "max-errors",
+			Usage: "Fail the test when more than `NUMBER` testers encounter errors",
+		},
+		&cli.BoolFlag{
+			Name:  "find-capacity",
+			Usage: "Ramp subscribers or publishers in steps until the thresholds are violated, then search the largest count that meets them",
+		},
+		&cli.StringFlag{
+			Name:  "capacity-target",
+			Usage: "`TARGET` ramped by --find-capacity, \"subscribers\" or \"publishers\"",
+			Value: "subscribers",
+		},
+		&cli.IntFlag{
+			Name:  "capacity-start",
+			Usage: "`NUMBER` of participants in the first --find-capacity step (defaults to --capacity-step)",
+		},
+		&cli.IntFlag{
+			Name:  "capacity-step",
+			Usage: "`NUMBER` of participants added at each --find-capacity step",
+			Value: 10,
+		},
+		&cli.IntFlag{
+			Name:  "capacity-max",
+			Usage: "Largest `NUMBER` of participants tried by --find-capacity",
+			Value: 1000,
+		},
+		&cli.IntFlag{
+			Name:  "capacity-precision",
+			Usage: "Stop searching once the largest passing and smallest failing counts are `NUMBER` apart (defaults to a tenth of --capacity-step)",
+		},
+		&cli.BoolFlag{
+			Name:   "run-all",
+			Usage:  "Runs set list of load test cases",
+			Hidden: true,
+		},
+	}
+
+	// load test flags are inherited by these commands
+	distributedLoadTestCommands = []*cli.Command{
+		{
+			Name:        "coordinator",
+			Usage:       "Split a load test across workers and merge their results",
+			Description: "Waits for workers to register, assigns each a share of the publishers and subscribers, then starts them in sync and prints one merged report. Workers use their own LiveKit project credentials.",
+			Action:      loadTestCoordinator,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "bind",
+					Usage: "`ADDRESS` to listen on for workers",
+					Value: ":7890",
+				},
+				&cli.IntFlag{
+					Name:     "workers",
+					Usage:    "`NUMBER` of workers to wait for before starting the test",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:    "token",
+					Usage:   "Only accept workers sending `TOKEN`",
+					Sources: cli.EnvVars("LIVEKIT_LOADTEST_TOKEN"),
+				},
+			},
+		},
+		{
+			Name:   "worker",
+			Usage:  "Run a share of a load test assigned by a coordinator",
+			Action: loadTestWorker,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "coordinator",
+					Usage:    "`URL` of the coordinator, e.g. http://10.0.0.1:7890",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:    "token",
+					Usage:   "`TOKEN` expected by the coordinator",
+					Sources: cli.EnvVars("LIVEKIT_LOADTEST_TOKEN"),
+				},
+			},
+		},
+	}
+
 	PerfCommands = []*cli.Command{
 		{
 			Name:        "perf",
@@ -20,69 +270,11 @@ var (
 			Description: "Commands for running various performance tests",
 			Commands: []*cli.Command{
 				{
-					Name:   "load-test",
-					Usage:  "Run load tests against LiveKit with simulated publishers & subscribers",
-					Action: loadTest,
-					Flags: []cli.Flag{
-						&cli.StringFlag{
-							Name:  "room",
-							Usage: "`NAME` of the room (default to random name)",
-						},
-						&cli.DurationFlag{
-							Name:  "duration",
-							Usage: "`TIME` duration to run, 1m, 1h (by default will run until canceled)",
-							Value: 0,
-						},
-						&cli.IntFlag{
-							Name:    "video-publishers",
-							Aliases: []string{"publishers"},
-							Usage:   "`NUMBER` of participants that would publish video tracks",
-						},
-						&cli.IntFlag{
-							Name:  "audio-publishers",
-							Usage: "`NUMBER` of participants that would publish audio tracks",
-						},
-						&cli.IntFlag{
-							Name:  "subscribers",
-							Usage: "`NUMBER` of participants that would subscribe to tracks",
-						},
-						&cli.StringFlag{
-							Name:  "identity-prefix",
-							Usage: "Identity `PREFIX` of tester participants (defaults to a random prefix)",
-						},
-						&cli.StringFlag{
-							Name:  "video-resolution",
-							Usage: "Resolution `QUALITY` of video to publish (\"high\", \"medium\", or \"low\")",
-							Value: "high",
-						},
-						&cli.StringFlag{
-							Name:  "video-codec",
-							Usage: "`CODEC` \"h264\" or \"vp8\", both will be used when unset",
-						},
-						&cli.FloatFlag{
-							Name:  "num-per-second",
-							Usage: "`NUMBER` of testers to start every second",
-							Value: 5,
-						},
-						&cli.StringFlag{
-							Name:  "layout",
-							Usage: "`LAYOUT` to simulate, choose from \"speaker\", \"3x3\", \"4x4\", \"5x5\"",
-							Value: "speaker",
-						},
-						&cli.BoolFlag{
-							Name:  "no-simulcast",
-							Usage: "Disables simulcast publishing (simulcast is enabled by default)",
-						},
-						&cli.BoolFlag{
-							Name:  "simulate-speakers",
-							Usage: "Fire random speaker events to simulate speaker changes",
-						},
-						&cli.BoolFlag{
-							Name:   "run-all",
-							Usage:  "Runs set list of load test cases",
-							Hidden: true,
-						},
-					},
+					Name:     "load-test",
+					Usage:    "Run load tests against LiveKit with simulated publishers & subscribers",
+					Action:   loadTest,
+					Flags:    loadTestFlags,
+					Commands: distributedLoadTestCommands,
 				},
 				{
 					Name:   "agent-load-test",
@@ -102,11 +294,39 @@ var (
 							Usage: "delay between when the echo track speaks and when the agent starts speaking (e.g. 5s, 1m)",
 							Value: 5 * time.Second,
 						},
+						&cli.FloatFlag{
+							Name:  "room-rate",
+							Usage: "`NUMBER` of rooms to open every second, 0 for no limit",
+							Value: 1,
+						},
+						&cli.IntFlag{
+							Name:  "max-pending-dispatches",
+							Usage: "Maximum `NUMBER` of rooms waiting for the agent to join before more rooms are opened, 0 for no limit",
+							Value: 5,
+						},
+						&cli.DurationFlag{
+							Name:  "join-timeout",
+							Usage: "`TIME` given to the agent to join each room before the room is reported as timed out, 0 to wait without a timeout",
+							Value: 30 * time.Second,
+						},
+						&cli.StringFlag{
+							Name:  "utterances",
+							Usage: "`DIR` of Ogg/Opus user utterances played in turns instead of echoing the agent, or \"builtin\" for the bundled voice samples",
+						},
+						&cli.DurationFlag{
+							Name:  "turn-timeout",
+							Usage: "Maximum `TIME` the agent is given to respond to an utterance",
+							Value: 20 * time.Second,
+						},
 						&cli.DurationFlag{
 							Name:  "duration",
 							Usage: "`TIME` duration to run, 1m, 1h (by default will run until canceled)",
 							Value: 0,
 						},
+						&cli.StringFlag{
+							Name:  "metrics-addr",
+							Usage: "Serve Prometheus metrics of the test rooms on `ADDRESS`, e.g. :9090",
+						},
 					},
 				},
 			},
@@ -116,66 +336,7 @@ var (
 			Usage:  "Run load tests against LiveKit with simulated publishers & subscribers",
 			Action: loadTest,
 			Hidden: true,
-			Flags: []cli.Flag{
-				&cli.StringFlag{
-					Name:  "room",
-					Usage: "`NAME` of the room (default to random name)",
-				},
-				&cli.DurationFlag{
-					Name:  "duration",
-					Usage: "`TIME` duration to run, 1m, 1h (by default will run until canceled)",
-					Value: 0,
-				},
-				&cli.IntFlag{
-					Name:    "video-publishers",
-					Aliases: []string{"publishers"},
-					Usage:   "`NUMBER` of participants that would publish video tracks",
-				},
-				&cli.IntFlag{
-					Name:  "audio-publishers",
-					Usage: "`NUMBER` of participants that would publish audio tracks",
-				},
-				&cli.IntFlag{
-					Name:  "subscribers",
-					Usage: "`NUMBER` of participants that would subscribe to tracks",
-				},
-				&cli.StringFlag{
-					Name:  "identity-prefix",
-					Usage: "Identity `PREFIX` of tester participants (defaults to a random prefix)",
-				},
-				&cli.StringFlag{
-					Name:  "video-resolution",
-					Usage: "Resolution `QUALITY` of video to publish (\"high\", \"medium\", or \"low\")",
-					Value: "high",
-				},
-				&cli.StringFlag{
-					Name:  "video-codec",
-					Usage: "`CODEC` \"h264\" or \"vp8\", both will be used when unset",
-				},
-				&cli.FloatFlag{
-					Name:  "num-per-second",
-					Usage: "`NUMBER` of testers to start every second",
-					Value: 5,
-				},
-				&cli.StringFlag{
-					Name:  "layout",
-					Usage: "`LAYOUT` to simulate, choose from \"speaker\", \"3x3\", \"4x4\", \"5x5\"",
-					Value: "speaker",
-				},
-				&cli.BoolFlag{
-					Name:  "no-simulcast",
-					Usage: "Disables simulcast publishing (simulcast is enabled by default)",
-				},
-				&cli.BoolFlag{
-					Name:  "simulate-speakers",
-					Usage: "Fire random speaker events to simulate speaker changes",
-				},
-				&cli.BoolFlag{
-					Name:   "run-all",
-					Usage:  "Runs set list of load test cases",
-					Hidden: true,
-				},
-			},
+			Flags:  loadTestFlags,
 		},
 	}
 )
@@ -191,21 +352,53 @@ func loadTest(ctx context.Context, cmd *cli.Command) error {
 	}
 	_ = raiseULimit()
 
-	params := loadtester.Params{
-		VideoResolution:  cmd.String("video-resolution"),
-		VideoCodec:       cmd.String("video-codec"),
-		Duration:         cmd.Duration("duration"),
-		NumPerSecond:     cmd.Float("num-per-second"),
-		Simulcast:        !cmd.Bool("no-simulcast"),
-		SimulateSpeakers: cmd.Bool("simulate-speakers"),
-		TesterParams: loadtester.TesterParams{
-			URL:            pc.URL,
-			APIKey:         pc.APIKey,
-			APISecret:      pc.APISecret,
-			Room:           cmd.String("room"),
-			IdentityPrefix: cmd.String("identity-prefix"),
-			Layout:         loadtester.LayoutFromString(cmd.String("layout")),
-		},
+	params, err := loadTestParams(cmd)
+	if err != nil {
+		return err
+	}
+	params.URL = pc.URL
+	params.APIKey = pc.APIKey
+	params.APISecret = pc.APISecret
+
+	if scenarioFile := cmd.String("scenario"); scenarioFile != "" {
+		if cmd.Bool("run-all") {
+			return errors.New("--scenario cannot be combined with --run-all")
+		}
+		if cmd.Bool("find-capacity") {
+			return errors.New("--scenario cannot be combined with --find-capacity")
+		}
+		scenario, err := loadtester.LoadScenario(scenarioFile)
+		if err != nil {
+			return err
+		}
+		test := loadtester.NewLoadTest(params)
+		return test.RunScenario(ctx, scenario)
+	}
+
+	if cmd.Bool("find-capacity") {
+		if cmd.Bool("run-all") {
+			return errors.New("--find-capacity cannot be combined with --run-all")
+		}
+		if params.Rooms > 1 {
+			return errors.New("--find-capacity cannot be combined with --rooms")
+		}
+		target, err := loadtester.CapacityTargetFromString(cmd.String("capacity-target"))
+		if err != nil {
+			return err
+		}
+		params.VideoPublishers = int(cmd.Int("video-publishers"))
+		params.AudioPublishers = int(cmd.Int("audio-publishers"))
+		params.Subscribers = int(cmd.Int("subscribers"))
+		params.DataPublishers = int(cmd.Int("data-publishers"))
+
+		test := loadtester.NewLoadTest(params)
+		return test.FindCapacity(ctx, loadtester.CapacityParams{
+			Target:    target,
+			Start:     int(cmd.Int("capacity-start")),
+			Step:      int(cmd.Int("capacity-step")),
+			Max:       int(cmd.Int("capacity-max")),
+			Precision: int(cmd.Int("capacity-precision")),
+		})
 	}
 
 	if cmd.Bool("run-all") {
@@ -220,11 +413,188 @@ func loadTest(ctx context.Context, cmd *cli.Command) error {
 	params.VideoPublishers = int(cmd.Int("video-publishers"))
 	params.AudioPublishers = int(cmd.Int("audio-publishers"))
 	params.Subscribers = int(cmd.Int("subscribers"))
+	params.DataPublishers = int(cmd.Int("data-publishers"))
 
 	test := loadtester.NewLoadTest(params)
 	return test.Run(ctx)
 }
 
+// loadTestParams returns the load test parameters given on the command line, without server credentials
+func loadTestParams(cmd *cli.Command) (loadtester.Params, error) {
+	reportFormat, err := loadtester.ReportFormatFromString(cmd.String("report-format"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	if reportFormat == loadtester.ReportFormatNone && cmd.String("report-file") != "" {
+		return loadtester.Params{}, errors.New("--report-file requires --report-format")
+	}
+	// tables and progress are printed to stdout, the report would be mixed with them
+	if reportFormat != loadtester.ReportFormatNone && cmd.String("report-file") == "" {
+		return loadtester.Params{}, errors.New("--report-format requires --report-file")
+	}
+
+	var thresholds []loadtester.Threshold
+	if cmd.IsSet("max-packet-loss") {
+		thresholds = append(thresholds, loadtester.MaxPacketLoss(cmd.Float("max-packet-loss")))
+	}
+	if cmd.IsSet("min-track-ratio") {
+		ratio := cmd.Float("min-track-ratio")
+		if ratio < 0 || ratio > 1 {
+			return loadtester.Params{}, errors.New("--min-track-ratio must be between 0 and 1")
+		}
+		thresholds = append(thresholds, loadtester.MinTrackRatio(ratio))
+	}
+	if cmd.IsSet("max-errors") {
+		thresholds = append(thresholds, loadtester.MaxErrors(int64(cmd.Int("max-errors"))))
+	}
+
+	sessionDistribution, err := loadtester.SessionDistributionFromString(cmd.String("churn-distribution"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	rejoinProbability := cmd.Float("churn-rejoin-probability")
+	if rejoinProbability < 0 || rejoinProbability > 1 {
+		return loadtester.Params{}, errors.New("--churn-rejoin-probability must be between 0 and 1")
+	}
+
+	networkProfiles, err := loadtester.NetworkProfilesFromString(cmd.String("network-profile"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	dataTopics, err := loadtester.DataTopicsFromString(cmd.String("data-topics"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	publisherProfile, err := loadtester.PublisherProfileFromString(cmd.String("publisher-profile"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	roomSizes, err := loadtester.RoomSizesFromString(cmd.String("room-size"))
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	if cmd.IsSet("media") && cmd.Bool("synthetic-media") {
+		return loadtester.Params{}, errors.New("--media cannot be used with --synthetic-media")
+	}
+	media, err := loadMediaLibrary(cmd)
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+
+	videoCodec, err := videoCodecFromFlag(cmd)
+	if err != nil {
+		return loadtester.Params{}, err
+	}
+	if (cmd.Bool("require-audio-fec") || cmd.Bool("audio-dtx")) && cmd.Bool("synthetic-media") {
+		return loadtester.Params{}, errors.New("--require-audio-fec and --audio-dtx cannot be used with --synthetic-media")
+	}
+	if cmd.Bool("watermark") {
+		if cmd.Bool("synthetic-media") {
+			return loadtester.Params{}, errors.New("--watermark cannot be used with --synthetic-media")
+		}
+		// watermarks are carried in H.264 SEI
+		if videoCodec == "" {
+			videoCodec = "h264"
+		} else if videoCodec != "h264" {
+			return loadtester.Params{}, fmt.Errorf("--watermark requires h264 video, not %s", videoCodec)
+		}
+	}
+
+	return loadtester.Params{
+		VideoResolution:  cmd.String("video-resolution"),
+		VideoCodec:       videoCodec,
+		PublisherProfile: publisherProfile,
+		Duration:         cmd.Duration("duration"),
+		NumPerSecond:     cmd.Float("num-per-second"),
+		Simulcast:        !cmd.Bool("no-simulcast"),
+		SimulateSpeakers: cmd.Bool("simulate-speakers"),
+		ReportFormat:     reportFormat,
+		ReportFile:       cmd.String("report-file"),
+		Thresholds:       thresholds,
+		Dashboard:        cmd.Bool("dashboard"),
+		Churn: loadtester.ChurnParams{
+			SessionLength:       cmd.Duration("churn-session"),
+			SessionDistribution: sessionDistribution,
+			RejoinProbability:   rejoinProbability,
+			RejoinDelay:         cmd.Duration("churn-rejoin-delay"),
+			Rate:                cmd.Float("churn-rate"),
+		},
+		Data: loadtester.DataParams{
+			Rate:   cmd.Float("data-rate"),
+			Size:   int(cmd.Int("data-size")),
+			Topics: dataTopics,
+		},
+		NetworkProfiles: networkProfiles,
+		MetricsAddr:     cmd.String("metrics-addr"),
+		Rooms:           int(cmd.Int("rooms")),
+		RoomSizes:       roomSizes,
+		Seed:            int64(cmd.Int("seed")),
+		TesterParams: loadtester.TesterParams{
+			Room:            cmd.String("room"),
+			IdentityPrefix:  cmd.String("identity-prefix"),
+			Layout:          loadtester.LayoutFromString(cmd.String("layout")),
+			SyntheticMedia:  cmd.Bool("synthetic-media"),
+			Watermark:       cmd.Bool("watermark"),
+			RequireAudioFEC: cmd.Bool("require-audio-fec"),
+			AudioDTX:        cmd.Bool("audio-dtx"),
+			Media:           media,
+
+			LayoutSwitchInterval: cmd.Duration("layout-switch-interval"),
+		},
+	}, nil
+}
+
+func loadTestCoordinator(ctx context.Context, cmd *cli.Command) error {
+	params, err := loadTestParams(cmd)
+	if err != nil {
+		return err
+	}
+	params.VideoPublishers = int(cmd.Int("video-publishers"))
+	params.AudioPublishers = int(cmd.Int("audio-publishers"))
+	params.Subscribers = int(cmd.Int("subscribers"))
+	params.DataPublishers = int(cmd.Int("data-publishers"))
+	if params.Rooms > 1 {
+		return errors.New("--rooms is not supported by distributed load tests")
+	}
+
+	coordinator := loadtester.NewCoordinator(params, loadtester.CoordinatorParams{
+		Bind:    cmd.String("bind"),
+		Workers: int(cmd.Int("workers")),
+		Token:   cmd.String("token"),
+	})
+	return coordinator.Run(ctx)
+}
+
+func loadTestWorker(ctx context.Context, cmd *cli.Command) error {
+	pc, err := loadProjectDetails(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !cmd.Bool("verbose") {
+		lksdk.SetLogger(logger.LogRLogger(logr.Discard()))
+	}
+	_ = raiseULimit()
+
+	// media files are read locally by each worker
+	media, err := loadMediaLibrary(cmd)
+	if err != nil {
+		return err
+	}
+	worker := loadtester.NewWorker(loadtester.WorkerParams{
+		CoordinatorURL: cmd.String("coordinator"),
+		Token:          cmd.String("token"),
+		MetricsAddr:    cmd.String("metrics-addr"),
+		TesterParams: loadtester.TesterParams{
+			URL:       pc.URL,
+			APIKey:    pc.APIKey,
+			APISecret: pc.APISecret,
+			Media:     media,
+		},
+	})
+	return worker.Run(ctx)
+}
+
 func agentLoadTest(ctx context.Context, cmd *cli.Command) error {
 	pc, err := loadProjectDetails(cmd)
 	if err != nil {
@@ -244,6 +614,17 @@ func agentLoadTest(ctx context.Context, cmd *cli.Command) error {
 		AgentName:       cmd.String("agent-name"),
 		EchoSpeechDelay: cmd.Duration("echo-speech-delay"),
 		Duration:        cmd.Duration("duration"),
+		MetricsAddr:     cmd.String("metrics-addr"),
+		TurnTimeout:     cmd.Duration("turn-timeout"),
+		RoomRate:        cmd.Float("room-rate"),
+		JoinTimeout:     cmd.Duration("join-timeout"),
+
+		MaxPendingDispatches: int(cmd.Int("max-pending-dispatches")),
+	}
+	if dir := cmd.String("utterances"); dir != "" {
+		if params.Utterances, err = loadtester.LoadUtterances(dir); err != nil {
+			return err
+		}
 	}
 
 	test := loadtester.NewAgentLoadTest(params)
@@ -145,6 +145,8 @@ var (
 							Name:  "publish-demo",
 							Usage: "Publish demo video as a loop",
 						},
+						mediaFlag,
+						videoCodecFlag,
 						&cli.StringSliceFlag{
 							Name:      "publish",
 							TakesFile: true,
@@ -918,7 +920,15 @@ func joinRoom(ctx context.Context, cmd *cli.Command) error {
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
 	if cmd.Bool("publish-demo") {
-		if err = publishDemo(room); err != nil {
+		media, err := loadMediaLibrary(cmd)
+		if err != nil {
+			return err
+		}
+		videoCodec, err := videoCodecFromFlag(cmd)
+		if err != nil {
+			return err
+		}
+		if err = publishDemo(room, media, videoCodec); err != nil {
 			return err
 		}
 	}
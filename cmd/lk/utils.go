@@ -47,6 +47,15 @@ var (
 		Aliases: []string{"j"},
 		Usage:   "Output as JSON",
 	}
+	mediaFlag = &cli.StringFlag{
+		Name:      "media",
+		Usage:     "Publish the videos and audio of a media library `DIR` with a manifest.yaml, or of a manifest file, instead of the built-in media",
+		TakesFile: true,
+	}
+	videoCodecFlag = &cli.StringFlag{
+		Name:  "video-codec",
+		Usage: "`CODEC` of published video, \"h264\", \"vp8\", \"vp9\" or \"av1\". vp9 and av1 are only available with --media and are published as a single layer, without SVC. Any codec is used when unset",
+	}
 	printCurl   bool
 	globalFlags = []cli.Flag{
 		&cli.StringFlag{
@@ -18,6 +18,8 @@ import (
 	"context"
 	"log"
 	"time"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
 )
 
 type AgentLoadTestParams struct {
@@ -28,6 +30,19 @@ type AgentLoadTestParams struct {
 	URL             string
 	APIKey          string
 	APISecret       string
+	// serve Prometheus metrics of the test rooms on this address when set, e.g. :9090
+	MetricsAddr string
+	// user utterances played in turns into each room when set, instead of echoing the agent
+	Utterances []*provider2.Utterance
+	// maximum time the agent is given to respond to an utterance
+	TurnTimeout time.Duration
+	// rooms opened per second, unlimited when 0
+	RoomRate float64
+	// maximum number of rooms waiting for the agent to join, unlimited when 0
+	MaxPendingDispatches int
+	// time given to the agent to join each room, before the room is reported as timed out.
+	// Rooms wait for the agent without a timeout when 0
+	JoinTimeout time.Duration
 }
 
 type AgentLoadTest struct {
@@ -43,7 +58,20 @@ func NewAgentLoadTest(params AgentLoadTestParams) *AgentLoadTest {
 
 func (t *AgentLoadTest) Run(ctx context.Context, params AgentLoadTestParams) error {
 	log.Printf("Starting agent load test with %d rooms", params.Rooms)
+	if len(params.Utterances) > 0 {
+		if params.TurnTimeout == 0 {
+			params.TurnTimeout = defaultTurnTimeout
+		}
+		log.Printf("Playing %d scripted utterances in turns", len(params.Utterances))
+	}
 	agentLoadTester := NewAgentLoadTester(params)
+	if params.MetricsAddr != "" {
+		stopMetrics, err := serveMetrics(params.MetricsAddr, agentLoadTester.writeMetrics)
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
 
 	duration := params.Duration
 	if duration == 0 {
@@ -56,6 +84,8 @@ func (t *AgentLoadTest) Run(ctx context.Context, params AgentLoadTestParams) err
 	err := agentLoadTester.Start(timeoutCtx)
 	if err != nil {
 		log.Printf("Failed to start agent load tester: %v", err)
+		// report the rooms that failed
+		agentLoadTester.Stop()
 		return err
 	}
 
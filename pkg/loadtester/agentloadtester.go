@@ -34,15 +34,23 @@ import (
 	"github.com/pion/webrtc/v4/pkg/media"
 	"go.uber.org/atomic"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 type LoadTestRoomStats struct {
-	agentDispatchedAt    time.Time
-	agentJoinedAt        time.Time
-	agentJoined          bool
-	agentTrackSubscribed bool
+	agentDispatchedAt time.Time
+	// set by SDK callbacks, read by the metrics endpoint while the test runs
+	agentJoinedAt        atomic.Time
+	agentJoined          atomic.Bool
+	agentTrackSubscribed atomic.Bool
 	echoTrackPublished   bool
 	meetLink             string
+	// the agent did not join before the join timeout
+	agentJoinTimedOut atomic.Bool
+	// the room could not be set up
+	err atomic.Error
+	// turns between the echo participant and the agent
+	turns agentTurnStats
 }
 
 type LoadTestRoom struct {
@@ -52,6 +60,9 @@ type LoadTestRoom struct {
 	echoTrack        *lksdk.LocalTrack
 	running          atomic.Bool
 	stats            LoadTestRoomStats
+	// closed when the agent joins
+	agentJoinedCh   chan struct{}
+	agentJoinedOnce sync.Once
 }
 
 type AgentLoadTester struct {
@@ -69,63 +80,76 @@ func NewAgentLoadTester(params AgentLoadTestParams) *AgentLoadTester {
 
 func NewLoadTestRoom(params AgentLoadTestParams) *LoadTestRoom {
 	return &LoadTestRoom{
-		params: params,
-		stats:  LoadTestRoomStats{},
+		params:        params,
+		stats:         LoadTestRoomStats{},
+		agentJoinedCh: make(chan struct{}),
 	}
 }
 
 func (t *AgentLoadTester) Start(ctx context.Context) error {
 	group, groupCtx := errgroup.WithContext(ctx)
+	// throttle room creation, and the number of rooms waiting for the agent to join
+	roomRate := rate.Inf
+	if t.params.RoomRate > 0 {
+		roomRate = rate.Limit(t.params.RoomRate)
+	}
+	limiter := rate.NewLimiter(roomRate, 1)
+	var pending chan struct{}
+	if t.params.MaxPendingDispatches > 0 {
+		pending = make(chan struct{}, t.params.MaxPendingDispatches)
+	}
+	var failed atomic.Int32
 
+rooms:
 	for i := 0; i < t.params.Rooms; i++ {
-		roomName := utils.NewGuid(fmt.Sprintf("room-%d-", i))
-
-		loadTestRoom := &LoadTestRoom{
-			params: t.params,
+		if err := limiter.Wait(groupCtx); err != nil {
+			break
+		}
+		if pending != nil {
+			select {
+			case pending <- struct{}{}:
+			case <-groupCtx.Done():
+				break rooms
+			}
+		}
+		release := func() {
+			if pending != nil {
+				<-pending
+			}
 		}
 
+		roomName := utils.NewGuid(fmt.Sprintf("room-%d-", i))
+		loadTestRoom := NewLoadTestRoom(t.params)
+
 		t.lock.Lock()
 		t.testRooms[roomName] = loadTestRoom
 		t.lock.Unlock()
 
 		group.Go(func() error {
-			if err := loadTestRoom.start(roomName); err != nil {
-				log.Printf("Failed to connect to room %s: %v", roomName, err)
-				return err
-			}
-
-			_, err := loadTestRoom.publishEchoTrack()
-			if err != nil {
-				log.Printf("Failed to publish echo track to room %s: %v", roomName, err)
+			if err := loadTestRoom.setup(roomName); err != nil {
+				// a failed room does not stop the others, unless every room failed
+				loadTestRoom.stats.err.Store(err)
 				loadTestRoom.stop()
-				return err
-			}
-			loadTestRoom.stats.echoTrackPublished = true
-
-			if t.params.AgentName != "" {
-				err = loadTestRoom.dispatchAgent()
-				if err != nil {
-					log.Printf("Failed to dispatch agent to room %s: %v", roomName, err)
-					loadTestRoom.stop()
-					return err
+				release()
+				if int(failed.Inc()) == t.params.Rooms {
+					return fmt.Errorf("could not set up any of the %d rooms: %w", t.params.Rooms, err)
 				}
+				return nil
+			}
+			if !loadTestRoom.waitForAgent(groupCtx, t.params.JoinTimeout) && groupCtx.Err() == nil {
+				log.Printf("Agent did not join room %s within %s", roomName, t.params.JoinTimeout.String())
 			}
+			release()
 
 			<-groupCtx.Done()
 			log.Printf("Context cancelled for room %s, cleaning up", roomName)
 			loadTestRoom.stop()
 			return nil
 		})
-		for !loadTestRoom.stats.agentJoined {
-			select {
-			case <-groupCtx.Done():
-				return nil
-			default:
-				time.Sleep(100 * time.Millisecond)
-			}
-		}
 	}
-	log.Printf("Agent load tester started successfully, waiting for duration: %s", t.params.Duration.String())
+	if groupCtx.Err() == nil {
+		log.Printf("Agent load tester started successfully, waiting for duration: %s", t.params.Duration.String())
+	}
 
 	if err := group.Wait(); err != nil {
 		return err
@@ -134,6 +158,51 @@ func (t *AgentLoadTester) Start(ctx context.Context) error {
 	return nil
 }
 
+// setup connects to the room, publishes the echo track and dispatches the agent
+func (r *LoadTestRoom) setup(roomName string) error {
+	if err := r.start(roomName); err != nil {
+		log.Printf("Failed to connect to room %s: %v", roomName, err)
+		return err
+	}
+
+	if _, err := r.publishEchoTrack(); err != nil {
+		log.Printf("Failed to publish echo track to room %s: %v", roomName, err)
+		return err
+	}
+	r.stats.echoTrackPublished = true
+
+	if r.params.AgentName != "" {
+		if err := r.dispatchAgent(); err != nil {
+			log.Printf("Failed to dispatch agent to room %s: %v", roomName, err)
+			return err
+		}
+	}
+	if len(r.params.Utterances) > 0 {
+		go r.runScript()
+	}
+	return nil
+}
+
+// waitForAgent returns true once the agent joined the room. The room is marked as timed out
+// when the agent did not join within timeout
+func (r *LoadTestRoom) waitForAgent(ctx context.Context, timeout time.Duration) bool {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-r.agentJoinedCh:
+		return true
+	case <-expired:
+		r.stats.agentJoinTimedOut.Store(true)
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (t *AgentLoadTester) Stop() {
 	t.printStats()
 	t.lock.Lock()
@@ -161,8 +230,9 @@ func (r *LoadTestRoom) start(roomName string) error {
 		},
 		OnParticipantConnected: func(rp *lksdk.RemoteParticipant) {
 			if rp.Kind() == lksdk.ParticipantAgent {
-				r.stats.agentJoined = true
-				r.stats.agentJoinedAt = time.Now()
+				r.stats.agentJoinedAt.Store(time.Now())
+				r.stats.agentJoined.Store(true)
+				r.agentJoinedOnce.Do(func() { close(r.agentJoinedCh) })
 			}
 		},
 		OnParticipantDisconnected: r.onParticipantDisconnected,
@@ -205,8 +275,12 @@ func (r *LoadTestRoom) publishEchoTrack() (string, error) {
 	}
 	r.echoTrack = echoTrack
 
+	name := "echo-track"
+	if len(r.params.Utterances) > 0 {
+		name = "user-track"
+	}
 	p, err := r.room.LocalParticipant.PublishTrack(echoTrack, &lksdk.TrackPublicationOptions{
-		Name: "echo-track",
+		Name: name,
 	})
 	if err != nil {
 		return "", err
@@ -221,11 +295,13 @@ func (r *LoadTestRoom) dispatchAgent() error {
 		AgentName: r.params.AgentName,
 	}
 
+	// the agent may join before the request returns
+	dispatchedAt := time.Now()
 	_, err := dispatchClient.CreateDispatch(context.Background(), req)
 	if err != nil {
 		return err
 	}
-	r.stats.agentDispatchedAt = time.Now()
+	r.stats.agentDispatchedAt = dispatchedAt
 	// log.Printf("Successfully dispatched agent %s to room %s", r.params.AgentName, r.room.Name())
 	return nil
 }
@@ -234,14 +310,11 @@ func (r *LoadTestRoom) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.R
 	if r.echoTrack != nil && r.firstParticipant == nil && track.Kind() == webrtc.RTPCodecTypeAudio {
 		r.firstParticipant = rp
 		if rp.Kind() == lksdk.ParticipantAgent {
-			r.stats.agentTrackSubscribed = true
+			r.stats.agentTrackSubscribed.Store(true)
 		}
 
-		type timestampedSample struct {
-			sample   media.Sample
-			received time.Time
-		}
-		sampleChan := make(chan timestampedSample, 1000)
+		scripted := len(r.params.Utterances) > 0
+		sampleChan := make(chan timedSample, 1000)
 
 		go func() {
 			for r.running.Load() {
@@ -250,35 +323,69 @@ func (r *LoadTestRoom) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.R
 					// log.Printf("Error reading RTP packet: %v", err)
 					continue
 				}
-				sample := timestampedSample{
-					sample: media.Sample{
-						Data:     pkt.Payload,
-						Duration: 20 * time.Millisecond,
-					},
-					received: time.Now(),
+				received := time.Now()
+				r.stats.turns.onAgentFrame(received, isSpeechFrame(pkt.Payload))
+				if scripted {
+					// utterances are played instead of the echo
+					continue
+				}
+				sampleChan <- timedSample{
+					data:     pkt.Payload,
+					received: received,
 				}
-				sampleChan <- sample
 			}
 			close(sampleChan)
 		}()
 
+		if scripted {
+			return
+		}
 		go func() {
+			// samples waiting to be echoed
+			var pending []timedSample
 			for r.running.Load() {
-				ts, ok := <-sampleChan
-				if !ok {
-					return
+				if len(pending) == 0 {
+					ts, ok := <-sampleChan
+					if !ok {
+						return
+					}
+					pending = append(pending, ts)
 				}
 				// delay the sample by the echo speech delay
-				delay := time.Until(ts.received.Add(r.params.EchoSpeechDelay))
+				delay := time.Until(pending[0].received.Add(r.params.EchoSpeechDelay))
 				if delay > 0 {
 					time.Sleep(delay)
 				}
-				r.echoTrack.WriteSample(ts.sample, &lksdk.SampleWriteOptions{})
+				// with samples received in the meantime, tell whether the echoed speech ends with this sample
+				pending = receivePending(sampleChan, pending)
+				r.echoTrack.WriteSample(media.Sample{
+					Data:     pending[0].data,
+					Duration: opusFrameDuration,
+				}, &lksdk.SampleWriteOptions{})
+				if speechEndsAt(pending) {
+					r.stats.turns.userSpeechEnded(time.Now())
+				}
+				pending = pending[1:]
 			}
 		}()
 	}
 }
 
+// receivePending appends the samples that can be received without waiting
+func receivePending(samples <-chan timedSample, pending []timedSample) []timedSample {
+	for {
+		select {
+		case ts, ok := <-samples:
+			if !ok {
+				return pending
+			}
+			pending = append(pending, ts)
+		default:
+			return pending
+		}
+	}
+}
+
 func (r *LoadTestRoom) onParticipantDisconnected(rp *lksdk.RemoteParticipant) {
 	log.Printf("Participant disconnected, rp:%v/%v", rp.Identity(), rp.SID())
 	if rp.Identity() == r.firstParticipant.Identity() {
@@ -298,6 +405,28 @@ func (t *LoadTestRoom) isRunning() bool {
 	return t.running.Load()
 }
 
+type roomStatus string
+
+const (
+	roomStatusPending  roomStatus = "pending"
+	roomStatusJoined   roomStatus = "joined"
+	roomStatusTimedOut roomStatus = "timed out"
+	roomStatusFailed   roomStatus = "failed"
+)
+
+// status returns whether the agent joined the room in time
+func (r *LoadTestRoom) status() roomStatus {
+	switch {
+	case r.stats.err.Load() != nil:
+		return roomStatusFailed
+	case r.stats.agentJoinTimedOut.Load():
+		return roomStatusTimedOut
+	case r.stats.agentJoined.Load():
+		return roomStatusJoined
+	}
+	return roomStatusPending
+}
+
 func (t *AgentLoadTester) printStats() {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -306,7 +435,12 @@ func (t *AgentLoadTester) printStats() {
 	crossStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("1")) // Red
 
 	table := util.CreateTable().
-		Headers("#", "Room", "Agent Dispatched At", "Agent Joined", "Agent Join Delay", "Agent Track Subscribed", "Echo Track Published")
+		Headers("#", "Room", "Status", "Agent Dispatched At", "Agent Joined", "Agent Join Delay", "Agent Track Subscribed", "Echo Track Published",
+			"Responses", "Response Latency p50", "Agent Speaking")
+
+	// across all rooms
+	var joinLatency, responseLatency, speaking latencyStats
+	statusCounts := make(map[roomStatus]int)
 
 	rooms := make([]*LoadTestRoom, 0, len(t.testRooms))
 	for _, room := range t.testRooms {
@@ -325,24 +459,126 @@ func (t *AgentLoadTester) printStats() {
 			return crossStyle.Render("✗")
 		}
 		agentJoinDelay := "-"
-		if !room.stats.agentJoinedAt.IsZero() && !room.stats.agentDispatchedAt.IsZero() {
-			agentJoinDelay = room.stats.agentJoinedAt.Sub(room.stats.agentDispatchedAt).String()
+		agentJoinedAt := room.stats.agentJoinedAt.Load()
+		if !agentJoinedAt.IsZero() && !room.stats.agentDispatchedAt.IsZero() {
+			delay := agentJoinedAt.Sub(room.stats.agentDispatchedAt)
+			agentJoinDelay = delay.String()
+			joinLatency.add(delay)
+		}
+		turns, responses, agentSpeaking := room.stats.turns.counts()
+		responseLatencyP50 := "-"
+		if responses > 0 {
+			responseLatencyP50 = room.stats.turns.responseLatency.percentiles(50)[0].Round(time.Millisecond).String()
+			responseLatency.merge(&room.stats.turns.responseLatency)
+		}
+		if agentSpeaking > 0 {
+			speaking.add(agentSpeaking)
+		}
+
+		status := room.status()
+		statusCounts[status]++
+		statusString := string(status)
+		if err := room.stats.err.Load(); err != nil {
+			statusString += ": " + err.Error()
 		}
 
 		table.Row(
 			strconv.Itoa(index),
 			room.room.Name(),
+			statusString,
 			room.stats.agentDispatchedAt.Format(time.RFC3339),
-			boolToSymbol(room.stats.agentJoined),
+			boolToSymbol(room.stats.agentJoined.Load()),
 			agentJoinDelay,
-			boolToSymbol(room.stats.agentTrackSubscribed),
+			boolToSymbol(room.stats.agentTrackSubscribed.Load()),
 			boolToSymbol(room.stats.echoTrackPublished),
+			fmt.Sprintf("%d/%d", responses, turns),
+			responseLatencyP50,
+			agentSpeaking.Round(time.Second).String(),
 		)
 		index++
 	}
 
 	fmt.Println("\nTest Statistics:")
 	fmt.Println(table)
+
+	statusTable := util.CreateTable().
+		Headers("Rooms", "Agent Joined", "Timed Out", "Failed", "Pending")
+	statusTable.Row(
+		strconv.Itoa(len(rooms)),
+		strconv.Itoa(statusCounts[roomStatusJoined]),
+		strconv.Itoa(statusCounts[roomStatusTimedOut]),
+		strconv.Itoa(statusCounts[roomStatusFailed]),
+		strconv.Itoa(statusCounts[roomStatusPending]),
+	)
+	fmt.Println("\nRoom status:")
+	fmt.Println(statusTable)
+
+	latencyTable := util.CreateTable().
+		Headers("", "Samples", "p50/p95/p99").
+		Row("Dispatch to join", strconv.FormatInt(joinLatency.count, 10), formatLatency(joinLatency.toReport())).
+		Row("Voice response", strconv.FormatInt(responseLatency.count, 10), formatLatency(responseLatency.toReport())).
+		Row("Agent speaking per room", strconv.FormatInt(speaking.count, 10), formatLatency(speaking.toReport()))
+	fmt.Println("\nAgent latency across rooms:")
+	fmt.Println(latencyTable)
+}
+
+func (t *AgentLoadTester) writeMetrics(w *metricsWriter) {
+	t.lock.Lock()
+	names := make([]string, 0, len(t.testRooms))
+	rooms := make([]*LoadTestRoom, 0, len(t.testRooms))
+	for name, room := range t.testRooms {
+		names = append(names, name)
+		rooms = append(rooms, room)
+	}
+	t.lock.Unlock()
+
+	var active, agentsJoined, agentTracks, timedOut, failed int
+	var turns, responses int64
+	perRoom := []struct {
+		name  string
+		help  string
+		value func(r *LoadTestRoom) bool
+	}{
+		{"lk_agent_loadtest_room_connected", "Whether the echo participant is connected to the room.",
+			func(r *LoadTestRoom) bool { return r.isRunning() }},
+		{"lk_agent_loadtest_room_agent_joined", "Whether the agent joined the room.",
+			func(r *LoadTestRoom) bool { return r.stats.agentJoined.Load() }},
+		{"lk_agent_loadtest_room_agent_track_subscribed", "Whether the agent's audio track was subscribed.",
+			func(r *LoadTestRoom) bool { return r.stats.agentTrackSubscribed.Load() }},
+	}
+	for _, metric := range perRoom {
+		for i, room := range rooms {
+			w.write(metric.name, metricGauge, metric.help, boolToFloat(metric.value(room)), "room", names[i])
+		}
+	}
+	for _, room := range rooms {
+		if room.isRunning() {
+			active++
+		}
+		if room.stats.agentJoined.Load() {
+			agentsJoined++
+		}
+		if room.stats.agentTrackSubscribed.Load() {
+			agentTracks++
+		}
+		switch room.status() {
+		case roomStatusTimedOut:
+			timedOut++
+		case roomStatusFailed:
+			failed++
+		}
+		roomTurns, roomResponses, _ := room.stats.turns.counts()
+		turns += roomTurns
+		responses += roomResponses
+	}
+	w.write("lk_agent_loadtest_rooms", metricGauge, "Rooms opened by the test.", float64(len(rooms)))
+	w.write("lk_agent_loadtest_active_rooms", metricGauge, "Rooms with a connected echo participant.", float64(active))
+	w.write("lk_agent_loadtest_agents_joined", metricGauge, "Rooms the agent joined.", float64(agentsJoined))
+	w.write("lk_agent_loadtest_rooms_timed_out", metricGauge, "Rooms the agent did not join before the join timeout.", float64(timedOut))
+	w.write("lk_agent_loadtest_rooms_failed", metricGauge, "Rooms that could not be set up.", float64(failed))
+	w.write("lk_agent_loadtest_agent_tracks_subscribed", metricGauge, "Rooms where the agent's audio track was subscribed.", float64(agentTracks))
+	w.write("lk_agent_loadtest_turns_total", metricCounter, "Times the echo participant finished speaking.", float64(turns))
+	w.write("lk_agent_loadtest_responses_total", metricCounter, "Times the agent started speaking after the echo participant finished.", float64(responses))
 }
 
 func newAccessToken(apiKey, apiSecret, roomName, pID string) (string, error) {
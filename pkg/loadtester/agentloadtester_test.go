@@ -0,0 +1,50 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForAgent(t *testing.T) {
+	ctx := context.Background()
+
+	r := NewLoadTestRoom(AgentLoadTestParams{})
+	require.Equal(t, roomStatusPending, r.status())
+	require.False(t, r.waitForAgent(ctx, 10*time.Millisecond))
+	require.Equal(t, roomStatusTimedOut, r.status())
+
+	r = NewLoadTestRoom(AgentLoadTestParams{})
+	go func() {
+		r.stats.agentJoined.Store(true)
+		r.agentJoinedOnce.Do(func() { close(r.agentJoinedCh) })
+	}()
+	require.True(t, r.waitForAgent(ctx, time.Second))
+	require.Equal(t, roomStatusJoined, r.status())
+
+	r = NewLoadTestRoom(AgentLoadTestParams{})
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.False(t, r.waitForAgent(canceled, 0))
+	require.Equal(t, roomStatusPending, r.status(), "canceled rooms did not time out")
+
+	r.stats.err.Store(errors.New("could not connect"))
+	require.Equal(t, roomStatusFailed, r.status())
+}
@@ -0,0 +1,108 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"log"
+	"time"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// maximum time to wait for the agent to respond to an utterance, or to finish speaking
+	defaultTurnTimeout = 20 * time.Second
+	// how often the script checks whether the agent is speaking
+	scriptPollInterval = 50 * time.Millisecond
+)
+
+// LoadUtterances returns the user utterances of a scripted conversation,
+// the embedded voice samples when dir is "builtin"
+func LoadUtterances(dir string) ([]*provider2.Utterance, error) {
+	if dir == "builtin" {
+		return provider2.BuiltinUtterances()
+	}
+	return provider2.LoadUtterances(dir)
+}
+
+// runScript plays the utterances in turn into the room, until the room stops. Each utterance is played
+// EchoSpeechDelay after the agent stopped speaking, and the agent is given TurnTimeout to respond
+func (r *LoadTestRoom) runScript() {
+	// like the echo, the conversation starts with the agent's greeting,
+	// the first utterance is played anyway when the agent does not speak first
+	if !r.waitFor(r.stats.turns.agentSpoke, r.params.TurnTimeout) {
+		return
+	}
+	for i := 0; ; i++ {
+		// let the agent finish its greeting or its previous response
+		if !r.waitFor(func() bool { return !r.stats.turns.agentSpeaking(time.Now()) }, r.params.TurnTimeout) {
+			return
+		}
+		if r.params.EchoSpeechDelay > 0 && !r.waitFor(func() bool { return false }, r.params.EchoSpeechDelay) {
+			return
+		}
+
+		utterance := r.params.Utterances[i%len(r.params.Utterances)]
+		if err := r.play(utterance); err != nil {
+			log.Printf("Failed to play %s in room %s: %v", utterance.Name, r.room.Name(), err)
+			return
+		}
+		if !r.isRunning() {
+			return
+		}
+		_, responses, _ := r.stats.turns.counts()
+		r.stats.turns.userSpeechEnded(time.Now())
+
+		if !r.waitFor(func() bool {
+			_, n, _ := r.stats.turns.counts()
+			return n > responses
+		}, r.params.TurnTimeout) {
+			return
+		}
+	}
+}
+
+// play writes the samples of the utterance at their pace
+func (r *LoadTestRoom) play(u *provider2.Utterance) error {
+	next := time.Now()
+	for _, sample := range u.Samples {
+		if !r.isRunning() {
+			return nil
+		}
+		if err := r.echoTrack.WriteSample(sample, &lksdk.SampleWriteOptions{}); err != nil {
+			return err
+		}
+		next = next.Add(sample.Duration)
+		time.Sleep(time.Until(next))
+	}
+	return nil
+}
+
+// waitFor waits until done returns true or the timeout expires, without timeout when 0.
+// It returns false when the room stopped
+func (r *LoadTestRoom) waitFor(done func() bool, timeout time.Duration) bool {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for r.isRunning() {
+		if done() || !deadline.IsZero() && time.Now().After(deadline) {
+			return true
+		}
+		time.Sleep(scriptPollInterval)
+	}
+	return false
+}
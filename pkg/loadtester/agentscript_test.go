@@ -0,0 +1,90 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+	"github.com/stretchr/testify/require"
+)
+
+// writeOggOpus writes a recording of 20ms Opus packets
+func writeOggOpus(t *testing.T, path string, packets int) {
+	buf := &bytes.Buffer{}
+	w, err := oggwriter.NewWith(buf, 48000, 1)
+	require.NoError(t, err)
+	for i := 0; i < packets; i++ {
+		require.NoError(t, w.WriteRTP(&rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * 960)},
+			Payload: opusActive,
+		}))
+	}
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestLoadUtterances(t *testing.T) {
+	dir := t.TempDir()
+	_, err := LoadUtterances(dir)
+	require.Error(t, err, "no recordings")
+
+	writeOggOpus(t, filepath.Join(dir, "2-bye.opus"), 50)
+	writeOggOpus(t, filepath.Join(dir, "1-hello.ogg"), 100)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not audio"), 0644))
+	utterances, err := LoadUtterances(dir)
+	require.NoError(t, err)
+	require.Len(t, utterances, 2)
+	require.Equal(t, "1-hello.ogg", utterances[0].Name)
+	require.Len(t, utterances[0].Samples, 100)
+	require.Equal(t, 2*time.Second, utterances[0].Duration())
+	require.Equal(t, "2-bye.opus", utterances[1].Name)
+	require.Equal(t, time.Second, utterances[1].Duration())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3-broken.ogg"), []byte("not ogg"), 0644))
+	_, err = LoadUtterances(dir)
+	require.Error(t, err)
+
+	t.Run("builtin", func(t *testing.T) {
+		// the embedded recordings are stored with Git LFS, a clone without it only has their pointers
+		data, err := os.ReadFile("../provider/resources/change-amelia.ogg")
+		require.NoError(t, err)
+		if bytes.HasPrefix(data, []byte("version https://git-lfs")) {
+			t.Skip("embedded media not fetched from Git LFS")
+		}
+		utterances, err := LoadUtterances("builtin")
+		require.NoError(t, err)
+		require.NotEmpty(t, utterances)
+		for _, u := range utterances {
+			require.Greater(t, u.Duration(), time.Second, u.Name)
+		}
+	})
+}
+
+func TestAgentSpeaking(t *testing.T) {
+	s := &agentTurnStats{}
+	now := time.Now()
+	require.False(t, s.agentSpoke())
+	require.False(t, s.agentSpeaking(now))
+
+	s.onAgentFrame(now, true)
+	require.True(t, s.agentSpoke())
+	require.True(t, s.agentSpeaking(now.Add(speechEndSilence)))
+	require.False(t, s.agentSpeaking(now.Add(speechEndSilence+time.Millisecond)))
+}
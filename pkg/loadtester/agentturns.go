@@ -0,0 +1,119 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// opus frames of silence and comfort noise are a few bytes, larger frames carry speech
+	opusSilenceMaxSize = 10
+	// duration of the opus frames sent by agents
+	opusFrameDuration = 20 * time.Millisecond
+	// speech ends after this long without speech frames
+	speechEndSilence = 500 * time.Millisecond
+)
+
+func isSpeechFrame(payload []byte) bool {
+	return len(payload) > opusSilenceMaxSize
+}
+
+// agentTurnStats follows the turns of a conversation between the simulated user and the agent of a room
+type agentTurnStats struct {
+	lock sync.Mutex
+	// end of the last user speech that the agent did not respond to yet
+	pendingTurn time.Time
+	// last speech frame received from the agent
+	lastAgentSpeech time.Time
+
+	turns     int64
+	responses int64
+	// from the end of the user's speech until the first speech frame of the agent
+	responseLatency latencyStats
+	speaking        time.Duration
+}
+
+// userSpeechEnded starts a turn, that ends with the next agent response
+func (s *agentTurnStats) userSpeechEnded(at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.turns++
+	s.pendingTurn = at
+}
+
+// onAgentFrame records an audio frame received from the agent.
+// The agent responds when it starts speaking after the user's speech ended
+func (s *agentTurnStats) onAgentFrame(at time.Time, speech bool) {
+	if !speech {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.speaking += opusFrameDuration
+	startedSpeaking := s.lastAgentSpeech.IsZero() || at.Sub(s.lastAgentSpeech) > speechEndSilence
+	s.lastAgentSpeech = at
+	if startedSpeaking && !s.pendingTurn.IsZero() && at.After(s.pendingTurn) {
+		s.responses++
+		s.responseLatency.add(at.Sub(s.pendingTurn))
+		s.pendingTurn = time.Time{}
+	}
+}
+
+// agentSpoke returns true once the agent started speaking
+func (s *agentTurnStats) agentSpoke() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.lastAgentSpeech.IsZero()
+}
+
+// agentSpeaking returns true while speech frames are received from the agent
+func (s *agentTurnStats) agentSpeaking(now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return !s.lastAgentSpeech.IsZero() && now.Sub(s.lastAgentSpeech) <= speechEndSilence
+}
+
+// counts returns the number of turns, the responses of the agent, and how long the agent spoke
+func (s *agentTurnStats) counts() (int64, int64, time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.turns, s.responses, s.speaking
+}
+
+// timedSample is an audio sample with the time it was received
+type timedSample struct {
+	data     []byte
+	received time.Time
+}
+
+// speechEndsAt returns true when the speech of the first sample ends with it,
+// when the samples received after it contain no speech within speechEndSilence
+func speechEndsAt(samples []timedSample) bool {
+	if len(samples) == 0 || !isSpeechFrame(samples[0].data) {
+		return false
+	}
+	first := samples[0]
+	for _, next := range samples[1:] {
+		if next.received.Sub(first.received) > speechEndSilence {
+			break
+		}
+		if isSpeechFrame(next.data) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentTurnStats(t *testing.T) {
+	s := &agentTurnStats{}
+	start := time.Now()
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// greeting, before the user spoke
+	for ms := 0; ms < 1000; ms += 20 {
+		s.onAgentFrame(at(ms), true)
+	}
+	s.onAgentFrame(at(1000), false)
+
+	// the user stops speaking, the agent responds 800ms later
+	s.userSpeechEnded(at(6000))
+	s.onAgentFrame(at(6500), false)
+	s.onAgentFrame(at(6800), true)
+	s.onAgentFrame(at(6820), true)
+
+	// the agent is still speaking when the user stops, no response to the second turn yet
+	s.onAgentFrame(at(11990), true)
+	s.userSpeechEnded(at(12000))
+
+	turns, responses, speaking := s.counts()
+	require.EqualValues(t, 2, turns)
+	require.EqualValues(t, 1, responses)
+	require.Equal(t, 53*opusFrameDuration, speaking)
+	require.Equal(t, []time.Duration{800 * time.Millisecond}, s.responseLatency.percentiles(50))
+
+	// speech that continues after the turn ended is not a response
+	s.onAgentFrame(at(12010), true)
+	_, responses, _ = s.counts()
+	require.EqualValues(t, 1, responses)
+}
+
+func TestSpeechEndsAt(t *testing.T) {
+	start := time.Now()
+	speech := make([]byte, 80)
+	silence := make([]byte, 3)
+	sample := func(ms int, data []byte) timedSample {
+		return timedSample{data: data, received: start.Add(time.Duration(ms) * time.Millisecond)}
+	}
+
+	require.False(t, speechEndsAt(nil))
+	require.False(t, speechEndsAt([]timedSample{sample(0, silence)}))
+	require.True(t, speechEndsAt([]timedSample{sample(0, speech)}))
+	require.False(t, speechEndsAt([]timedSample{sample(0, speech), sample(20, silence), sample(40, speech)}))
+	require.True(t, speechEndsAt([]timedSample{sample(0, speech), sample(20, silence), sample(1000, speech)}))
+}
@@ -0,0 +1,94 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"github.com/pion/rtp"
+	"go.uber.org/atomic"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+)
+
+// larger gaps in sequence numbers are a restart of the stream rather than lost packets
+const maxAudioGap = 1000
+
+// audioFrameStats counts the Opus packets of a subscribed track, the packets that were lost,
+// and the lost packets a decoder recovers from the in-band FEC of the next packet
+type audioFrameStats struct {
+	frames    atomic.Int64
+	fec       atomic.Int64
+	lost      atomic.Int64
+	recovered atomic.Int64
+}
+
+// audioFrameCounter follows the sequence numbers of the Opus packets of a track while it is consumed
+type audioFrameCounter struct {
+	started bool
+	lastSeq uint16
+}
+
+func (c *audioFrameCounter) onPacket(ts *trackStats, pkt *rtp.Packet) {
+	s := &ts.audioFrames
+	s.frames.Inc()
+	hasFEC := provider2.OpusPacketHasFEC(pkt.Payload)
+	if hasFEC {
+		s.fec.Inc()
+	}
+	if c.started {
+		diff := pkt.SequenceNumber - c.lastSeq
+		if diff == 0 || diff >= 0x8000 {
+			// duplicate or late
+			return
+		}
+		if gap := int64(diff) - 1; gap > 0 && gap < maxAudioGap {
+			s.lost.Add(gap)
+			// FEC only carries the packet right before
+			if hasFEC {
+				s.recovered.Inc()
+			}
+		}
+	}
+	c.started = true
+	c.lastSeq = pkt.SequenceNumber
+}
+
+// toReport returns nil for tracks that are not Opus audio
+func (s *audioFrameStats) toReport() *AudioFrameReport {
+	frames := s.frames.Load()
+	if frames == 0 {
+		return nil
+	}
+	return &AudioFrameReport{
+		Frames:    frames,
+		FEC:       s.fec.Load(),
+		Lost:      s.lost.Load(),
+		Recovered: s.recovered.Load(),
+	}
+}
+
+// restore sets the counts of a report received from a distributed worker
+func (s *audioFrameStats) restore(r *AudioFrameReport) {
+	s.frames.Store(r.Frames)
+	s.fec.Store(r.FEC)
+	s.lost.Store(r.Lost)
+	s.recovered.Store(r.Recovered)
+}
+
+func (r *AudioFrameReport) add(other *AudioFrameReport) {
+	r.Frames += other.Frames
+	r.FEC += other.FEC
+	r.Lost += other.Lost
+	r.Recovered += other.Recovered
+}
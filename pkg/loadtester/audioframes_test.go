@@ -0,0 +1,122 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// SILK-only narrowband 20ms mono packets, the first byte of the frame holds the voice activity and FEC flags
+var (
+	opusActiveFEC = []byte{0x08, 0xc0, 0x12, 0x34}
+	opusActive    = []byte{0x08, 0x80, 0x12, 0x34}
+	opusInactive  = []byte{0x08, 0x00, 0x12, 0x34}
+	// CELT-only fullband, without flags
+	opusCELT = []byte{0xf8, 0x00, 0x12, 0x34}
+)
+
+type packetLooper struct {
+	lksdk.BaseSampleProvider
+	packets [][]byte
+}
+
+func (l *packetLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: "audio/opus"}
+}
+
+func (l *packetLooper) NextSample(_ context.Context) (media.Sample, error) {
+	packet := l.packets[0]
+	l.packets = append(l.packets[1:], packet)
+	return media.Sample{Data: packet, Duration: 20 * time.Millisecond}, nil
+}
+
+func TestOpusPacketFlags(t *testing.T) {
+	require.True(t, provider2.OpusPacketHasFEC(opusActiveFEC))
+	require.False(t, provider2.OpusPacketHasFEC(opusActive))
+	require.False(t, provider2.OpusPacketHasFEC(opusCELT))
+
+	require.True(t, provider2.OpusPacketIsActive(opusActive))
+	require.False(t, provider2.OpusPacketIsActive(opusInactive))
+	require.True(t, provider2.OpusPacketIsActive(opusCELT))
+	require.False(t, provider2.OpusPacketIsActive(opusInactive[:1]))
+}
+
+func TestDTXAudioLooper(t *testing.T) {
+	var packets [][]byte
+	for i := 0; i < 5; i++ {
+		packets = append(packets, opusActive)
+	}
+	for i := 0; i < 40; i++ {
+		packets = append(packets, opusInactive)
+	}
+	packets = append(packets, opusActive)
+	looper, err := provider2.NewDTXAudioLooper(&packetLooper{packets: packets})
+	require.NoError(t, err)
+
+	var durations []time.Duration
+	var total time.Duration
+	for total < 920*time.Millisecond {
+		sample, err := looper.NextSample(context.Background())
+		require.NoError(t, err)
+		durations = append(durations, sample.Duration)
+		total += sample.Duration
+		if sample.Duration > 20*time.Millisecond {
+			require.Len(t, sample.Data, 1)
+		}
+	}
+	// active packets and 200ms of inactive ones are sent, then a packet every 400ms until activity resumes
+	require.Len(t, durations, 5+10+2+1)
+	require.Equal(t, 400*time.Millisecond, durations[15])
+	require.Equal(t, 200*time.Millisecond, durations[16])
+	require.Equal(t, 920*time.Millisecond, total)
+
+	video, err := provider2.NewTestPatternVideoLooper(320, 180, 300, 30)
+	require.NoError(t, err)
+	_, err = provider2.NewDTXAudioLooper(video)
+	require.Error(t, err)
+}
+
+func TestAudioFrameCounter(t *testing.T) {
+	ts := &trackStats{}
+	c := &audioFrameCounter{}
+	packet := func(seq uint16, payload []byte) {
+		c.onPacket(ts, &rtp.Packet{Header: rtp.Header{SequenceNumber: seq}, Payload: payload})
+	}
+	packet(65534, opusActiveFEC)
+	packet(65535, opusActiveFEC)
+	// one lost across the wrap around, recovered with FEC
+	packet(1, opusActiveFEC)
+	// two lost, only the last one is recovered
+	packet(4, opusActiveFEC)
+	// one lost, without FEC
+	packet(6, opusActive)
+	// late
+	packet(5, opusActiveFEC)
+
+	r := ts.audioFrames.toReport()
+	require.Equal(t, &AudioFrameReport{Frames: 6, FEC: 5, Lost: 4, Recovered: 2}, r)
+
+	require.Nil(t, (&trackStats{}).audioFrames.toReport())
+}
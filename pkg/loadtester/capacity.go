@@ -0,0 +1,243 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livekit/livekit-cli/v2/pkg/util"
+)
+
+// CapacityTarget is the participant count ramped by a capacity search
+type CapacityTarget string
+
+const (
+	CapacitySubscribers CapacityTarget = "subscribers"
+	CapacityPublishers  CapacityTarget = "publishers"
+
+	// duration of each step when no duration is given
+	defaultCapacityStepDuration = 30 * time.Second
+)
+
+func CapacityTargetFromString(str string) (CapacityTarget, error) {
+	switch strings.ToLower(str) {
+	case "", string(CapacitySubscribers):
+		return CapacitySubscribers, nil
+	case string(CapacityPublishers), "video-publishers":
+		return CapacityPublishers, nil
+	}
+	return CapacitySubscribers, fmt.Errorf("unsupported capacity target %q, choose from \"subscribers\", \"publishers\"", str)
+}
+
+// CapacityParams configures a search for the largest participant count that meets the thresholds
+type CapacityParams struct {
+	Target CapacityTarget
+	// count of the first step, and the count added at each following step until thresholds are violated
+	Start int
+	Step  int
+	// largest count tried
+	Max int
+	// once a step fails, counts between the last passing and the failing step are bisected
+	// until they are at most Precision apart
+	Precision int
+}
+
+func (p *CapacityParams) setDefaults() {
+	if p.Target == "" {
+		p.Target = CapacitySubscribers
+	}
+	if p.Step <= 0 {
+		p.Step = 10
+	}
+	if p.Start <= 0 {
+		p.Start = p.Step
+	}
+	if p.Max <= 0 {
+		p.Max = 1000
+	}
+	if p.Precision <= 0 {
+		p.Precision = max(1, p.Step/10)
+	}
+}
+
+// default service level objective, when no thresholds are given
+func defaultCapacityThresholds() []Threshold {
+	return []Threshold{MaxPacketLoss(2), MinTrackRatio(0.95)}
+}
+
+// searchCapacity ramps the count in steps until probe fails, then bisects between the last passing and
+// the failing count. It returns the largest passing count, 0 when none passed
+func searchCapacity(p CapacityParams, probe func(n int) (bool, error)) (int, error) {
+	passing, failing := 0, 0
+	for n := p.Start; n <= p.Max; n += p.Step {
+		passed, err := probe(n)
+		if err != nil {
+			return 0, err
+		}
+		if !passed {
+			failing = n
+			break
+		}
+		passing = n
+	}
+	if failing == 0 {
+		// never failed up to the maximum
+		return passing, nil
+	}
+	for failing-passing > p.Precision {
+		mid := passing + (failing-passing)/2
+		passed, err := probe(mid)
+		if err != nil {
+			return 0, err
+		}
+		if passed {
+			passing = mid
+		} else {
+			failing = mid
+		}
+	}
+	return passing, nil
+}
+
+// CapacityReport is the result of a capacity search, each step is reported as a run
+type CapacityReport struct {
+	Target   CapacityTarget `json:"target"`
+	Capacity int            `json:"capacity"`
+	// counts tried, in the order they ran
+	Steps []int `json:"steps"`
+}
+
+// FindCapacity searches the largest number of subscribers or publishers for which the thresholds pass
+func (t *LoadTest) FindCapacity(ctx context.Context, cp CapacityParams) error {
+	cp.setDefaults()
+	thresholds := t.Params.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = defaultCapacityThresholds()
+	}
+	base := t.Params
+	if base.Duration == 0 {
+		base.Duration = defaultCapacityStepDuration
+	}
+	// the ramped count is measured against at least one publisher and one subscriber
+	if base.VideoPublishers == 0 && base.AudioPublishers == 0 {
+		base.VideoPublishers = 1
+	}
+	if base.Subscribers == 0 {
+		base.Subscribers = 1
+	}
+
+	stopMetrics, err := t.serveMetrics()
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	thresholdNames := make([]string, 0, len(thresholds))
+	for _, th := range thresholds {
+		thresholdNames = append(thresholdNames, fmt.Sprintf("%s %s", th.Name, strconv.FormatFloat(th.Limit, 'f', -1, 64)))
+	}
+	fmt.Printf("Searching %s capacity from %d to %d in steps of %d, %s each, thresholds: %s\n",
+		cp.Target, cp.Start, cp.Max, cp.Step, base.Duration.String(), strings.Join(thresholdNames, ", "))
+
+	report := &Report{
+		StartedAt: time.Now(),
+		Seed:      base.Seed,
+		Capacity:  &CapacityReport{Target: cp.Target},
+	}
+	probe := func(n int) (bool, error) {
+		params := base
+		switch cp.Target {
+		case CapacityPublishers:
+			params.VideoPublishers = n
+		default:
+			params.Subscribers = n
+		}
+		if err := checkAcceptableUse(params.URL, params.VideoPublishers, params.AudioPublishers, params.Subscribers); err != nil {
+			return false, err
+		}
+		params.setDefaultNames()
+		fmt.Printf("\nRunning step %d: %d %s\n", len(report.Runs)+1, n, cp.Target)
+
+		stats, err := t.run(ctx, params)
+		if err != nil {
+			return false, err
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		runReport := newRunReport(fmt.Sprintf("capacity-%d-%s", n, cp.Target), params.Room, stats)
+		runReport.Thresholds = evaluateThresholds(thresholds, runReport.Total)
+		printThresholdResults(runReport.Thresholds)
+		report.Runs = append(report.Runs, runReport)
+		report.Capacity.Steps = append(report.Capacity.Steps, n)
+		return runReport.Passed(), nil
+	}
+
+	capacity, err := searchCapacity(cp, probe)
+	if err != nil {
+		return err
+	}
+	report.Capacity.Capacity = capacity
+	printCapacityCurve(report)
+
+	if err := t.writeReport(report); err != nil {
+		return err
+	}
+	if capacity == 0 {
+		return fmt.Errorf("%w: no %s count met the thresholds", ErrThresholdsViolated, cp.Target)
+	}
+	return nil
+}
+
+func printCapacityCurve(r *Report) {
+	order := make([]int, len(r.Runs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return r.Capacity.Steps[order[i]] < r.Capacity.Steps[order[j]]
+	})
+
+	countHeader := "Subs"
+	if r.Capacity.Target == CapacityPublishers {
+		countHeader = "Pubs"
+	}
+	table := util.CreateTable().
+		Headers(countHeader, "Tracks", "Bitrate", "Pkt. Loss", "Errors", "Thresholds")
+	for _, i := range order {
+		run := r.Runs[i]
+		total := run.Total
+		table.Row(
+			strconv.Itoa(r.Capacity.Steps[i]),
+			fmt.Sprintf("%d/%d", total.Tracks, total.Expected),
+			formatBitrate(total.Bytes, total.Elapsed),
+			formatLossRate(total.Packets, total.Dropped),
+			strconv.FormatInt(total.Errors, 10),
+			formatThresholdResult(run),
+		)
+	}
+	fmt.Println("\nCapacity curve:")
+	fmt.Println(table)
+	if r.Capacity.Capacity > 0 {
+		fmt.Printf("\nCapacity: %d %s\n", r.Capacity.Capacity, r.Capacity.Target)
+	} else {
+		fmt.Printf("\nCapacity: no %s count met the thresholds\n", r.Capacity.Target)
+	}
+}
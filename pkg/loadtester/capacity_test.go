@@ -0,0 +1,86 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCapacity(t *testing.T) {
+	search := func(p CapacityParams, limit int) (int, []int, error) {
+		p.setDefaults()
+		var steps []int
+		capacity, err := searchCapacity(p, func(n int) (bool, error) {
+			steps = append(steps, n)
+			return n <= limit, nil
+		})
+		return capacity, steps, err
+	}
+
+	t.Run("ramps then bisects", func(t *testing.T) {
+		capacity, steps, err := search(CapacityParams{Step: 10, Precision: 1}, 37)
+		require.NoError(t, err)
+		require.Equal(t, 37, capacity)
+		require.Equal(t, []int{10, 20, 30, 40, 35, 37, 38}, steps)
+	})
+
+	t.Run("stops at precision", func(t *testing.T) {
+		capacity, _, err := search(CapacityParams{Start: 50, Step: 50, Precision: 10}, 123)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, capacity, 113)
+		require.LessOrEqual(t, capacity, 123)
+	})
+
+	t.Run("never fails", func(t *testing.T) {
+		capacity, steps, err := search(CapacityParams{Step: 10, Max: 95}, 1000)
+		require.NoError(t, err)
+		require.Equal(t, 90, capacity)
+		require.Len(t, steps, 9)
+	})
+
+	t.Run("always fails", func(t *testing.T) {
+		capacity, _, err := search(CapacityParams{Step: 10, Precision: 1}, 0)
+		require.NoError(t, err)
+		require.Equal(t, 0, capacity)
+	})
+
+	t.Run("probe error", func(t *testing.T) {
+		p := CapacityParams{}
+		p.setDefaults()
+		probeErr := errors.New("canceled")
+		_, err := searchCapacity(p, func(n int) (bool, error) {
+			return false, probeErr
+		})
+		require.ErrorIs(t, err, probeErr)
+	})
+}
+
+func TestCapacityParamsDefaults(t *testing.T) {
+	p := CapacityParams{Step: 50}
+	p.setDefaults()
+	require.Equal(t, CapacitySubscribers, p.Target)
+	require.Equal(t, 50, p.Start)
+	require.Equal(t, 1000, p.Max)
+	require.Equal(t, 5, p.Precision)
+
+	target, err := CapacityTargetFromString("Publishers")
+	require.NoError(t, err)
+	require.Equal(t, CapacityPublishers, target)
+	_, err = CapacityTargetFromString("rooms")
+	require.Error(t, err)
+}
@@ -0,0 +1,118 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type SessionDistribution string
+
+const (
+	// every session lasts SessionLength
+	SessionDistributionFixed SessionDistribution = "fixed"
+	// sessions last between 0 and twice SessionLength
+	SessionDistributionUniform SessionDistribution = "uniform"
+	// sessions are exponentially distributed with a mean of SessionLength
+	SessionDistributionExponential SessionDistribution = "exponential"
+)
+
+func SessionDistributionFromString(str string) (SessionDistribution, error) {
+	switch d := SessionDistribution(strings.ToLower(str)); d {
+	case "":
+		return SessionDistributionFixed, nil
+	case SessionDistributionFixed, SessionDistributionUniform, SessionDistributionExponential:
+		return d, nil
+	}
+	return "", fmt.Errorf("unsupported session distribution %q, choose from \"fixed\", \"uniform\", \"exponential\"", str)
+}
+
+// ChurnParams makes subscribers leave the room during the test, and possibly join again
+type ChurnParams struct {
+	// average time a subscriber stays connected before leaving, churn is disabled when 0
+	SessionLength       time.Duration
+	SessionDistribution SessionDistribution
+	// probability (0-1) that a subscriber joins again after leaving
+	RejoinProbability float64
+	// time a subscriber stays away before joining again
+	RejoinDelay time.Duration
+	// maximum number of subscribers leaving or joining per second, defaults to the ramp-up rate
+	Rate float64
+}
+
+func (c ChurnParams) Enabled() bool {
+	return c.SessionLength > 0
+}
+
+func (c ChurnParams) rate(numPerSecond float64) float64 {
+	if c.Rate > 0 {
+		return c.Rate
+	}
+	return numPerSecond
+}
+
+func (c ChurnParams) sessionLength(r *rand.Rand) time.Duration {
+	switch c.SessionDistribution {
+	case SessionDistributionUniform:
+		return time.Duration(r.Int63n(2 * int64(c.SessionLength)))
+	case SessionDistributionExponential:
+		return time.Duration(r.ExpFloat64() * float64(c.SessionLength))
+	default:
+		return c.SessionLength
+	}
+}
+
+// run stops and restarts the tester until ctx is done or the tester leaves for good
+func (c ChurnParams) run(ctx context.Context, tester *LoadTester, limiter *rate.Limiter, r *rand.Rand) {
+	for {
+		if !sleepContext(ctx, c.sessionLength(r)) {
+			return
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		tester.Stop()
+
+		if r.Float64() >= c.RejoinProbability {
+			return
+		}
+		if !sleepContext(ctx, c.RejoinDelay) {
+			return
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		if err := tester.Start(); err != nil {
+			fmt.Printf("could not rejoin %s: %v\n", tester.params.name, err)
+			return
+		}
+	}
+}
+
+// sleepContext returns false when ctx is done before d elapsed
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
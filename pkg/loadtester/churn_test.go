@@ -0,0 +1,67 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChurnSessionLength(t *testing.T) {
+	d, err := SessionDistributionFromString("")
+	require.NoError(t, err)
+	require.Equal(t, SessionDistributionFixed, d)
+	_, err = SessionDistributionFromString("normal")
+	require.Error(t, err)
+
+	r := newRandom(randomChurn)
+	c := ChurnParams{SessionLength: 10 * time.Second}
+	require.True(t, c.Enabled())
+	require.Equal(t, 10*time.Second, c.sessionLength(r))
+	require.Equal(t, 5.0, c.rate(5))
+
+	c.SessionDistribution = SessionDistributionUniform
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		l := c.sessionLength(r)
+		require.GreaterOrEqual(t, l, time.Duration(0))
+		require.Less(t, l, 20*time.Second)
+		total += l
+	}
+	require.InDelta(t, float64(10*time.Second), float64(total/1000), float64(time.Second))
+
+	require.False(t, ChurnParams{}.Enabled())
+}
+
+func TestSessionTime(t *testing.T) {
+	start := time.Now()
+	ts := &trackStats{trackID: "TR_video"}
+	ts.consumed.begin(start)
+	ts.consumed.end(start.Add(10 * time.Second))
+	// the subscriber left, then rejoined 20s later
+	require.Equal(t, 10*time.Second, ts.consumed.elapsed(start.Add(30*time.Second)))
+	ts.consumed.begin(start.Add(30 * time.Second))
+	ts.consumed.begin(start.Add(31 * time.Second))
+	require.Equal(t, 15*time.Second, ts.consumed.elapsed(start.Add(35*time.Second)))
+	ts.consumed.end(start.Add(40 * time.Second))
+	ts.consumed.end(start.Add(50 * time.Second))
+	require.Equal(t, 20*time.Second, ts.consumed.elapsed(start.Add(60*time.Second)))
+
+	ts.bytes.Store(2_500_000)
+	// 1 Mbps while consumed, rather than 500 kbps over the first session until the end of the second one
+	require.InDelta(t, 1_000_000, bitsPerSecond(ts.bytes.Load(), ts.consumed.elapsed(start)), 1)
+}
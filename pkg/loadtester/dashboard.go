@@ -0,0 +1,168 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/livekit-cli/v2/pkg/util"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	dashboardInterval = time.Second
+	// number of most recent errors shown
+	dashboardErrorLines = 10
+)
+
+// dashboard periodically renders the state of a running load test
+type dashboard struct {
+	room      string
+	startedAt time.Time
+
+	lock    sync.Mutex
+	testers []*LoadTester
+	states  map[string]lksdk.ConnectionState
+	errors  []string
+	prev    dashboardTotals
+}
+
+type dashboardTotals struct {
+	at      time.Time
+	packets int64
+	bytes   int64
+	dropped int64
+}
+
+func newDashboard(room string) *dashboard {
+	now := time.Now()
+	return &dashboard{
+		room:      room,
+		startedAt: now,
+		states:    make(map[string]lksdk.ConnectionState),
+		prev:      dashboardTotals{at: now},
+	}
+}
+
+func (d *dashboard) addTester(t *LoadTester) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.testers = append(d.testers, t)
+}
+
+func (d *dashboard) logError(name string, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.logLocked(fmt.Sprintf("%s: %v", name, err))
+}
+
+func (d *dashboard) logLocked(msg string) {
+	d.errors = append(d.errors, fmt.Sprintf("%s %s", time.Now().Format(time.TimeOnly), msg))
+	if len(d.errors) > dashboardErrorLines {
+		d.errors = d.errors[len(d.errors)-dashboardErrorLines:]
+	}
+}
+
+// start refreshes the dashboard until ctx is canceled or the returned stop function is called
+func (d *dashboard) start(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(dashboardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// clear the screen, other output is overwritten on the next refresh
+				fmt.Print("\033[H\033[2J")
+				fmt.Println(d.render())
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (d *dashboard) render() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	var connected, reconnecting, tracks, expected int
+	totals := dashboardTotals{at: now}
+	for _, t := range d.testers {
+		state := t.ConnectionState()
+		if prev, ok := d.states[t.params.name]; ok && prev != state && state != lksdk.ConnectionStateConnected {
+			d.logLocked(fmt.Sprintf("%s: %s", t.params.name, state))
+		}
+		d.states[t.params.name] = state
+		switch state {
+		case lksdk.ConnectionStateConnected:
+			connected++
+		case lksdk.ConnectionStateReconnecting:
+			reconnecting++
+		}
+
+		stats := t.getStats()
+		expected += stats.expectedTracks
+		for _, ts := range stats.trackStats {
+			tracks++
+			totals.packets += ts.packets.Load()
+			totals.bytes += ts.bytes.Load()
+			totals.dropped += ts.dropped.Load()
+		}
+	}
+	prev := d.prev
+	d.prev = totals
+
+	testersString := fmt.Sprintf("%d/%d", connected, len(d.testers))
+	if reconnecting > 0 {
+		testersString += fmt.Sprintf(" (%d reconnecting)", reconnecting)
+	}
+	elapsed := now.Sub(d.startedAt)
+	statusTable := util.CreateTable().
+		Headers("", "Current", "Total").
+		Row("Testers connected", testersString, "-").
+		Row("Subscribed tracks", fmt.Sprintf("%d/%d", tracks, expected), "-").
+		Row("Bitrate",
+			formatBitrate(totals.bytes-prev.bytes, now.Sub(prev.at)),
+			formatBitrate(totals.bytes, elapsed),
+		).
+		Row("Pkt. Loss",
+			formatLossRate(totals.packets-prev.packets, totals.dropped-prev.dropped),
+			formatLossRate(totals.packets, totals.dropped),
+		)
+
+	var b strings.Builder
+	b.WriteString(util.Accented(fmt.Sprintf("Load test in room %s, running for %s", d.room, elapsed.Round(time.Second))))
+	b.WriteString("\n")
+	b.WriteString(statusTable.String())
+	b.WriteString("\n\nRecent errors:\n")
+	if len(d.errors) == 0 {
+		b.WriteString(util.Dimmed("none"))
+	} else {
+		b.WriteString(util.Dimmed(strings.Join(d.errors, "\n")))
+	}
+	return b.String()
+}
@@ -0,0 +1,196 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	dataPacketMagic      = "lkdt"
+	dataPacketHeaderSize = 20
+	defaultDataTopic     = "loadtest"
+)
+
+// DataParams configures the data packets sent by data publishers
+type DataParams struct {
+	// packets per second sent by each data publisher, across topics
+	Rate float64
+	// payload size in bytes, at least 20 to fit the sequence number and timestamp
+	Size int
+	// topics are sent to in turn
+	Topics []DataTopic
+}
+
+type DataTopic struct {
+	Name     string
+	Reliable bool
+}
+
+// DataTopicsFromString parses comma separated topics, reliable by default, e.g. "chat,cursor:lossy"
+func DataTopicsFromString(str string) ([]DataTopic, error) {
+	var topics []DataTopic
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		topic := DataTopic{Name: s, Reliable: true}
+		if name, kind, ok := strings.Cut(s, ":"); ok {
+			topic.Name = name
+			switch strings.ToLower(kind) {
+			case "reliable":
+			case "lossy":
+				topic.Reliable = false
+			default:
+				return nil, fmt.Errorf("unsupported data topic kind %q, choose from \"reliable\", \"lossy\"", kind)
+			}
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+func (p *DataParams) setDefaults() {
+	if p.Rate <= 0 {
+		p.Rate = 10
+	}
+	if p.Size < dataPacketHeaderSize {
+		p.Size = dataPacketHeaderSize
+	}
+	if len(p.Topics) == 0 {
+		p.Topics = []DataTopic{{Name: defaultDataTopic, Reliable: true}}
+	}
+}
+
+// dataTopicStats are kept per topic, sent by publishers and received by subscribers
+type dataTopicStats struct {
+	topic    string
+	reliable bool
+	sent     atomic.Int64
+	received atomic.Int64
+	bytes    atomic.Int64
+	// packets received with a sequence number lower than one already received from the same sender
+	outOfOrder atomic.Int64
+	latency    latencyStats
+
+	lock sync.Mutex
+	// sender identity => last sequence number
+	lastSeq map[string]uint64
+}
+
+func newDataTopicStats(topic string, reliable bool) *dataTopicStats {
+	return &dataTopicStats{
+		topic:    topic,
+		reliable: reliable,
+		lastSeq:  make(map[string]uint64),
+	}
+}
+
+func (s *dataTopicStats) receive(sender string, seq uint64, size int, latency time.Duration) {
+	s.received.Inc()
+	s.bytes.Add(int64(size))
+	s.latency.add(latency)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if last, ok := s.lastSeq[sender]; ok && seq <= last {
+		s.outOfOrder.Inc()
+		return
+	}
+	s.lastSeq[sender] = seq
+}
+
+func newDataPacket(size int, seq uint64, sentAt time.Time) []byte {
+	payload := make([]byte, size)
+	copy(payload, dataPacketMagic)
+	binary.BigEndian.PutUint64(payload[4:], seq)
+	binary.BigEndian.PutUint64(payload[12:], uint64(sentAt.UnixNano()))
+	return payload
+}
+
+func parseDataPacket(payload []byte) (uint64, time.Time, error) {
+	if len(payload) < dataPacketHeaderSize || string(payload[:4]) != dataPacketMagic {
+		return 0, time.Time{}, errors.New("not a load test data packet")
+	}
+	seq := binary.BigEndian.Uint64(payload[4:])
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(payload[12:])))
+	return seq, sentAt, nil
+}
+
+// PublishData sends data packets until the tester is stopped
+func (t *LoadTester) PublishData(params DataParams) {
+	if !t.IsRunning() {
+		return
+	}
+	params.setDefaults()
+	fmt.Println("publishing data -", t.room.LocalParticipant.Identity())
+
+	topics := make([]*dataTopicStats, 0, len(params.Topics))
+	for _, topic := range params.Topics {
+		topics = append(topics, t.dataTopicStats(topic.Name, topic.Reliable))
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / params.Rate))
+		defer ticker.Stop()
+		var seq uint64
+		for i := 0; t.IsRunning(); i++ {
+			<-ticker.C
+			s := topics[i%len(topics)]
+			seq++
+			err := t.room.LocalParticipant.PublishDataPacket(
+				lksdk.UserData(newDataPacket(params.Size, seq, time.Now())),
+				lksdk.WithDataPublishTopic(s.topic),
+				lksdk.WithDataPublishReliable(s.reliable),
+			)
+			if err == nil {
+				s.sent.Inc()
+			}
+		}
+	}()
+}
+
+func (t *LoadTester) onDataPacket(data lksdk.DataPacket, params lksdk.DataReceiveParams) {
+	if !t.params.Subscribe {
+		return
+	}
+	packet, ok := data.(*lksdk.UserDataPacket)
+	if !ok {
+		return
+	}
+	seq, sentAt, err := parseDataPacket(packet.Payload)
+	if err != nil {
+		// not sent by a load tester
+		return
+	}
+	// reliability is set by the sender, and unknown to receivers
+	s := t.dataTopicStats(packet.Topic, false)
+	s.receive(params.SenderIdentity, seq, len(packet.Payload), time.Since(sentAt))
+}
+
+func (t *LoadTester) dataTopicStats(topic string, reliable bool) *dataTopicStats {
+	value, _ := t.dataStats.LoadOrStore(topic, newDataTopicStats(topic, reliable))
+	return value.(*dataTopicStats)
+}
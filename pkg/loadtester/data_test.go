@@ -0,0 +1,83 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataTopicsFromString(t *testing.T) {
+	topics, err := DataTopicsFromString("chat, cursor:lossy,events:reliable")
+	require.NoError(t, err)
+	require.Equal(t, []DataTopic{
+		{Name: "chat", Reliable: true},
+		{Name: "cursor", Reliable: false},
+		{Name: "events", Reliable: true},
+	}, topics)
+
+	_, err = DataTopicsFromString("chat:unordered")
+	require.Error(t, err)
+}
+
+func TestDataPacket(t *testing.T) {
+	sentAt := time.Now()
+	payload := newDataPacket(100, 42, sentAt)
+	require.Len(t, payload, 100)
+
+	seq, ts, err := parseDataPacket(payload)
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), seq)
+	require.Equal(t, sentAt.UnixNano(), ts.UnixNano())
+
+	_, _, err = parseDataPacket([]byte("hello from an app"))
+	require.Error(t, err)
+}
+
+func TestDataTopicReports(t *testing.T) {
+	pub := newDataTopicStats("cursor", false)
+	pub.sent.Store(10)
+
+	sub := newDataTopicStats("cursor", false)
+	for _, seq := range []uint64{1, 2, 4, 3, 5, 6, 7, 8, 9} {
+		sub.receive("pub", seq, 100, 10*time.Millisecond)
+	}
+	require.EqualValues(t, 1, sub.outOfOrder.Load())
+
+	stats := newTestStats()
+	stats["Pub 0"].dataStats = map[string]*dataTopicStats{"cursor": pub}
+	stats["Sub 0"].dataStats = map[string]*dataTopicStats{"cursor": sub}
+
+	r := newRunReport("load-test", "room", stats)
+	require.Len(t, r.Data, 1)
+	d := r.Data[0]
+	require.Equal(t, "cursor", d.Topic)
+	require.False(t, d.Reliable)
+	require.EqualValues(t, 10, d.Sent)
+	require.EqualValues(t, 10, d.Expected, "Sub 1 could not connect")
+	require.EqualValues(t, 9, d.Received)
+	require.InDelta(t, 90.0, d.Delivery, 0.001)
+	require.EqualValues(t, 1, d.OutOfOrder)
+	require.Equal(t, 10*time.Millisecond, d.Latency.P50)
+
+	// Sub 0 left halfway through, Sub 1 joined later and stayed connected for 4s
+	stats["Sub 0"].connected = 5 * time.Second
+	stats["Sub 1"].connected = 4 * time.Second
+	r = newRunReport("load-test", "room", stats)
+	require.EqualValues(t, 9, r.Data[0].Expected)
+	require.InDelta(t, 100.0, r.Data[0].Delivery, 0.001)
+}
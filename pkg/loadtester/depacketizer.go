@@ -0,0 +1,104 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// newDepacketizer returns a depacketizer for the negotiated codec of a subscribed track
+func newDepacketizer(mimeType string) (rtp.Depacketizer, error) {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return &codecs.OpusPacket{}, nil
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return &codecs.H264Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return &codecs.VP8Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return &codecs.VP9Packet{}, nil
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		return &codecs.AV1Depacketizer{}, nil
+	}
+	return nil, fmt.Errorf("unsupported codec %s", mimeType)
+}
+
+// isKeyFrame returns true when the sample carried by pkts is a video keyframe
+func isKeyFrame(mimeType string, pkts []*rtp.Packet) bool {
+	if len(pkts) == 0 {
+		return false
+	}
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		for _, pkt := range pkts {
+			if h264KeyFrame(pkt.Payload) {
+				return true
+			}
+		}
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		vp8 := &codecs.VP8Packet{}
+		payload, err := vp8.Unmarshal(pkts[0].Payload)
+		if err != nil || len(payload) == 0 || vp8.S != 1 || vp8.PID != 0 {
+			return false
+		}
+		// P bit of the frame tag is 0 for keyframes
+		return payload[0]&0x01 == 0
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		vp9 := &codecs.VP9Packet{}
+		if _, err := vp9.Unmarshal(pkts[0].Payload); err != nil {
+			return false
+		}
+		return vp9.B && !vp9.P && vp9.SID == 0
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		// N bit, set on the first packet of a coded video sequence
+		return len(pkts[0].Payload) > 0 && pkts[0].Payload[0]&0x08 != 0
+	}
+	return false
+}
+
+const (
+	h264NaluIDR   = 5
+	h264NaluSEI   = 6
+	h264NaluSTAPA = 24
+	h264NaluFUA   = 28
+)
+
+func h264KeyFrame(payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	switch payload[0] & 0x1f {
+	case h264NaluIDR:
+		return true
+	case h264NaluSTAPA:
+		for i := 1; i+2 < len(payload); {
+			size := int(binary.BigEndian.Uint16(payload[i:]))
+			i += 2
+			if payload[i]&0x1f == h264NaluIDR {
+				return true
+			}
+			i += size
+		}
+	case h264NaluFUA:
+		return len(payload) > 1 && payload[1]&0x1f == h264NaluIDR
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDepacketizer(t *testing.T) {
+	for _, mimeType := range []string{"audio/opus", "video/H264", "video/vp8", "video/VP9", "video/AV1"} {
+		d, err := newDepacketizer(mimeType)
+		require.NoError(t, err, mimeType)
+		require.NotNil(t, d)
+	}
+	_, err := newDepacketizer("video/H265")
+	require.Error(t, err)
+}
+
+func TestIsKeyFrame(t *testing.T) {
+	t.Run("h264", func(t *testing.T) {
+		sps := []byte{0x67, 0x42, 0x00, 0x1f}
+		pps := []byte{0x68, 0xce, 0x3c, 0x80}
+		idr := append([]byte{0x65}, make([]byte, 3000)...)
+		nonIDR := append([]byte{0x41}, make([]byte, 3000)...)
+
+		var keyframe []byte
+		for _, nalu := range [][]byte{sps, pps, idr} {
+			keyframe = append(keyframe, 0x00, 0x00, 0x00, 0x01)
+			keyframe = append(keyframe, nalu...)
+		}
+		pkts := packetize(&codecs.H264Payloader{}, keyframe)
+		require.True(t, isKeyFrame(webrtc.MimeTypeH264, pkts))
+
+		// without parameter sets in front, the IDR is only found in the FU-A header
+		pkts = packetize(&codecs.H264Payloader{}, append([]byte{0x00, 0x00, 0x00, 0x01}, idr...))
+		require.True(t, isKeyFrame(webrtc.MimeTypeH264, pkts))
+
+		pkts = packetize(&codecs.H264Payloader{}, append([]byte{0x00, 0x00, 0x00, 0x01}, nonIDR...))
+		require.False(t, isKeyFrame(webrtc.MimeTypeH264, pkts))
+	})
+
+	t.Run("vp8", func(t *testing.T) {
+		keyframe := append([]byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, make([]byte, 2000)...)
+		pkts := packetize(&codecs.VP8Payloader{EnablePictureID: true}, keyframe)
+		require.True(t, isKeyFrame("video/vp8", pkts))
+
+		interframe := append([]byte{0x11, 0x02, 0x00}, make([]byte, 2000)...)
+		pkts = packetize(&codecs.VP8Payloader{EnablePictureID: true}, interframe)
+		require.False(t, isKeyFrame("video/vp8", pkts))
+	})
+
+	t.Run("audio", func(t *testing.T) {
+		require.False(t, isKeyFrame(webrtc.MimeTypeOpus, []*rtp.Packet{{Payload: []byte{0x00}}}))
+	})
+}
@@ -0,0 +1,803 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	coordinatorRegisterPath = "/register"
+	coordinatorProgressPath = "/progress"
+	coordinatorResultsPath  = "/results"
+	// interval at which workers send the stats of their running testers to the coordinator
+	workerProgressInterval = 10 * time.Second
+	// delay between the last worker registering and the start of the test, so that all workers start in sync
+	coordinatorStartDelay = 5 * time.Second
+	// time allowed for workers to connect their testers and report results, on top of the test duration
+	coordinatorResultsGrace = 5 * time.Minute
+	// time allowed to send the headers of a request, and then its body. Registrations are held until every worker
+	// registered, so the server has no overall read or write timeout
+	coordinatorReadHeaderTimeout = 10 * time.Second
+	coordinatorReadBodyTimeout   = time.Minute
+	coordinatorIdleTimeout       = 2 * time.Minute
+	// delay between registration attempts of a worker, doubled after each failure
+	workerRegisterMinBackoff = time.Second
+	workerRegisterMaxBackoff = 30 * time.Second
+)
+
+// workerRegistration is sent by workers when they join a coordinator
+type workerRegistration struct {
+	Hostname string `json:"hostname"`
+	// LiveKit server the worker is testing, credentials stay on the worker
+	URL string `json:"url"`
+}
+
+// workerAssignment is the share of the load test run by a worker
+type workerAssignment struct {
+	WorkerID         string            `json:"worker_id"`
+	StartAt          time.Time         `json:"start_at"`
+	Room             string            `json:"room"`
+	IdentityPrefix   string            `json:"identity_prefix"`
+	VideoPublishers  int               `json:"video_publishers"`
+	AudioPublishers  int               `json:"audio_publishers"`
+	Subscribers      int               `json:"subscribers"`
+	DataPublishers   int               `json:"data_publishers"`
+	Data             DataParams        `json:"data"`
+	ExpectedTracks   int               `json:"expected_tracks"`
+	VideoResolution  string            `json:"video_resolution"`
+	VideoCodec       string            `json:"video_codec"`
+	PublisherProfile PublisherProfile  `json:"publisher_profile,omitempty"`
+	Duration         time.Duration     `json:"duration"`
+	NumPerSecond     float64           `json:"num_per_second"`
+	Simulcast        bool              `json:"simulcast"`
+	SimulateSpeakers bool              `json:"simulate_speakers"`
+	RampDown         time.Duration     `json:"ramp_down"`
+	Layout           Layout            `json:"layout"`
+	SyntheticMedia   bool              `json:"synthetic_media"`
+	Watermark        bool              `json:"watermark,omitempty"`
+	RequireAudioFEC  bool              `json:"require_audio_fec,omitempty"`
+	AudioDTX         bool              `json:"audio_dtx,omitempty"`
+	Churn            ChurnParams       `json:"churn"`
+	NetworkProfiles  []*NetworkProfile `json:"network_profiles,omitempty"`
+	// phases are aligned to the wall clock, so workers switch layouts together
+	LayoutSwitchInterval time.Duration `json:"layout_switch_interval,omitempty"`
+	// derived from the coordinator's seed, each worker makes different random choices
+	Seed int64 `json:"seed"`
+}
+
+// workerResult carries the testerStats of a worker back to the coordinator
+type workerResult struct {
+	WorkerID string               `json:"worker_id"`
+	Testers  []*workerTesterStats `json:"testers"`
+	Error    string               `json:"error,omitempty"`
+}
+
+type workerTesterStats struct {
+	Name           string              `json:"name"`
+	NetworkProfile string              `json:"network_profile,omitempty"`
+	ExpectedTracks int                 `json:"expected_tracks"`
+	Error          string              `json:"error,omitempty"`
+	Tracks         []*workerTrackStats `json:"tracks"`
+	Joins          int64               `json:"joins"`
+	FailedJoins    int64               `json:"failed_joins"`
+	Reconnects     int64               `json:"reconnects"`
+	JoinRetries    int64               `json:"join_retries"`
+	Connected      time.Duration       `json:"connected"`
+	JoinLatency    *workerLatencyStats `json:"join_latency,omitempty"`
+	FirstTrack     *workerLatencyStats `json:"first_track,omitempty"`
+	FirstKeyframe  *workerLatencyStats `json:"first_keyframe,omitempty"`
+	Data           []*workerDataStats  `json:"data,omitempty"`
+}
+
+type workerTrackStats struct {
+	TrackID   string              `json:"track_id"`
+	Kind      string              `json:"kind"`
+	Source    string              `json:"source,omitempty"`
+	Codec     string              `json:"codec"`
+	Packets   int64               `json:"packets"`
+	Bytes     int64               `json:"bytes"`
+	Dropped   int64               `json:"dropped"`
+	Frames    int64               `json:"frames"`
+	Keyframes int64               `json:"keyframes"`
+	Elapsed   time.Duration       `json:"elapsed"`
+	Latency   *workerLatencyStats `json:"latency,omitempty"`
+
+	LayerSwitches *workerLayerSwitches `json:"layer_switches,omitempty"`
+	FrameSequence *FrameSequenceReport `json:"frame_sequence,omitempty"`
+	AudioFrames   *AudioFrameReport    `json:"audio_frames,omitempty"`
+}
+
+type workerLayerSwitches struct {
+	Requested int64               `json:"requested"`
+	Completed int64               `json:"completed"`
+	Verified  int64               `json:"verified"`
+	Latency   *workerLatencyStats `json:"latency,omitempty"`
+}
+
+type workerDataStats struct {
+	Topic      string              `json:"topic"`
+	Reliable   bool                `json:"reliable"`
+	Sent       int64               `json:"sent"`
+	Received   int64               `json:"received"`
+	Bytes      int64               `json:"bytes"`
+	OutOfOrder int64               `json:"out_of_order"`
+	Latency    *workerLatencyStats `json:"latency,omitempty"`
+}
+
+// workerLatencyStats carries the retained samples of a latencyStats
+type workerLatencyStats struct {
+	Count   int64           `json:"count"`
+	Samples []time.Duration `json:"samples"`
+}
+
+func newWorkerLatencyStats(l *latencyStats) *workerLatencyStats {
+	if l == nil || l.empty() {
+		return nil
+	}
+	w := &workerLatencyStats{}
+	w.Count, w.Samples = l.snapshot()
+	return w
+}
+
+func (w *workerLatencyStats) toLatencyStats() *latencyStats {
+	if w == nil {
+		return &latencyStats{}
+	}
+	return &latencyStats{
+		count:   w.Count,
+		samples: w.Samples,
+	}
+}
+
+// newWorkerTesters names the stats of a worker's testers after the worker, tester names are only unique within a worker
+func newWorkerTesters(workerID string, stats map[string]*testerStats) []*workerTesterStats {
+	testers := make([]*workerTesterStats, 0, len(stats))
+	for name, testerStats := range stats {
+		testers = append(testers, newWorkerTesterStats(fmt.Sprintf("%s @%s", name, workerID), testerStats))
+	}
+	return testers
+}
+
+func newWorkerTesterStats(name string, stats *testerStats) *workerTesterStats {
+	w := &workerTesterStats{
+		Name:           name,
+		NetworkProfile: stats.networkProfile,
+		ExpectedTracks: stats.expectedTracks,
+		Joins:          stats.joins,
+		FailedJoins:    stats.failedJoins,
+		Reconnects:     stats.reconnects,
+		JoinRetries:    stats.joinRetries,
+		Connected:      stats.connected,
+		JoinLatency:    newWorkerLatencyStats(stats.joinLatency),
+		FirstTrack:     newWorkerLatencyStats(stats.firstTrack),
+		FirstKeyframe:  newWorkerLatencyStats(stats.firstKeyframe),
+	}
+	if stats.err != nil {
+		w.Error = stats.err.Error()
+	}
+	for _, ds := range stats.dataStats {
+		w.Data = append(w.Data, &workerDataStats{
+			Topic:      ds.topic,
+			Reliable:   ds.reliable,
+			Sent:       ds.sent.Load(),
+			Received:   ds.received.Load(),
+			Bytes:      ds.bytes.Load(),
+			OutOfOrder: ds.outOfOrder.Load(),
+			Latency:    newWorkerLatencyStats(&ds.latency),
+		})
+	}
+	for _, ts := range stats.trackStats {
+		var layerSwitches *workerLayerSwitches
+		if requested, completed, verified := ts.layerSwitch.counts(); requested > 0 {
+			layerSwitches = &workerLayerSwitches{
+				Requested: requested,
+				Completed: completed,
+				Verified:  verified,
+				Latency:   newWorkerLatencyStats(&ts.layerSwitch.latency),
+			}
+		}
+		w.Tracks = append(w.Tracks, &workerTrackStats{
+			TrackID:   ts.trackID,
+			Kind:      string(ts.kind),
+			Source:    ts.source,
+			Codec:     ts.codec,
+			Packets:   ts.packets.Load(),
+			Bytes:     ts.bytes.Load(),
+			Dropped:   ts.dropped.Load(),
+			Frames:    ts.frames.Load(),
+			Keyframes: ts.keyframes.Load(),
+			Elapsed:   ts.elapsed(),
+			Latency:   newWorkerLatencyStats(&ts.latency),
+
+			LayerSwitches: layerSwitches,
+			FrameSequence: ts.frameSequence.toReport(),
+			AudioFrames:   ts.audioFrames.toReport(),
+		})
+	}
+	return w
+}
+
+func (w *workerTesterStats) toTesterStats() *testerStats {
+	stats := &testerStats{
+		expectedTracks: w.ExpectedTracks,
+		trackStats:     make(map[string]*trackStats),
+		dataStats:      make(map[string]*dataTopicStats),
+		networkProfile: w.NetworkProfile,
+		joins:          w.Joins,
+		failedJoins:    w.FailedJoins,
+		reconnects:     w.Reconnects,
+		joinRetries:    w.JoinRetries,
+		connected:      w.Connected,
+		joinLatency:    w.JoinLatency.toLatencyStats(),
+		firstTrack:     w.FirstTrack.toLatencyStats(),
+		firstKeyframe:  w.FirstKeyframe.toLatencyStats(),
+	}
+	if w.Error != "" {
+		stats.err = errors.New(w.Error)
+	}
+	for _, track := range w.Tracks {
+		ts := &trackStats{
+			trackID: track.TrackID,
+			kind:    lksdk.TrackKind(track.Kind),
+			source:  track.Source,
+			codec:   track.Codec,
+		}
+		ts.consumed.total = track.Elapsed
+		ts.packets.Store(track.Packets)
+		ts.bytes.Store(track.Bytes)
+		ts.dropped.Store(track.Dropped)
+		ts.frames.Store(track.Frames)
+		ts.keyframes.Store(track.Keyframes)
+		if track.Latency != nil {
+			ts.latency.count = track.Latency.Count
+			ts.latency.samples = track.Latency.Samples
+		}
+		if ls := track.LayerSwitches; ls != nil {
+			ts.layerSwitch.requested = ls.Requested
+			ts.layerSwitch.completed = ls.Completed
+			ts.layerSwitch.verified = ls.Verified
+			if ls.Latency != nil {
+				ts.layerSwitch.latency.count = ls.Latency.Count
+				ts.layerSwitch.latency.samples = ls.Latency.Samples
+			}
+		}
+		if track.FrameSequence != nil {
+			ts.frameSequence.restore(track.FrameSequence)
+		}
+		if track.AudioFrames != nil {
+			ts.audioFrames.restore(track.AudioFrames)
+		}
+		stats.trackStats[track.TrackID] = ts
+	}
+	for _, data := range w.Data {
+		ds := newDataTopicStats(data.Topic, data.Reliable)
+		ds.sent.Store(data.Sent)
+		ds.received.Store(data.Received)
+		ds.bytes.Store(data.Bytes)
+		ds.outOfOrder.Store(data.OutOfOrder)
+		if data.Latency != nil {
+			ds.latency.count = data.Latency.Count
+			ds.latency.samples = data.Latency.Samples
+		}
+		stats.dataStats[data.Topic] = ds
+	}
+	return stats
+}
+
+// share returns the part of total assigned to worker i out of n
+func share(total, n, i int) int {
+	s := total / n
+	if i < total%n {
+		s++
+	}
+	return s
+}
+
+type CoordinatorParams struct {
+	// address to listen on for workers, e.g. ":7880"
+	Bind string
+	// number of workers to wait for before starting the test
+	Workers int
+	// workers must send this token when set
+	Token string
+}
+
+// Coordinator splits a load test across workers running on other hosts, and merges their results into one report
+type Coordinator struct {
+	*LoadTest
+	params CoordinatorParams
+
+	lock          sync.Mutex
+	registrations []*workerRegistration
+	startAt       time.Time
+	ready         chan struct{}
+	// latest stats sent by each worker while the test runs, by worker ID
+	progress map[string]*workerResult
+	results  chan *workerResult
+}
+
+func NewCoordinator(params Params, coordinatorParams CoordinatorParams) *Coordinator {
+	return &Coordinator{
+		LoadTest: NewLoadTest(params),
+		params:   coordinatorParams,
+		ready:    make(chan struct{}),
+		progress: make(map[string]*workerResult),
+		results:  make(chan *workerResult, coordinatorParams.Workers),
+	}
+}
+
+func (c *Coordinator) Run(ctx context.Context) error {
+	if c.params.Workers < 1 {
+		return errors.New("at least one worker is required")
+	}
+	if c.Params.Duration <= 0 {
+		return errors.New("duration is required for distributed load tests")
+	}
+	c.Params.setDefaultNames()
+
+	listener, err := net.Listen("tcp", c.params.Bind)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(coordinatorRegisterPath, c.handleRegister)
+	mux.HandleFunc(coordinatorProgressPath, c.handleProgress)
+	mux.HandleFunc(coordinatorResultsPath, c.handleResults)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: coordinatorReadHeaderTimeout,
+		IdleTimeout:       coordinatorIdleTimeout,
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	fmt.Printf("Waiting for %d workers on %s, room: %s\n", c.params.Workers, listener.Addr().String(), c.Params.Room)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ready:
+	}
+	fmt.Printf("All workers registered, starting at %s\n", c.startAt.Format(time.TimeOnly))
+
+	deadline := time.NewTimer(time.Until(c.startAt) + c.Params.Duration + c.Params.RampDown + coordinatorResultsGrace)
+	defer deadline.Stop()
+	progressTicker := time.NewTicker(workerProgressInterval)
+	defer progressTicker.Stop()
+	stats := make(map[string]*testerStats)
+	reported := make(map[string]bool)
+	var workerErrs []string
+	for received := 0; received < c.params.Workers; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-progressTicker.C:
+			c.printProgress()
+		case <-deadline.C:
+			fmt.Printf("Timed out waiting for results, %d/%d workers reported\n", received, c.params.Workers)
+			received = c.params.Workers
+		case res := <-c.results:
+			received++
+			reported[res.WorkerID] = true
+			fmt.Printf("Received results from %s (%d/%d)\n", res.WorkerID, received, c.params.Workers)
+			if res.Error != "" {
+				workerErrs = append(workerErrs, fmt.Sprintf("%s: %s", res.WorkerID, res.Error))
+			}
+			for _, tester := range res.Testers {
+				stats[tester.Name] = tester.toTesterStats()
+			}
+		}
+	}
+	// workers that did not report their results are counted with the last stats they sent
+	c.lock.Lock()
+	for workerID, res := range c.progress {
+		if reported[workerID] {
+			continue
+		}
+		fmt.Printf("Using the last progress of %s, its results did not arrive\n", workerID)
+		workerErrs = append(workerErrs, fmt.Sprintf("%s: no results, reporting its last progress", workerID))
+		for _, tester := range res.Testers {
+			stats[tester.Name] = tester.toTesterStats()
+		}
+	}
+	c.lock.Unlock()
+	if len(stats) == 0 && len(workerErrs) > 0 {
+		return fmt.Errorf("all workers failed: %s", strings.Join(workerErrs, "; "))
+	}
+	for _, workerErr := range workerErrs {
+		fmt.Println("worker failed", workerErr)
+	}
+
+	runReport := newRunReport("distributed-load-test", c.Params.Room, stats)
+	printRunReport(runReport)
+	if c.Params.SyntheticMedia || c.Params.DataPublishers > 0 {
+		// publishers stamp their clock in the media, which subscribers compare to theirs, maybe on another host
+		fmt.Println("\nLatency compares the clocks of the workers, synchronize them (e.g. with NTP) for accurate results")
+	}
+	runReport.Thresholds = evaluateThresholds(c.Params.Thresholds, runReport.Total)
+	printThresholdResults(runReport.Thresholds)
+
+	if err = c.writeReport(&Report{
+		StartedAt: c.startAt,
+		Seed:      c.Params.Seed,
+		Runs:      []*RunReport{runReport},
+	}); err != nil {
+		return err
+	}
+	return thresholdError([]*RunReport{runReport})
+}
+
+// readRequest decodes the JSON body of a worker request into v, it writes the error response and returns false
+// when the request is not a POST, lacks the token or cannot be decoded
+func (c *Coordinator) readRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if c.params.Token != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.params.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return false
+		}
+	}
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(coordinatorReadBodyTimeout))
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	// registrations wait for the other workers once their body is read
+	_ = rc.SetReadDeadline(time.Time{})
+	return true
+}
+
+func (c *Coordinator) handleRegister(w http.ResponseWriter, r *http.Request) {
+	reg := &workerRegistration{}
+	if !c.readRequest(w, r, reg) {
+		return
+	}
+	if err := checkAcceptableUse(reg.URL, c.Params.VideoPublishers, c.Params.AudioPublishers, c.Params.Subscribers); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	c.lock.Lock()
+	if len(c.registrations) >= c.params.Workers {
+		c.lock.Unlock()
+		http.Error(w, "all workers have already registered", http.StatusConflict)
+		return
+	}
+	c.registrations = append(c.registrations, reg)
+	fmt.Printf("Worker %s registered (%d/%d)\n", reg.Hostname, len(c.registrations), c.params.Workers)
+	if len(c.registrations) == c.params.Workers {
+		c.startAt = time.Now().Add(coordinatorStartDelay)
+		close(c.ready)
+	}
+	c.lock.Unlock()
+
+	// hold the request until every worker has registered
+	select {
+	case <-r.Context().Done():
+		c.unregister(reg)
+		return
+	case <-c.ready:
+	}
+
+	c.lock.Lock()
+	index := slices.Index(c.registrations, reg)
+	c.lock.Unlock()
+	assignment := c.assignment(index)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(assignment)
+}
+
+// unregister frees the slot of a worker that went away while waiting for the others,
+// unless every worker registered already and the test is starting
+func (c *Coordinator) unregister(reg *workerRegistration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.ready:
+		return
+	default:
+	}
+	if i := slices.Index(c.registrations, reg); i >= 0 {
+		c.registrations = slices.Delete(c.registrations, i, i+1)
+		fmt.Printf("Worker %s went away (%d/%d)\n", reg.Hostname, len(c.registrations), c.params.Workers)
+	}
+}
+
+func (c *Coordinator) assignment(i int) *workerAssignment {
+	n := c.params.Workers
+	p := c.Params
+	numPerSecond := p.NumPerSecond / float64(n)
+	if numPerSecond < 0.1 {
+		numPerSecond = 0.1
+	}
+	return &workerAssignment{
+		WorkerID:         fmt.Sprintf("worker-%d", i+1),
+		StartAt:          c.startAt,
+		Room:             p.Room,
+		IdentityPrefix:   fmt.Sprintf("%s_w%d", p.IdentityPrefix, i+1),
+		VideoPublishers:  share(p.VideoPublishers, n, i),
+		AudioPublishers:  share(p.AudioPublishers, n, i),
+		Subscribers:      share(p.Subscribers, n, i),
+		DataPublishers:   share(p.DataPublishers, n, i),
+		Data:             p.Data,
+		ExpectedTracks:   p.publishedTracks(),
+		VideoResolution:  p.VideoResolution,
+		VideoCodec:       p.VideoCodec,
+		PublisherProfile: p.PublisherProfile,
+		Duration:         p.Duration,
+		NumPerSecond:     numPerSecond,
+		Simulcast:        p.Simulcast,
+		SimulateSpeakers: p.SimulateSpeakers,
+		RampDown:         p.RampDown,
+		Layout:           p.Layout,
+		SyntheticMedia:   p.SyntheticMedia,
+		Watermark:        p.Watermark,
+		RequireAudioFEC:  p.RequireAudioFEC,
+		AudioDTX:         p.AudioDTX,
+		Churn:            p.Churn,
+		NetworkProfiles:  p.NetworkProfiles,
+
+		LayoutSwitchInterval: p.LayoutSwitchInterval,
+		Seed:                 p.Seed + int64(i+1),
+	}
+}
+
+func (c *Coordinator) handleProgress(w http.ResponseWriter, r *http.Request) {
+	res := &workerResult{}
+	if !c.readRequest(w, r, res) {
+		return
+	}
+	c.lock.Lock()
+	c.progress[res.WorkerID] = res
+	c.lock.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// printProgress prints the totals of the stats sent by workers while the test runs
+func (c *Coordinator) printProgress() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.progress) == 0 {
+		return
+	}
+	var testers, tracks int
+	var packets, dropped int64
+	for _, res := range c.progress {
+		testers += len(res.Testers)
+		for _, tester := range res.Testers {
+			tracks += len(tester.Tracks)
+			for _, track := range tester.Tracks {
+				packets += track.Packets
+				dropped += track.Dropped
+			}
+		}
+	}
+	fmt.Printf("Progress of %d/%d workers: %d testers, %d tracks, %d packets, %s%% dropped\n",
+		len(c.progress), c.params.Workers, testers, tracks, packets, formatPercentage(dropped, packets+dropped))
+}
+
+func (c *Coordinator) handleResults(w http.ResponseWriter, r *http.Request) {
+	res := &workerResult{}
+	if !c.readRequest(w, r, res) {
+		return
+	}
+	select {
+	case c.results <- res:
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "unexpected results", http.StatusConflict)
+	}
+}
+
+type WorkerParams struct {
+	// base URL of the coordinator, e.g. http://10.0.0.1:7880
+	CoordinatorURL string
+	// token expected by the coordinator, if any
+	Token string
+	// serve Prometheus metrics of this worker's testers on this address when set
+	MetricsAddr string
+	// LiveKit server and credentials used by this worker's testers
+	TesterParams
+}
+
+// Worker runs its share of a load test assigned by a Coordinator
+type Worker struct {
+	params WorkerParams
+	client *http.Client
+}
+
+func NewWorker(params WorkerParams) *Worker {
+	return &Worker{
+		params: params,
+		client: &http.Client{},
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) error {
+	assignment, err := w.register(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered as %s, starting at %s\n", assignment.WorkerID, assignment.StartAt.Format(time.TimeOnly))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(assignment.StartAt)):
+	}
+
+	testerParams := w.params.TesterParams
+	testerParams.Room = assignment.Room
+	testerParams.IdentityPrefix = assignment.IdentityPrefix
+	testerParams.Layout = assignment.Layout
+	testerParams.SyntheticMedia = assignment.SyntheticMedia
+	testerParams.Watermark = assignment.Watermark
+	testerParams.RequireAudioFEC = assignment.RequireAudioFEC
+	testerParams.AudioDTX = assignment.AudioDTX
+	testerParams.LayoutSwitchInterval = assignment.LayoutSwitchInterval
+	test := NewLoadTest(Params{
+		VideoPublishers:  assignment.VideoPublishers,
+		AudioPublishers:  assignment.AudioPublishers,
+		Subscribers:      assignment.Subscribers,
+		DataPublishers:   assignment.DataPublishers,
+		Data:             assignment.Data,
+		ExpectedTracks:   assignment.ExpectedTracks,
+		VideoResolution:  assignment.VideoResolution,
+		VideoCodec:       assignment.VideoCodec,
+		PublisherProfile: assignment.PublisherProfile,
+		Duration:         assignment.Duration,
+		NumPerSecond:     assignment.NumPerSecond,
+		Simulcast:        assignment.Simulcast,
+		SimulateSpeakers: assignment.SimulateSpeakers,
+		RampDown:         assignment.RampDown,
+		Churn:            assignment.Churn,
+		NetworkProfiles:  assignment.NetworkProfiles,
+		Seed:             assignment.Seed,
+		MetricsAddr:      w.params.MetricsAddr,
+		TesterParams:     testerParams,
+	})
+	stopMetrics, err := test.serveMetrics()
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		w.sendProgress(progressCtx, assignment.WorkerID, test)
+	}()
+
+	res := &workerResult{WorkerID: assignment.WorkerID}
+	stats, err := test.run(ctx, test.Params)
+	stopProgress()
+	<-progressDone
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Testers = newWorkerTesters(assignment.WorkerID, stats)
+
+	// results are reported even when the test was canceled
+	reportCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := w.post(reportCtx, coordinatorResultsPath, res, nil); err != nil {
+		return fmt.Errorf("could not report results to coordinator: %w", err)
+	}
+	fmt.Println("Results sent to coordinator")
+	return err
+}
+
+// register retries until the coordinator assigns a share of the test, or ctx is done.
+// The coordinator may not be listening yet, or restart
+func (w *Worker) register(ctx context.Context) (*workerAssignment, error) {
+	hostname, _ := os.Hostname()
+	reg := &workerRegistration{
+		Hostname: hostname,
+		URL:      w.params.URL,
+	}
+	backoff := workerRegisterMinBackoff
+	for {
+		fmt.Printf("Registering with coordinator %s\n", w.params.CoordinatorURL)
+		assignment := &workerAssignment{}
+		err := w.post(ctx, coordinatorRegisterPath, reg, assignment)
+		if err == nil {
+			return assignment, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("could not register with coordinator: %w", err)
+		}
+		fmt.Printf("could not register with coordinator: %v, retrying in %s\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, workerRegisterMaxBackoff)
+	}
+}
+
+// sendProgress sends the stats of the running testers to the coordinator until ctx is done.
+// The coordinator prints them, and keeps the last ones in case the final results do not arrive
+func (w *Worker) sendProgress(ctx context.Context, workerID string, test *LoadTest) {
+	ticker := time.NewTicker(workerProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res := &workerResult{
+			WorkerID: workerID,
+			Testers:  newWorkerTesters(workerID, test.metrics.stats()),
+		}
+		if err := w.post(ctx, coordinatorProgressPath, res, nil); err != nil && ctx.Err() == nil {
+			fmt.Printf("could not send progress to coordinator: %v\n", err)
+		}
+	}
+}
+
+func (w *Worker) post(ctx context.Context, path string, body, response any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(w.params.CoordinatorURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.params.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.params.Token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg := new(bytes.Buffer)
+		_, _ = msg.ReadFrom(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(msg.String()))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
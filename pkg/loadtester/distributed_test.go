@@ -0,0 +1,161 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestShare(t *testing.T) {
+	total := 0
+	for i := 0; i < 3; i++ {
+		total += share(10, 3, i)
+	}
+	require.Equal(t, 10, total)
+	require.Equal(t, 4, share(10, 3, 0))
+	require.Equal(t, 3, share(10, 3, 2))
+	require.Equal(t, 0, share(1, 3, 1))
+}
+
+func TestWorkerResultRoundTrip(t *testing.T) {
+	res := &workerResult{WorkerID: "worker-1"}
+	for name, stats := range newTestStats() {
+		res.Testers = append(res.Testers, newWorkerTesterStats(name+" @worker-1", stats))
+	}
+	data, err := json.Marshal(res)
+	require.NoError(t, err)
+
+	decoded := &workerResult{}
+	require.NoError(t, json.Unmarshal(data, decoded))
+	stats := make(map[string]*testerStats)
+	for _, tester := range decoded.Testers {
+		stats[tester.Name] = tester.toTesterStats()
+	}
+
+	expected := newRunReport("load-test", "room", newTestStats())
+	merged := newRunReport("load-test", "room", stats)
+	require.Len(t, merged.Testers, 2)
+	require.Equal(t, "Sub 0 @worker-1", merged.Testers[0].Name)
+	require.Equal(t, expected.Total.Tracks, merged.Total.Tracks)
+	require.Equal(t, expected.Total.Expected, merged.Total.Expected)
+	require.Equal(t, expected.Total.Packets, merged.Total.Packets)
+	require.Equal(t, expected.Total.Dropped, merged.Total.Dropped)
+	require.Equal(t, expected.Total.Errors, merged.Total.Errors)
+	require.InDelta(t, expected.Total.Bitrate, merged.Total.Bitrate, expected.Total.Bitrate*0.01)
+}
+
+func postJSON(handler http.HandlerFunc, ctx context.Context, path string, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestCoordinatorRegister(t *testing.T) {
+	c := NewCoordinator(Params{}, CoordinatorParams{Workers: 2})
+	reg := &workerRegistration{Hostname: "worker", URL: "ws://localhost:7880"}
+	registered := func() int {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return len(c.registrations)
+	}
+
+	// a worker going away before the others registered frees its slot
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		postJSON(c.handleRegister, ctx, coordinatorRegisterPath, reg)
+	}()
+	require.Eventually(t, func() bool { return registered() == 1 }, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	require.Zero(t, registered())
+
+	recs := make(chan *httptest.ResponseRecorder, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			recs <- postJSON(c.handleRegister, context.Background(), coordinatorRegisterPath, reg)
+		}()
+	}
+	workerIDs := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		rec := <-recs
+		require.Equal(t, http.StatusOK, rec.Code)
+		assignment := &workerAssignment{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), assignment))
+		workerIDs[assignment.WorkerID] = true
+	}
+	require.Len(t, workerIDs, 2)
+
+	rec := postJSON(c.handleRegister, context.Background(), coordinatorRegisterPath, reg)
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestCoordinatorProgress(t *testing.T) {
+	c := NewCoordinator(Params{}, CoordinatorParams{Workers: 2})
+	for i := 0; i < 2; i++ {
+		// the latest progress of a worker replaces the previous one
+		rec := postJSON(c.handleProgress, context.Background(), coordinatorProgressPath, &workerResult{
+			WorkerID: "worker-1",
+			Testers:  newWorkerTesters("worker-1", newTestStats()),
+		})
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	require.Len(t, c.progress, 1)
+	require.Len(t, c.progress["worker-1"].Testers, len(newTestStats()))
+	c.printProgress()
+}
+
+func TestWorkerRegister(t *testing.T) {
+	c := NewCoordinator(Params{}, CoordinatorParams{Workers: 1, Token: "secret"})
+	// the coordinator is not ready for the first attempt
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Inc() == 1 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		c.handleRegister(w, r)
+	}))
+	defer server.Close()
+
+	rec := postJSON(c.handleRegister, context.Background(), coordinatorRegisterPath, &workerRegistration{Hostname: "worker"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code, "no token")
+
+	w := NewWorker(WorkerParams{CoordinatorURL: server.URL, Token: "secret"})
+	assignment, err := w.register(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "worker-1", assignment.WorkerID)
+	require.EqualValues(t, 2, attempts.Load())
+
+	// registration is retried until the context ends
+	w = NewWorker(WorkerParams{CoordinatorURL: server.URL, Token: "wrong"})
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	_, err = w.register(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.EqualValues(t, 4, attempts.Load())
+}
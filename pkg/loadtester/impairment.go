@@ -0,0 +1,452 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/interceptor/pkg/report"
+	"github.com/pion/interceptor/pkg/twcc"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	lkinterceptor "github.com/livekit/mediatransportutil/pkg/interceptor"
+	sdkinterceptor "github.com/livekit/server-sdk-go/v2/pkg/interceptor"
+)
+
+// NetworkProfile describes the impairment applied to a tester's media, in both directions
+type NetworkProfile struct {
+	Name string `yaml:"name"`
+	// percentage (0-100) of packets dropped
+	PacketLoss float64 `yaml:"packet_loss"`
+	// delay added to every packet
+	Latency time.Duration `yaml:"latency"`
+	// maximum random delay added on top of Latency
+	Jitter time.Duration `yaml:"jitter"`
+	// bits per second, packets exceeding it are dropped. Unlimited when 0
+	Bandwidth uint64 `yaml:"bandwidth"`
+}
+
+var builtinNetworkProfiles = map[string]NetworkProfile{
+	"3g": {
+		Name:       "3g",
+		PacketLoss: 1.5,
+		Latency:    150 * time.Millisecond,
+		Jitter:     30 * time.Millisecond,
+		Bandwidth:  1_000_000,
+	},
+	"4g": {
+		Name:       "4g",
+		PacketLoss: 0.5,
+		Latency:    50 * time.Millisecond,
+		Jitter:     10 * time.Millisecond,
+		Bandwidth:  10_000_000,
+	},
+	"lossy": {
+		Name:       "lossy",
+		PacketLoss: 5,
+		Latency:    20 * time.Millisecond,
+		Jitter:     10 * time.Millisecond,
+	},
+}
+
+// NetworkProfileFromString returns a built-in profile (3g, 4g, lossy), or loads a YAML or JSON profile from a file
+func NetworkProfileFromString(str string) (*NetworkProfile, error) {
+	if p, ok := builtinNetworkProfiles[strings.ToLower(str)]; ok {
+		return &p, nil
+	}
+	data, err := os.ReadFile(str)
+	if err != nil {
+		return nil, fmt.Errorf("unknown network profile %q, choose from \"3g\", \"4g\", \"lossy\" or a profile file: %w", str, err)
+	}
+	p, err := ParseNetworkProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network profile %s: %w", str, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(str), filepath.Ext(str))
+	}
+	return p, nil
+}
+
+// NetworkProfilesFromString parses a comma-separated list of profiles
+func NetworkProfilesFromString(str string) ([]*NetworkProfile, error) {
+	var profiles []*NetworkProfile
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := NetworkProfileFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// ParseNetworkProfile parses a YAML or JSON network profile
+func ParseNetworkProfile(data []byte) (*NetworkProfile, error) {
+	p := &NetworkProfile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *NetworkProfile) validate() error {
+	if p.PacketLoss < 0 || p.PacketLoss > 100 {
+		return fmt.Errorf("packet_loss must be between 0 and 100, got %v", p.PacketLoss)
+	}
+	if p.Latency < 0 || p.Jitter < 0 {
+		return fmt.Errorf("latency and jitter cannot be negative")
+	}
+	return nil
+}
+
+func (p *NetworkProfile) String() string {
+	var parts []string
+	if p.Latency > 0 || p.Jitter > 0 {
+		parts = append(parts, fmt.Sprintf("%s±%s", p.Latency, p.Jitter))
+	}
+	if p.PacketLoss > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f%% loss", p.PacketLoss))
+	}
+	if p.Bandwidth > 0 {
+		parts = append(parts, formatBps(float64(p.Bandwidth)))
+	}
+	if len(parts) == 0 {
+		return p.Name
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, strings.Join(parts, ", "))
+}
+
+// interceptors returns the SDK's default interceptors with impairment added closest to the network,
+// since passing interceptors to the SDK replaces its defaults, which it does not export. They are rebuilt here:
+// NACK generator and responder, RTCP reports, TWCC and packet size limit, and XR responses for the server to
+// measure RTT. The SDK's own RTT measurement reports to its engine and cannot be rebuilt, so impaired testers
+// do not know their RTT, and no pacer is used, like the SDK's default.
+// sequence and session tell the links of each tester and session apart, for their random losses and jitter
+func (p *NetworkProfile) interceptors(sequence int, session int64) ([]interceptor.Factory, error) {
+	responder, err := nack.NewResponderInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	receiverReports, err := report.NewReceiverInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	senderReports, err := report.NewSenderInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	twccGenerator, err := twcc.NewSenderInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	return []interceptor.Factory{
+		&impairmentInterceptorFactory{profile: *p, sequence: sequence, session: session},
+		&sdkinterceptor.NackGeneratorInterceptorFactory{},
+		responder,
+		receiverReports,
+		senderReports,
+		twccGenerator,
+		sdkinterceptor.NewLimitSizeInterceptorFactory(),
+		// only answers the server's XR requests, like the SDK's publisher
+		lkinterceptor.NewRTTFromXRFactory(func(uint32) {}),
+	}, nil
+}
+
+type impairmentInterceptorFactory struct {
+	profile  NetworkProfile
+	sequence int
+	session  int64
+	// peer connections created so far, the SDK creates the publisher's before the subscriber's
+	connections atomic.Int64
+}
+
+func (f *impairmentInterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	connection := f.connections.Inc()
+	link := func(direction int64) *impairedLink {
+		return newImpairedLink(f.profile, newRandom(randomNetwork, int64(f.sequence), f.session, connection, direction))
+	}
+	return &impairmentInterceptor{
+		profile:  f.profile,
+		outgoing: link(0),
+		incoming: link(1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// impairmentInterceptor drops, polices and delays RTP in both directions, and outgoing RTCP
+type impairmentInterceptor struct {
+	interceptor.NoOp
+
+	profile   NetworkProfile
+	outgoing  *impairedLink
+	incoming  *impairedLink
+	done      chan struct{}
+	closeOnce sync.Once
+
+	queueOnce sync.Once
+	queue     chan *delayedWrite
+}
+
+type delayedWrite struct {
+	at    time.Time
+	write func()
+}
+
+func (i *impairmentInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attributes interceptor.Attributes) (int, error) {
+		if i.outgoing.drop(0) {
+			return 0, nil
+		}
+		delay := i.outgoing.delay()
+		if delay == 0 {
+			return writer.Write(pkts, attributes)
+		}
+		i.enqueue(delay, func() {
+			_, _ = writer.Write(pkts, attributes)
+		})
+		return 0, nil
+	})
+}
+
+func (i *impairmentInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		size := header.MarshalSize() + len(payload)
+		if i.outgoing.drop(size) {
+			// pretend the packet was sent, it was lost on the way
+			return size, nil
+		}
+		delay := i.outgoing.delay()
+		if delay == 0 {
+			return writer.Write(header, payload, attributes)
+		}
+		// buffers are reused once Write returns
+		h := header.Clone()
+		p := append([]byte{}, payload...)
+		i.enqueue(delay, func() {
+			_, _ = writer.Write(&h, p, attributes)
+		})
+		return size, nil
+	})
+}
+
+func (i *impairmentInterceptor) BindRemoteStream(_ *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	read := func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		for {
+			n, attr, err := reader.Read(b, a)
+			if err != nil || !i.incoming.drop(n) {
+				return n, attr, err
+			}
+		}
+	}
+	if i.profile.Latency == 0 && i.profile.Jitter == 0 {
+		return interceptor.RTPReaderFunc(read)
+	}
+	return newDelayedReader(read, i.incoming, i.done)
+}
+
+func (i *impairmentInterceptor) Close() error {
+	i.closeOnce.Do(func() {
+		close(i.done)
+	})
+	return nil
+}
+
+// enqueue schedules an outgoing write, writes keep their order so jitter never reorders packets
+func (i *impairmentInterceptor) enqueue(delay time.Duration, write func()) {
+	i.queueOnce.Do(func() {
+		i.queue = make(chan *delayedWrite, 1000)
+		go i.processQueue()
+	})
+	select {
+	case i.queue <- &delayedWrite{at: i.outgoing.releaseAt(delay), write: write}:
+	case <-i.done:
+	default:
+		// queue is full, which is what a congested link would do
+	}
+}
+
+func (i *impairmentInterceptor) processQueue() {
+	for {
+		select {
+		case <-i.done:
+			return
+		case w := <-i.queue:
+			if !sleepUntil(w.at, i.done) {
+				return
+			}
+			w.write()
+		}
+	}
+}
+
+// impairedLink keeps the state of one direction of a connection
+type impairedLink struct {
+	profile NetworkProfile
+	random  *rand.Rand
+	// nil when bandwidth is unlimited
+	limiter *rate.Limiter
+
+	lock        sync.Mutex
+	lastRelease time.Time
+}
+
+func newImpairedLink(profile NetworkProfile, random *rand.Rand) *impairedLink {
+	l := &impairedLink{profile: profile, random: random}
+	if profile.Bandwidth > 0 {
+		bytesPerSecond := float64(profile.Bandwidth) / 8
+		// allow bursts of 100ms, at least a full packet
+		burst := int(bytesPerSecond / 10)
+		if burst < 1500 {
+			burst = 1500
+		}
+		l.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+	}
+	return l
+}
+
+// drop returns true when a packet of the given size is lost or exceeds the bandwidth
+func (l *impairedLink) drop(size int) bool {
+	if l.profile.PacketLoss > 0 && l.random.Float64()*100 < l.profile.PacketLoss {
+		return true
+	}
+	if l.limiter != nil && size > 0 && !l.limiter.AllowN(time.Now(), size) {
+		return true
+	}
+	return false
+}
+
+func (l *impairedLink) delay() time.Duration {
+	d := l.profile.Latency
+	if l.profile.Jitter > 0 {
+		d += time.Duration(l.random.Int63n(int64(l.profile.Jitter) + 1))
+	}
+	return d
+}
+
+// releaseAt returns when a packet delayed by d leaves the link, never before the previous one
+func (l *impairedLink) releaseAt(d time.Duration) time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	at := time.Now().Add(d)
+	if at.Before(l.lastRelease) {
+		at = l.lastRelease
+	}
+	l.lastRelease = at
+	return at
+}
+
+type receivedPacket struct {
+	at   time.Time
+	data []byte
+	attr interceptor.Attributes
+	err  error
+}
+
+// delayedReader reads ahead of its consumer to timestamp packets when they arrive,
+// and hands them out once their delay has passed
+type delayedReader struct {
+	read    interceptor.RTPReaderFunc
+	link    *impairedLink
+	done    chan struct{}
+	once    sync.Once
+	packets chan *receivedPacket
+}
+
+func newDelayedReader(read interceptor.RTPReaderFunc, link *impairedLink, done chan struct{}) *delayedReader {
+	return &delayedReader{
+		read:    read,
+		link:    link,
+		done:    done,
+		packets: make(chan *receivedPacket, 1000),
+	}
+}
+
+func (r *delayedReader) Read(b []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
+	r.once.Do(func() {
+		go r.readAhead(len(b))
+	})
+	select {
+	case <-r.done:
+		return 0, nil, fmt.Errorf("interceptor closed")
+	case pkt := <-r.packets:
+		if pkt.err != nil {
+			return 0, nil, pkt.err
+		}
+		if !sleepUntil(pkt.at, r.done) {
+			return 0, nil, fmt.Errorf("interceptor closed")
+		}
+		return copy(b, pkt.data), pkt.attr, nil
+	}
+}
+
+func (r *delayedReader) readAhead(bufSize int) {
+	for {
+		buf := make([]byte, bufSize)
+		n, attr, err := r.read(buf, nil)
+		pkt := &receivedPacket{err: err}
+		if err == nil {
+			pkt.at = r.link.releaseAt(r.link.delay())
+			pkt.data = buf[:n]
+			pkt.attr = attr
+		}
+		select {
+		case r.packets <- pkt:
+		case <-r.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sleepUntil returns false when done is closed before t
+func sleepUntil(t time.Time, done <-chan struct{}) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
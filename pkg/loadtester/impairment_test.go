@@ -0,0 +1,91 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkProfiles(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "satellite.json")
+	require.NoError(t, os.WriteFile(custom, []byte(`{"latency": "600ms", "jitter": "50ms", "packet_loss": 2, "bandwidth": 2000000}`), 0644))
+
+	profiles, err := NetworkProfilesFromString("3g, lossy," + custom)
+	require.NoError(t, err)
+	require.Len(t, profiles, 3)
+	require.Equal(t, "3g", profiles[0].Name)
+	require.Equal(t, 5.0, profiles[1].PacketLoss)
+	require.Equal(t, "satellite", profiles[2].Name)
+	require.Equal(t, 600*time.Millisecond, profiles[2].Latency)
+	require.Equal(t, uint64(2000000), profiles[2].Bandwidth)
+
+	_, err = NetworkProfilesFromString("5g")
+	require.Error(t, err)
+	_, err = ParseNetworkProfile([]byte(`packet_loss: 120`))
+	require.Error(t, err)
+	_, err = ParseNetworkProfile([]byte(`loss: 1`))
+	require.Error(t, err)
+}
+
+func TestImpairedLink(t *testing.T) {
+	lossy := newImpairedLink(NetworkProfile{PacketLoss: 20}, newRandom(randomNetwork))
+	dropped := 0
+	for i := 0; i < 10000; i++ {
+		if lossy.drop(1000) {
+			dropped++
+		}
+	}
+	require.InDelta(t, 2000, dropped, 300)
+
+	// the burst allows 100ms worth of bytes
+	capped := newImpairedLink(NetworkProfile{Bandwidth: 800_000}, newRandom(randomNetwork))
+	sent := 0
+	for i := 0; i < 100; i++ {
+		if !capped.drop(1000) {
+			sent++
+		}
+	}
+	require.InDelta(t, 10, sent, 1)
+
+	jittery := newImpairedLink(NetworkProfile{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond}, newRandom(randomNetwork))
+	last := time.Time{}
+	for i := 0; i < 100; i++ {
+		d := jittery.delay()
+		require.GreaterOrEqual(t, d, 100*time.Millisecond)
+		require.LessOrEqual(t, d, 120*time.Millisecond)
+		at := jittery.releaseAt(d)
+		require.False(t, at.Before(last))
+		last = at
+	}
+}
+
+func TestNetworkProfileReport(t *testing.T) {
+	stats := newTestStats()
+	stats["Sub 0"].networkProfile = "3g"
+	stats["Sub 1"].networkProfile = "lossy"
+
+	r := newRunReport("load-test", "room", stats)
+	require.Len(t, r.Profiles, 2)
+	require.Equal(t, "3g", r.Profiles[0].Name)
+	require.Equal(t, 2, r.Profiles[0].Tracks)
+	require.Equal(t, "lossy", r.Profiles[1].Name)
+	require.Equal(t, int64(1), r.Profiles[1].Errors)
+	require.Equal(t, "3g", r.Testers[0].NetworkProfile)
+}
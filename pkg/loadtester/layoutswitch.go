@@ -0,0 +1,258 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// a track that received no packets for this long after being hidden is considered paused
+const layerPauseGrace = 500 * time.Millisecond
+
+// layoutPhase is a step of the layout cycle subscribers go through when LayoutSwitchInterval is set
+type layoutPhase struct {
+	name    string
+	quality livekit.VideoQuality
+}
+
+// subscribers show all video tracks in a speaker view, then in a grid, then hide them
+var layoutCycle = []layoutPhase{
+	{name: "speaker", quality: livekit.VideoQuality_HIGH},
+	{name: "grid", quality: livekit.VideoQuality_LOW},
+	{name: "hidden", quality: livekit.VideoQuality_OFF},
+}
+
+// layoutPhaseAt returns the phase at t, and when the next phase starts.
+// Phases are aligned to the wall clock, so that testers switch together, including across distributed workers
+func layoutPhaseAt(t time.Time, interval time.Duration) (layoutPhase, time.Time) {
+	n := t.UnixNano() / int64(interval)
+	return layoutCycle[n%int64(len(layoutCycle))], time.Unix(0, (n+1)*int64(interval))
+}
+
+// expectedLayer returns the layer the server should forward for the requested quality,
+// the highest layer that does not exceed it. Nil when the track is hidden
+func expectedLayer(layers []*livekit.VideoLayer, quality livekit.VideoQuality) *livekit.VideoLayer {
+	if quality == livekit.VideoQuality_OFF || len(layers) == 0 {
+		return nil
+	}
+	var expected *livekit.VideoLayer
+	lowest := layers[0]
+	for _, l := range layers {
+		if l.Quality < lowest.Quality {
+			lowest = l
+		}
+		if l.Quality <= quality && (expected == nil || l.Quality > expected.Quality) {
+			expected = l
+		}
+	}
+	if expected == nil {
+		return lowest
+	}
+	return expected
+}
+
+// nearestLayer returns the layer with the bitrate closest to bps
+func nearestLayer(layers []*livekit.VideoLayer, bps float64) *livekit.VideoLayer {
+	var nearest *livekit.VideoLayer
+	distance := math.Inf(1)
+	for _, l := range layers {
+		if l.Bitrate == 0 {
+			continue
+		}
+		if d := math.Abs(math.Log(bps / float64(l.Bitrate))); d < distance {
+			nearest = l
+			distance = d
+		}
+	}
+	return nearest
+}
+
+func qualityName(quality livekit.VideoQuality) string {
+	return strings.ToLower(quality.String())
+}
+
+// layerSwitchStats verifies that the layer received on a video track follows the layout cycle
+type layerSwitchStats struct {
+	lock   sync.Mutex
+	layers []*livekit.VideoLayer
+	// layer expected for the current request, nil when the track is hidden
+	expected    *livekit.VideoLayer
+	requestedAt time.Time
+	switchedAt  time.Time
+	// received since the switch
+	bytes         int64
+	width, height uint32
+	lastPacketAt  time.Time
+
+	// switches that ended, that were completed within their phase, and where the received layer was the expected one
+	requested int64
+	completed int64
+	verified  int64
+	// from the request until the first frame of the new layer, or the last packet when hidden
+	latency latencyStats
+}
+
+// request starts a switch to quality, and ends the previous one
+func (s *layerSwitchStats) request(quality livekit.VideoQuality, layers []*livekit.VideoLayer, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.finishLocked(now)
+	previous := s.expected
+	switched := !s.switchedAt.IsZero()
+	s.layers = layers
+	s.expected = expectedLayer(layers, quality)
+	s.requestedAt = now
+	s.switchedAt = time.Time{}
+	if switched && s.expected != nil && s.expected.Quality == previous.Quality {
+		// already receiving the expected layer, e.g. without simulcast
+		s.switchedAt = now
+	}
+	s.bytes = 0
+	s.width, s.height = 0, 0
+}
+
+func (s *layerSwitchStats) finishLocked(now time.Time) {
+	if s.requestedAt.IsZero() {
+		return
+	}
+	s.requested++
+	if s.expected == nil {
+		if s.lastPacketAt.Before(now.Add(-layerPauseGrace)) {
+			s.completed++
+			s.verified++
+			s.latency.add(max(s.lastPacketAt.Sub(s.requestedAt), 0))
+		}
+		return
+	}
+	if s.switchedAt.IsZero() {
+		return
+	}
+	s.completed++
+	s.latency.add(s.switchedAt.Sub(s.requestedAt))
+	if s.width > 0 {
+		// synthetic samples carry their dimensions
+		if s.width == s.expected.Width && s.height == s.expected.Height {
+			s.verified++
+		}
+	} else if elapsed := now.Sub(s.switchedAt); elapsed > 0 {
+		bps := float64(s.bytes*8) / elapsed.Seconds()
+		if l := nearestLayer(s.layers, bps); l != nil && l.Quality == s.expected.Quality {
+			s.verified++
+		}
+	}
+}
+
+// onFrame records a received frame. Frames of a new layer are recognized by their dimensions when known,
+// otherwise by the keyframe the server starts forwarding the new layer with
+func (s *layerSwitchStats) onFrame(now time.Time, size int, keyframe bool, width, height uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastPacketAt = now
+	if s.expected == nil {
+		return
+	}
+	if s.switchedAt.IsZero() {
+		switch {
+		case width > 0 && width == s.expected.Width && height == s.expected.Height:
+		case width == 0 && keyframe:
+		default:
+			return
+		}
+		s.switchedAt = now
+	}
+	s.bytes += int64(size)
+	if width > 0 {
+		s.width, s.height = width, height
+	}
+}
+
+// counts returns the number of requested, completed and verified switches
+func (s *layerSwitchStats) counts() (int64, int64, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requested, s.completed, s.verified
+}
+
+func (s *layerSwitchStats) toReport() *LayerSwitchReport {
+	requested, completed, verified := s.counts()
+	if requested == 0 {
+		return nil
+	}
+	return &LayerSwitchReport{
+		Requested: requested,
+		Completed: completed,
+		Verified:  verified,
+		Latency:   s.latency.toReport(),
+	}
+}
+
+// cycleLayouts switches the subscribed video tracks through the layout cycle until the session ends
+func (t *LoadTester) cycleLayouts(room *lksdk.Room) {
+	interval := t.params.LayoutSwitchInterval
+	for {
+		_, next := layoutPhaseAt(time.Now(), interval)
+		time.Sleep(time.Until(next))
+		t.lock.Lock()
+		current := t.room
+		var pubs []*lksdk.RemoteTrackPublication
+		for _, p := range t.subscribedParticipants {
+			for _, pub := range p.TrackPublications() {
+				if remotePub, ok := pub.(*lksdk.RemoteTrackPublication); ok && remotePub.Kind() == lksdk.TrackKindVideo && remotePub.IsSubscribed() {
+					pubs = append(pubs, remotePub)
+				}
+			}
+		}
+		t.lock.Unlock()
+		if !t.IsRunning() || current != room {
+			return
+		}
+
+		phase, _ := layoutPhaseAt(next, interval)
+		for _, pub := range pubs {
+			track := pub.TrackRemote()
+			if track == nil {
+				continue
+			}
+			if value, ok := t.stats.Load(track.ID()); ok {
+				value.(*trackStats).layerSwitch.request(phase.quality, pub.TrackInfo().Layers, time.Now())
+			}
+			setVideoQuality(pub, phase.quality)
+		}
+	}
+}
+
+func setVideoQuality(pub *lksdk.RemoteTrackPublication, quality livekit.VideoQuality) {
+	if quality == livekit.VideoQuality_OFF {
+		pub.SetEnabled(false)
+		return
+	}
+	if !pub.IsEnabled() {
+		pub.SetEnabled(true)
+	}
+	switch quality {
+	case livekit.VideoQuality_HIGH:
+		pub.SetVideoDimensions(highWidth, highHeight)
+	case livekit.VideoQuality_MEDIUM:
+		pub.SetVideoDimensions(mediumWidth, mediumHeight)
+	case livekit.VideoQuality_LOW:
+		pub.SetVideoDimensions(lowWidth, lowHeight)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+var testLayers = []*livekit.VideoLayer{
+	{Quality: livekit.VideoQuality_LOW, Width: 320, Height: 180, Bitrate: 150_000},
+	{Quality: livekit.VideoQuality_MEDIUM, Width: 640, Height: 360, Bitrate: 500_000},
+	{Quality: livekit.VideoQuality_HIGH, Width: 1280, Height: 720, Bitrate: 1_500_000},
+}
+
+func TestLayoutPhases(t *testing.T) {
+	interval := 10 * time.Second
+	start := time.Unix(0, 0).Add(30 * interval)
+	phase, next := layoutPhaseAt(start.Add(time.Second), interval)
+	require.Equal(t, "speaker", phase.name)
+	require.Equal(t, start.Add(interval), next)
+
+	phase, _ = layoutPhaseAt(next, interval)
+	require.Equal(t, "grid", phase.name)
+	phase, _ = layoutPhaseAt(next.Add(interval), interval)
+	require.Equal(t, livekit.VideoQuality_OFF, phase.quality)
+
+	require.Equal(t, livekit.VideoQuality_HIGH, expectedLayer(testLayers, livekit.VideoQuality_HIGH).Quality)
+	require.Equal(t, livekit.VideoQuality_HIGH, expectedLayer(testLayers[2:], livekit.VideoQuality_LOW).Quality,
+		"only layer without simulcast")
+	require.Nil(t, expectedLayer(testLayers, livekit.VideoQuality_OFF))
+	require.Equal(t, livekit.VideoQuality_MEDIUM, nearestLayer(testLayers, 420_000).Quality)
+}
+
+func TestLayerSwitchStats(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	s := &layerSwitchStats{}
+	// synthetic samples of the previous layer, then of the requested one
+	s.request(livekit.VideoQuality_LOW, testLayers, at(0))
+	s.onFrame(at(100), 1000, false, 1280, 720)
+	s.onFrame(at(300), 1000, false, 320, 180)
+
+	// keyframe of the new layer, then its bitrate
+	s.request(livekit.VideoQuality_HIGH, testLayers, at(1000))
+	s.onFrame(at(1200), 187_500, true, 0, 0)
+	s.onFrame(at(2000), 0, false, 0, 0)
+
+	// hidden, packets stop
+	s.request(livekit.VideoQuality_OFF, testLayers, at(2000))
+	s.onFrame(at(2100), 1000, false, 0, 0)
+
+	// never switched
+	s.request(livekit.VideoQuality_MEDIUM, testLayers, at(3000))
+	s.request(livekit.VideoQuality_HIGH, testLayers, at(4000))
+
+	r := s.toReport()
+	require.EqualValues(t, 4, r.Requested)
+	require.EqualValues(t, 3, r.Completed)
+	require.EqualValues(t, 3, r.Verified)
+	require.EqualValues(t, 3, r.Latency.Samples)
+	require.Equal(t, 200*time.Millisecond, r.Latency.P50)
+}
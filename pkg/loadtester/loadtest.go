@@ -17,9 +17,7 @@ package loadtester
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"net/url"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,6 +25,7 @@ import (
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
 	"github.com/livekit/livekit-cli/v2/pkg/util"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -38,19 +37,50 @@ type LoadTest struct {
 	Params     Params
 	trackNames map[string]string
 	lock       sync.Mutex
+	metrics    *loadTestMetrics
 }
 
 type Params struct {
 	VideoPublishers int
 	AudioPublishers int
 	Subscribers     int
+	// publishers sending timestamped data packets, received by subscribers
+	DataPublishers  int
+	Data            DataParams
 	VideoResolution string
 	VideoCodec      string
-	Duration        time.Duration
+	// tracks published by each video publisher, a camera track by default
+	PublisherProfile PublisherProfile
+	Duration         time.Duration
 	// number of seconds to spin up per second
 	NumPerSecond     float64
 	Simulcast        bool
 	SimulateSpeakers bool
+	// machine-readable report written to ReportFile at the end of the test
+	ReportFormat ReportFormat
+	ReportFile   string
+	// pass/fail criteria, the test returns ErrThresholdsViolated when any of them fail
+	Thresholds []Threshold
+	// periodically render a live summary of the test while it's running
+	Dashboard bool
+	// period over which testers disconnect at the end of the test, all at once when 0
+	RampDown time.Duration
+	// subscribers leave and rejoin during the test when set
+	Churn ChurnParams
+	// tracks expected by each subscriber, defaults to the number of publishers.
+	// Set when publishers in the room are shared with other tests, e.g. across distributed workers
+	ExpectedTracks int
+	// serve Prometheus metrics of the running testers on this address when set, e.g. :9090
+	MetricsAddr string
+	// network profiles assigned round-robin to subscribers, publishers keep an unimpaired network
+	NetworkProfiles []*NetworkProfile
+	// testers are spread over this many rooms when greater than 1, named after Room.
+	// Publisher counts apply to each room, the other participants of a room subscribe
+	Rooms int
+	// participants per room, between 2 and 10 by default
+	RoomSizes RoomSizes
+	// seeds the random choices of the test, such as room names and media, picked at random when 0
+	Seed int64
 
 	TesterParams
 }
@@ -59,132 +89,423 @@ func NewLoadTest(params Params) *LoadTest {
 	l := &LoadTest{
 		Params:     params,
 		trackNames: make(map[string]string),
+		metrics:    &loadTestMetrics{},
 	}
-	if l.Params.NumPerSecond == 0 {
+	l.Params.setDefaults()
+	l.Params.Seed = SetSeed(l.Params.Seed)
+	return l
+}
+
+// checkVideoCodec verifies that publishers find videos of VideoCodec in their media, before testers start
+func (p *Params) checkVideoCodec() error {
+	switch p.VideoCodec {
+	case "", "h264", "vp8", "vp9", "av1":
+	default:
+		return fmt.Errorf("unsupported video codec %q, expected h264, vp8, vp9 or av1", p.VideoCodec)
+	}
+	if p.Media == nil {
+		if !provider2.EmbeddedMedia().HasVideoCodec(p.VideoCodec) {
+			return fmt.Errorf("%s video requires a media library with %s videos", p.VideoCodec, p.VideoCodec)
+		}
+	} else if !p.Media.HasVideoCodec(p.VideoCodec) {
+		return fmt.Errorf("no %s video in media library", p.VideoCodec)
+	}
+	// watermarks are carried in H.264 SEI
+	if p.Watermark && p.VideoCodec != "" && p.VideoCodec != "h264" {
+		return fmt.Errorf("watermark requires h264 video, not %s", p.VideoCodec)
+	}
+	return nil
+}
+
+func (p *Params) setDefaults() {
+	if p.NumPerSecond == 0 {
 		// sane default
-		l.Params.NumPerSecond = 5
+		p.NumPerSecond = 5
 	}
-	if l.Params.NumPerSecond > 10 {
-		l.Params.NumPerSecond = 10
+	if p.NumPerSecond > 10 {
+		p.NumPerSecond = 10
 	}
-	if l.Params.VideoPublishers == 0 && l.Params.AudioPublishers == 0 && l.Params.Subscribers == 0 {
-		l.Params.VideoPublishers = 1
-		l.Params.Subscribers = 1
+	if p.VideoPublishers == 0 && p.AudioPublishers == 0 && p.Subscribers == 0 && p.DataPublishers == 0 {
+		p.VideoPublishers = 1
+		p.Subscribers = 1
+	}
+	if p.Rooms > 1 && len(p.RoomSizes) == 0 {
+		p.RoomSizes = RoomSizes{{Min: minRoomSize, Max: 10, Weight: 1}}
 	}
-	return l
 }
 
-func (t *LoadTest) Run(ctx context.Context) error {
-	parsedUrl, err := url.Parse(t.Params.URL)
+// publishedTracks returns the number of tracks published by all publishers
+func (p *Params) publishedTracks() int {
+	if p.PublisherProfile == PublisherProfilePresenter {
+		// camera and screen share, video publishers also publish audio
+		return 2*p.VideoPublishers + max(p.VideoPublishers, p.AudioPublishers)
+	}
+	return p.VideoPublishers + p.AudioPublishers
+}
+
+func checkAcceptableUse(serverURL string, videoPublishers, audioPublishers, subscribers int) error {
+	parsedUrl, err := url.Parse(serverURL)
 	if err != nil {
 		return err
 	}
 	if strings.HasSuffix(parsedUrl.Hostname(), ".livekit.cloud") {
-		if t.Params.VideoPublishers > 50 || t.Params.Subscribers > 50 || t.Params.AudioPublishers > 50 {
+		if videoPublishers > 50 || subscribers > 50 || audioPublishers > 50 {
 			return errors.New("Unable to perform load test on LiveKit Cloud. Load testing is prohibited by our acceptable use policy: https://livekit.io/legal/acceptable-use-policy")
 		}
 	}
+	return nil
+}
 
-	stats, err := t.run(ctx, t.Params)
+func (t *LoadTest) Run(ctx context.Context) error {
+	if err := checkAcceptableUse(t.Params.URL, t.Params.VideoPublishers, t.Params.AudioPublishers, t.Params.Subscribers); err != nil {
+		return err
+	}
+	if err := t.Params.checkVideoCodec(); err != nil {
+		return err
+	}
+
+	stopMetrics, err := t.serveMetrics()
 	if err != nil {
 		return err
 	}
+	defer stopMetrics()
 
-	// tester results
-	summaries := make(map[string]*summary)
-	names := make([]string, 0, len(stats))
-	for name := range stats {
-		if strings.HasPrefix(name, "Pub") {
-			continue
-		}
-		names = append(names, name)
+	startedAt := time.Now()
+	params := t.Params
+	params.setDefaultNames()
+	stats, err := t.run(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	runReport := newRunReport("load-test", params.Room, stats)
+	printRunReport(runReport)
+	runReport.Thresholds = evaluateThresholds(t.Params.Thresholds, runReport.Total)
+	printThresholdResults(runReport.Thresholds)
+
+	if err = t.writeReport(&Report{
+		StartedAt: startedAt,
+		Seed:      t.Params.Seed,
+		Runs:      []*RunReport{runReport},
+	}); err != nil {
+		return err
+	}
+	return thresholdError([]*RunReport{runReport})
+}
+
+// serveMetrics serves the metrics of the running testers when MetricsAddr is set
+func (t *LoadTest) serveMetrics() (func(), error) {
+	if t.Params.MetricsAddr == "" {
+		return func() {}, nil
+	}
+	return serveMetrics(t.Params.MetricsAddr, t.metrics.write)
+}
+
+func (t *LoadTest) writeReport(report *Report) error {
+	if t.Params.ReportFormat == ReportFormatNone {
+		return nil
 	}
-	sort.Strings(names)
+	if err := report.WriteFile(t.Params.ReportFile, t.Params.ReportFormat); err != nil {
+		return errors.Wrap(err, "could not write report")
+	}
+	fmt.Printf("\nReport written to %s\n", t.Params.ReportFile)
+	return nil
+}
 
+func printRunReport(r *RunReport) {
+	// latency is only measured with synthetic media
+	showLatency := r.Total.Latency != nil
+
+	// tester results
+	trackHeaders := []string{"Tester", "Track", "Kind", "Source", "Codec", "Pkts.", "Frames (Key)", "Bitrate", "Pkt. Loss"}
+	if showLatency {
+		trackHeaders = append(trackHeaders, "Latency p50/p95/p99")
+	}
 	testerTable := util.CreateTable().
-		Headers("Tester", "Track", "Kind", "Pkts.", "Bitrate", "Pkt. Loss")
-
-	for n, name := range names {
-		testerStats := stats[name]
-		summaries[name] = getTesterSummary(testerStats)
-		trackStatsSlice := make([]*trackStats, 0, len(testerStats.trackStats))
-		for _, ts := range testerStats.trackStats {
-			trackStatsSlice = append(trackStatsSlice, ts)
-		}
-		sort.Slice(trackStatsSlice, func(i, j int) bool {
-			return strings.Compare(
-				string(trackStatsSlice[i].kind),
-				string(trackStatsSlice[j].kind),
-			) < 0
-		})
-		for i, trackStats := range trackStatsSlice {
-			dropped := formatLossRate(
-				trackStats.packets.Load(), trackStats.dropped.Load())
+		Headers(trackHeaders...)
 
+	for n, tester := range r.Testers {
+		for i, trackStats := range tester.TrackStats {
 			trackName := ""
 			if i == 0 {
-				trackName = name
+				trackName = tester.Name
 			}
-			testerTable.Row(
+			row := []string{
 				trackName,
-				trackStats.trackID,
-				string(trackStats.kind),
-				strconv.FormatInt(trackStats.packets.Load(), 10),
-				formatBitrate(
-					trackStats.bytes.Load(),
-					time.Since(trackStats.startedAt.Load()),
-				),
-				dropped,
-			)
+				trackStats.TrackID,
+				trackStats.Kind,
+				trackStats.Source,
+				trackStats.Codec,
+				strconv.FormatInt(trackStats.Packets, 10),
+				fmt.Sprintf("%d (%d)", trackStats.Frames, trackStats.Keyframes),
+				formatBitrate(trackStats.Bytes, trackStats.Elapsed),
+				formatLossRate(trackStats.Packets, trackStats.Dropped),
+			}
+			if showLatency {
+				row = append(row, formatLatency(trackStats.Latency))
+			}
+			testerTable.Row(row...)
 		}
-		if n != len(names)-1 {
-			testerTable.Row("", "", "", "", "", "")
+		if n != len(r.Testers)-1 {
+			testerTable.Row(make([]string, len(trackHeaders))...)
 		}
-
 	}
 
-	if len(names) > 0 {
-		fmt.Println("\nTrack loading:")
-		fmt.Println(testerTable)
-	}
-
-	if len(summaries) == 0 {
-		return nil
+	if len(r.Testers) == 0 {
+		return
 	}
+	fmt.Println("\nTrack loading:")
+	fmt.Println(testerTable)
 
 	// tester summary
+	summaryHeaders := []string{"Tester", "Tracks", "Bitrate", "Total Pkt. Loss", "Error"}
+	if showLatency {
+		summaryHeaders = append(summaryHeaders, "Latency p50/p95/p99")
+	}
 	summaryTable := util.CreateTable().
-		Headers("Tester", "Tracks", "Bitrate", "Total Pkt. Loss", "Error").
+		Headers(summaryHeaders...).
 		StyleFunc(func(row, col int) lipgloss.Style {
 			if row == table.HeaderRow {
 				return util.FormHeaderStyle
 			}
-			if row == len(names) {
+			if row == len(r.Testers) {
 				return util.FormBaseStyle.Bold(true).Reverse(true)
 			}
 			return util.FormBaseStyle
 		})
-	for _, name := range names {
-		s := summaries[name]
-		sDropped := formatLossRate(s.packets, s.dropped)
-		sBitrate := formatBitrate(s.bytes, s.elapsed)
-		summaryTable.Row(name, fmt.Sprintf("%d/%d", s.tracks, s.expected), sBitrate, sDropped, s.errString)
+	for _, tester := range r.Testers {
+		errString := tester.Error
+		if errString == "" {
+			errString = "-"
+		}
+		row := []string{
+			tester.Name,
+			fmt.Sprintf("%d/%d", tester.Tracks, tester.Expected),
+			formatBitrate(tester.Bytes, tester.Elapsed),
+			formatLossRate(tester.Packets, tester.Dropped),
+			errString,
+		}
+		if showLatency {
+			row = append(row, formatLatency(tester.Latency))
+		}
+		summaryTable.Row(row...)
 	}
 	{
 		// totals row
-		s := getTestSummary(summaries)
-		sDropped := formatLossRate(s.packets, s.dropped)
+		s := r.Total
 		// avg bitrate per sub
 		sBitrate := fmt.Sprintf("%s (%s avg)",
-			formatBitrate(s.bytes, s.elapsed),
-			formatBitrate(s.bytes/int64(len(summaries)), s.elapsed),
+			formatBitrate(s.Bytes, s.Elapsed),
+			formatBitrate(s.Bytes/int64(len(r.Testers)), s.Elapsed),
 		)
-		summaryTable.Row("Total", fmt.Sprintf("%d/%d", s.tracks, s.expected), sBitrate, sDropped, string(s.errCount))
+		row := []string{
+			"Total",
+			fmt.Sprintf("%d/%d", s.Tracks, s.Expected),
+			sBitrate,
+			formatLossRate(s.Packets, s.Dropped),
+			strconv.FormatInt(s.Errors, 10),
+		}
+		if showLatency {
+			row = append(row, formatLatency(s.Latency))
+		}
+		summaryTable.Row(row...)
 	}
 	fmt.Println("\nSubscriber summaries:")
 	fmt.Println(summaryTable)
 
-	return nil
+	if len(r.Sources) > 1 {
+		sourceHeaders := []string{"Source", "Tracks", "Bitrate", "Total Pkt. Loss"}
+		if showLatency {
+			sourceHeaders = append(sourceHeaders, "Latency p50/p95/p99")
+		}
+		sourceTable := util.CreateTable().
+			Headers(sourceHeaders...)
+		for _, s := range r.Sources {
+			row := []string{
+				s.Source,
+				strconv.Itoa(s.Tracks),
+				formatBps(s.Bitrate),
+				formatLossRate(s.Packets, s.Dropped),
+			}
+			if showLatency {
+				row = append(row, formatLatency(s.Latency))
+			}
+			sourceTable.Row(row...)
+		}
+		fmt.Println("\nTrack sources:")
+		fmt.Println(sourceTable)
+	}
+
+	if len(r.Profiles) > 0 {
+		profileHeaders := []string{"Network Profile", "Tracks", "Bitrate", "Total Pkt. Loss", "Errors"}
+		if showLatency {
+			profileHeaders = append(profileHeaders, "Latency p50/p95/p99")
+		}
+		profileTable := util.CreateTable().
+			Headers(profileHeaders...)
+		for _, p := range r.Profiles {
+			row := []string{
+				p.Name,
+				fmt.Sprintf("%d/%d", p.Tracks, p.Expected),
+				formatBitrate(p.Bytes, p.Elapsed),
+				formatLossRate(p.Packets, p.Dropped),
+				strconv.FormatInt(p.Errors, 10),
+			}
+			if showLatency {
+				row = append(row, formatLatency(p.Latency))
+			}
+			profileTable.Row(row...)
+		}
+		fmt.Println("\nNetwork profiles:")
+		fmt.Println(profileTable)
+	}
+
+	if len(r.RoomSizes) > 0 {
+		sizeHeaders := []string{"Participants", "Rooms", "Tracks", "Bitrate", "Total Pkt. Loss", "Errors"}
+		if showLatency {
+			sizeHeaders = append(sizeHeaders, "Latency p50/p95/p99")
+		}
+		sizeTable := util.CreateTable().
+			Headers(sizeHeaders...)
+		for _, s := range r.RoomSizes {
+			row := []string{
+				strconv.Itoa(s.Participants),
+				strconv.Itoa(s.Rooms),
+				fmt.Sprintf("%d/%d", s.Tracks, s.Expected),
+				formatBitrate(s.Bytes, s.Elapsed),
+				formatLossRate(s.Packets, s.Dropped),
+				strconv.FormatInt(s.Errors, 10),
+			}
+			if showLatency {
+				row = append(row, formatLatency(s.Latency))
+			}
+			sizeTable.Row(row...)
+		}
+		fmt.Println("\nRoom sizes:")
+		fmt.Println(sizeTable)
+
+		rooms := r.Rooms
+		title := "Rooms:"
+		if len(rooms) > maxListedRooms {
+			rooms = worstRooms(rooms, maxListedRooms)
+			title = fmt.Sprintf("Rooms with the most errors and packet loss (%d of %d):", len(rooms), len(r.Rooms))
+		}
+		roomTable := util.CreateTable().
+			Headers("Room", "Participants", "Tracks", "Bitrate", "Total Pkt. Loss", "Errors")
+		for _, room := range rooms {
+			roomTable.Row(
+				room.Name,
+				strconv.Itoa(room.Participants),
+				fmt.Sprintf("%d/%d", room.Tracks, room.Expected),
+				formatBitrate(room.Bytes, room.Elapsed),
+				formatLossRate(room.Packets, room.Dropped),
+				strconv.FormatInt(room.Errors, 10),
+			)
+		}
+		fmt.Println("\n" + title)
+		fmt.Println(roomTable)
+	}
+
+	if len(r.Data) > 0 {
+		dataTable := util.CreateTable().
+			Headers("Topic", "Kind", "Sent", "Received", "Delivery", "Out of Order", "Latency p50/p95/p99")
+		for _, d := range r.Data {
+			kind := "lossy"
+			if d.Reliable {
+				kind = "reliable"
+			}
+			dataTable.Row(
+				d.Topic,
+				kind,
+				strconv.FormatInt(d.Sent, 10),
+				fmt.Sprintf("%d/%d", d.Received, d.Expected),
+				fmt.Sprintf("%.2f%%", d.Delivery),
+				strconv.FormatInt(d.OutOfOrder, 10),
+				formatLatency(d.Latency),
+			)
+		}
+		fmt.Println("\nData packets:")
+		fmt.Println(dataTable)
+	}
+
+	if ls := r.Total.LayerSwitches; ls != nil {
+		switchTable := util.CreateTable().
+			Headers("Requested", "Completed", "Verified", "Latency p50/p95/p99").
+			Row(
+				strconv.FormatInt(ls.Requested, 10),
+				fmt.Sprintf("%d (%s%%)", ls.Completed, formatPercentage(ls.Completed, ls.Requested)),
+				fmt.Sprintf("%d (%s%%)", ls.Verified, formatPercentage(ls.Verified, ls.Requested)),
+				formatLatency(ls.Latency),
+			)
+		fmt.Println("\nLayer switches:")
+		fmt.Println(switchTable)
+	}
+
+	if fs := r.Total.FrameSequence; fs != nil {
+		sequenceTable := util.CreateTable().
+			Headers("Frames", "Duplicated", "Skipped", "Reordered", "Freezes", "Freeze Duration", "Longest Freeze").
+			Row(
+				strconv.FormatInt(fs.Frames, 10),
+				strconv.FormatInt(fs.Duplicated, 10),
+				strconv.FormatInt(fs.Skipped, 10),
+				strconv.FormatInt(fs.Reordered, 10),
+				strconv.FormatInt(fs.Freezes, 10),
+				fs.FreezeDuration.Round(time.Millisecond).String(),
+				fs.MaxFreeze.Round(time.Millisecond).String(),
+			)
+		fmt.Println("\nWatermarked frames:")
+		fmt.Println(sequenceTable)
+	}
+
+	if af := r.Total.AudioFrames; af != nil && (af.Lost > 0 || af.FEC > 0) {
+		audioTable := util.CreateTable().
+			Headers("Frames", "With FEC", "Lost", "Recovered").
+			Row(
+				strconv.FormatInt(af.Frames, 10),
+				fmt.Sprintf("%d (%s%%)", af.FEC, formatPercentage(af.FEC, af.Frames)),
+				fmt.Sprintf("%d (%s%%)", af.Lost, formatPercentage(af.Lost, af.Frames+af.Lost)),
+				fmt.Sprintf("%d (%s%%)", af.Recovered, formatPercentage(af.Recovered, af.Lost)),
+			)
+		fmt.Println("\nAudio frames:")
+		fmt.Println(audioTable)
+	}
+
+	if r.Connections != nil {
+		totalRow := len(r.Publishers) + len(r.Testers)
+		connectionTable := util.CreateTable().
+			Headers("Tester", "Joins", "Failed Joins", "Retries", "Reconnects", "Join Latency p50/p95/p99",
+				"First Track p50/p95/p99", "First Keyframe p50/p95/p99").
+			StyleFunc(func(row, col int) lipgloss.Style {
+				if row == table.HeaderRow {
+					return util.FormHeaderStyle
+				}
+				if row == totalRow {
+					return util.FormBaseStyle.Bold(true).Reverse(true)
+				}
+				return util.FormBaseStyle
+			})
+		addRow := func(name string, c *ConnectionReport) {
+			connectionTable.Row(
+				name,
+				strconv.FormatInt(c.Joins, 10),
+				strconv.FormatInt(c.FailedJoins, 10),
+				strconv.FormatInt(c.JoinRetries, 10),
+				strconv.FormatInt(c.Reconnects, 10),
+				formatLatency(c.JoinLatency),
+				formatLatency(c.TimeToFirstTrack),
+				formatLatency(c.TimeToFirstKeyframe),
+			)
+		}
+		for _, p := range r.Publishers {
+			addRow(p.Name, &p.ConnectionReport)
+		}
+		for _, tester := range r.Testers {
+			addRow(tester.Name, &tester.ConnectionReport)
+		}
+		addRow("Total", r.Connections)
+		fmt.Println("\nConnections:")
+		fmt.Println(connectionTable)
+	}
 }
 
 func (t *LoadTest) RunSuite(ctx context.Context) error {
@@ -211,9 +532,19 @@ func (t *LoadTest) RunSuite(ctx context.Context) error {
 		{publishers: 1, subscribers: 1000, video: true},
 	}
 
+	stopMetrics, err := t.serveMetrics()
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
 	table := util.CreateTable().
-		Headers("Pubs", "Subs", "Tracks", "Audio", "Video", "Pkt. Loss", "Errors")
+		Headers("Pubs", "Subs", "Tracks", "Audio", "Video", "Pkt. Loss", "Errors", "Thresholds")
 	showTrackStats := false
+	report := &Report{
+		StartedAt: time.Now(),
+		Seed:      t.Params.Seed,
+	}
 
 	for _, c := range cases {
 		caseParams := t.Params
@@ -229,6 +560,7 @@ func (t *LoadTest) RunSuite(ctx context.Context) error {
 		if caseParams.Duration == 0 {
 			caseParams.Duration = 15 * time.Second
 		}
+		caseParams.setDefaultNames()
 		fmt.Printf("\nRunning test: %d pub, %d sub, video: %s\n", c.publishers, c.subscribers, videoString)
 
 		stats, err := t.run(ctx, caseParams)
@@ -238,6 +570,12 @@ func (t *LoadTest) RunSuite(ctx context.Context) error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
+		runReport := newRunReport(
+			fmt.Sprintf("%dpub-%dsub-video-%s", c.publishers, c.subscribers, strings.ToLower(videoString)),
+			caseParams.Room, stats,
+		)
+		runReport.Thresholds = evaluateThresholds(t.Params.Thresholds, runReport.Total)
+		report.Runs = append(report.Runs, runReport)
 
 		var tracks, packets, dropped, errCount int64
 		for _, testerStats := range stats {
@@ -260,6 +598,7 @@ func (t *LoadTest) RunSuite(ctx context.Context) error {
 				videoString,
 				formatLossRate(packets, dropped),
 				strconv.FormatInt(errCount, 10),
+				formatThresholdResult(runReport),
 			)
 		}
 	}
@@ -268,115 +607,213 @@ func (t *LoadTest) RunSuite(ctx context.Context) error {
 		fmt.Println("\nSuite results:")
 		fmt.Println(table)
 	}
-	return nil
+	if err := t.writeReport(report); err != nil {
+		return err
+	}
+	return thresholdError(report.Runs)
 }
 
-func (t *LoadTest) run(ctx context.Context, params Params) (map[string]*testerStats, error) {
-	if params.Room == "" {
-		params.Room = fmt.Sprintf("testroom%d", rand.Int31n(1000))
+func (p *Params) setDefaultNames() {
+	if p.Room == "" {
+		p.Room = fmt.Sprintf("testroom%d", random.Int31n(1000))
 	}
-	if params.IdentityPrefix == "" {
-		params.IdentityPrefix = randStringRunes(5)
+	if p.IdentityPrefix == "" {
+		p.IdentityPrefix = randStringRunes(5)
 	}
+}
 
-	expectedTracks := params.VideoPublishers + params.AudioPublishers
+func (t *LoadTest) run(ctx context.Context, params Params) (map[string]*testerStats, error) {
+	params.setDefaultNames()
+	rooms := params.rooms()
+	multiRoom := len(rooms) > 1
 
 	var participantStrings []string
 	if params.VideoPublishers > 0 {
-		participantStrings = append(participantStrings, fmt.Sprintf("%d video publishers", params.VideoPublishers))
+		videoString := fmt.Sprintf("%d video publishers", params.VideoPublishers)
+		if params.PublisherProfile != "" && params.PublisherProfile != PublisherProfileCamera {
+			videoString += fmt.Sprintf(" (%s)", params.PublisherProfile)
+		}
+		participantStrings = append(participantStrings, videoString)
 	}
 	if params.AudioPublishers > 0 {
 		participantStrings = append(participantStrings, fmt.Sprintf("%d audio publishers", params.AudioPublishers))
 	}
-	if params.Subscribers > 0 {
-		participantStrings = append(participantStrings, fmt.Sprintf("%d subscribers", params.Subscribers))
+	if params.DataPublishers > 0 {
+		participantStrings = append(participantStrings, fmt.Sprintf("%d data publishers", params.DataPublishers))
+	}
+	roomLabel := params.Room
+	if multiRoom {
+		var video, audio, subscribers int
+		for _, room := range rooms {
+			video += room.VideoPublishers
+			audio += room.AudioPublishers
+			subscribers += room.Subscribers
+		}
+		if err := checkAcceptableUse(params.URL, video, audio, subscribers); err != nil {
+			return nil, err
+		}
+		roomLabel = params.Room + "-*"
+		fmt.Printf("Starting load test in %d rooms of %s participants, with %s per room and %d subscribers, rooms: %s\n",
+			len(rooms), params.RoomSizes.String(), strings.Join(participantStrings, ", "), subscribers, roomLabel)
+	} else {
+		if params.Subscribers > 0 {
+			participantStrings = append(participantStrings, fmt.Sprintf("%d subscribers", params.Subscribers))
+		}
+		fmt.Printf("Starting load test with %s, room: %s\n",
+			strings.Join(participantStrings, ", "), params.Room)
+	}
+	if len(params.NetworkProfiles) > 0 {
+		profileStrings := make([]string, 0, len(params.NetworkProfiles))
+		for _, p := range params.NetworkProfiles {
+			profileStrings = append(profileStrings, p.String())
+		}
+		fmt.Printf("Subscriber network profiles: %s\n", strings.Join(profileStrings, ", "))
+	}
+	if params.LayoutSwitchInterval > 0 {
+		fmt.Printf("Switching subscriber layouts every %s\n", params.LayoutSwitchInterval.String())
 	}
-	fmt.Printf("Starting load test with %s, room: %s\n",
-		strings.Join(participantStrings, ", "), params.Room)
+	fmt.Printf("Random seed: %d, replay with --seed %d\n", params.Seed, params.Seed)
 
-	var publishers, testers []*LoadTester
+	var testers, subscribers []*LoadTester
+	// publishers of each room
+	var roomPublishers [][]*LoadTester
+	t.metrics.startRun(roomLabel)
 	group, _ := errgroup.WithContext(ctx)
 	errs := syncmap.Map{}
-	maxPublishers := params.VideoPublishers
-	if params.AudioPublishers > maxPublishers {
-		maxPublishers = params.AudioPublishers
+	var dash *dashboard
+	stopDashboard := func() {}
+	if params.Dashboard {
+		dash = newDashboard(roomLabel)
+		stopDashboard = dash.start(ctx)
+		defer stopDashboard()
+	}
+	storeErr := func(name string, err error) {
+		errs.Store(name, err)
+		if dash != nil {
+			dash.logError(name, err)
+		}
 	}
 
 	// throttle pace of join events
 	limiter := rate.NewLimiter(rate.Limit(params.NumPerSecond), 1)
-	for i := 0; i < maxPublishers+params.Subscribers; i++ {
-		testerParams := params.TesterParams
-		testerParams.Sequence = i
-		testerParams.expectedTracks = expectedTracks
-		isVideoPublisher := i < params.VideoPublishers
-		isAudioPublisher := i < params.AudioPublishers
-		if isVideoPublisher || isAudioPublisher {
-			// publishers would not get their own tracks
-			testerParams.expectedTracks = 0
-			testerParams.IdentityPrefix += "_pub"
-			testerParams.name = fmt.Sprintf("Pub %d", i)
-		} else {
-			testerParams.Subscribe = true
-			testerParams.name = fmt.Sprintf("Sub %d", i-params.VideoPublishers)
-		}
-
-		tester := NewLoadTester(testerParams)
-		testers = append(testers, tester)
-		if isVideoPublisher || isAudioPublisher {
-			publishers = append(publishers, tester)
+	// sequence of testers across rooms, and video publishers so far, subscribers are numbered after them
+	var sequence, videoPublishers int
+	for _, room := range rooms {
+		expectedTracks := room.publishedTracks()
+		if room.ExpectedTracks > 0 {
+			expectedTracks = room.ExpectedTracks
 		}
+		maxPublishers := max(room.VideoPublishers, room.AudioPublishers, room.DataPublishers)
+
+		var publishers []*LoadTester
+		for i := 0; i < maxPublishers+room.Subscribers; i++ {
+			testerParams := room.TesterParams
+			testerParams.Sequence = sequence
+			testerParams.expectedTracks = expectedTracks
+			isVideoPublisher := i < room.VideoPublishers
+			isAudioPublisher := i < room.AudioPublishers
+			isDataPublisher := i < room.DataPublishers
+			if isVideoPublisher {
+				videoPublishers++
+			}
+			if isVideoPublisher || isAudioPublisher || isDataPublisher {
+				// publishers would not get their own tracks
+				testerParams.expectedTracks = 0
+				testerParams.IdentityPrefix += "_pub"
+				testerParams.name = fmt.Sprintf("Pub %d", sequence)
+			} else {
+				testerParams.Subscribe = true
+				testerParams.name = fmt.Sprintf("Sub %d", sequence-videoPublishers)
+				if len(params.NetworkProfiles) > 0 {
+					testerParams.NetworkProfile = params.NetworkProfiles[len(subscribers)%len(params.NetworkProfiles)]
+				}
+			}
+			sequence++
 
-		group.Go(func() error {
-			if err := tester.Start(); err != nil {
-				fmt.Println(errors.Wrapf(err, "could not connect %s", testerParams.name))
-				errs.Store(testerParams.name, err)
-				return nil
+			tester := NewLoadTester(testerParams)
+			testers = append(testers, tester)
+			t.metrics.addTester(tester)
+			if dash != nil {
+				dash.addTester(tester)
+			}
+			if isVideoPublisher || isAudioPublisher {
+				publishers = append(publishers, tester)
+			} else if testerParams.Subscribe {
+				subscribers = append(subscribers, tester)
 			}
 
-			if isAudioPublisher {
-				audio, err := tester.PublishAudioTrack("audio")
-				if err != nil {
-					errs.Store(testerParams.name, err)
+			group.Go(func() error {
+				if err := tester.Start(); err != nil {
+					fmt.Println(errors.Wrapf(err, "could not connect %s", testerParams.name))
+					storeErr(testerParams.name, err)
 					return nil
 				}
-				t.lock.Lock()
-				t.trackNames[audio] = fmt.Sprintf("%dA", testerParams.Sequence)
-				t.lock.Unlock()
-			}
-			if isVideoPublisher {
-				var video string
-				var err error
-				if params.Simulcast {
-					video, err = tester.PublishSimulcastTrack("video-simulcast", params.VideoResolution, params.VideoCodec)
-				} else {
-					video, err = tester.PublishVideoTrack("video", params.VideoResolution, params.VideoCodec)
+
+				if isAudioPublisher || isVideoPublisher && params.PublisherProfile.publishesMicrophone() {
+					audio, err := tester.PublishAudioTrack("audio")
+					if err != nil {
+						storeErr(testerParams.name, err)
+						return nil
+					}
+					t.lock.Lock()
+					t.trackNames[audio] = fmt.Sprintf("%dA", testerParams.Sequence)
+					t.lock.Unlock()
 				}
-				if err != nil {
-					errs.Store(testerParams.name, err)
-					return nil
+				if isVideoPublisher && params.PublisherProfile.publishesCamera() {
+					var video string
+					var err error
+					if params.Simulcast {
+						video, err = tester.PublishSimulcastTrack("video-simulcast", params.VideoResolution, params.VideoCodec)
+					} else {
+						video, err = tester.PublishVideoTrack("video", params.VideoResolution, params.VideoCodec)
+					}
+					if err != nil {
+						storeErr(testerParams.name, err)
+						return nil
+					}
+					t.lock.Lock()
+					t.trackNames[video] = fmt.Sprintf("%dV", testerParams.Sequence)
+					t.lock.Unlock()
+				}
+				if isVideoPublisher && params.PublisherProfile.publishesScreenShare() {
+					screen, err := tester.PublishScreenShareTrack("screen-share", params.VideoCodec)
+					if err != nil {
+						storeErr(testerParams.name, err)
+						return nil
+					}
+					t.lock.Lock()
+					t.trackNames[screen] = fmt.Sprintf("%dS", testerParams.Sequence)
+					t.lock.Unlock()
+				}
+				if isDataPublisher {
+					tester.PublishData(params.Data)
 				}
-				t.lock.Lock()
-				t.trackNames[video] = fmt.Sprintf("%dV", testerParams.Sequence)
-				t.lock.Unlock()
+				return nil
+			})
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
 			}
-			return nil
-		})
 
-		if err := ctx.Err(); err != nil {
-			return nil, err
+			if err := limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
 		}
-
-		if err := limiter.Wait(ctx); err != nil {
-			return nil, err
+		if len(publishers) > 0 {
+			roomPublishers = append(roomPublishers, publishers)
 		}
 	}
 
-	var speakerSim *SpeakerSimulator
-	if len(publishers) > 0 && t.Params.SimulateSpeakers {
-		speakerSim = NewSpeakerSimulator(SpeakerSimulatorParams{
-			Testers: publishers,
-		})
-		speakerSim.Start()
+	// speakers change within each room
+	var speakerSims []*SpeakerSimulator
+	if t.Params.SimulateSpeakers {
+		for _, publishers := range roomPublishers {
+			speakerSim := NewSpeakerSimulator(SpeakerSimulatorParams{
+				Testers: publishers,
+			})
+			speakerSim.Start()
+			speakerSims = append(speakerSims, speakerSim)
+		}
 	}
 	if err := group.Wait(); err != nil {
 		return nil, err
@@ -387,7 +824,25 @@ func (t *LoadTest) run(ctx context.Context, params Params) (map[string]*testerSt
 		// a really long time
 		duration = 1000 * time.Hour
 	}
-	fmt.Printf("Finished connecting to room, waiting %s\n", duration.String())
+	if multiRoom {
+		fmt.Printf("Finished connecting to %d rooms, waiting %s\n", len(rooms), duration.String())
+	} else {
+		fmt.Printf("Finished connecting to room, waiting %s\n", duration.String())
+	}
+
+	churnCtx, stopChurn := context.WithCancel(ctx)
+	var churnWG sync.WaitGroup
+	if params.Churn.Enabled() {
+		churnLimiter := rate.NewLimiter(rate.Limit(params.Churn.rate(params.NumPerSecond)), 1)
+		for _, tester := range subscribers {
+			churnWG.Add(1)
+			r := newRandom(randomChurn, int64(tester.params.Sequence))
+			go func() {
+				defer churnWG.Done()
+				params.Churn.run(churnCtx, tester, churnLimiter, r)
+			}()
+		}
+	}
 
 	select {
 	case <-ctx.Done():
@@ -395,18 +850,35 @@ func (t *LoadTest) run(ctx context.Context, params Params) (map[string]*testerSt
 	case <-time.After(duration):
 		// finished
 	}
+	stopChurn()
+	churnWG.Wait()
+	stopDashboard()
 
-	if speakerSim != nil {
+	for _, speakerSim := range speakerSims {
 		speakerSim.Stop()
 	}
 
+	var rampDownInterval time.Duration
+	if params.RampDown > 0 && len(testers) > 1 && ctx.Err() == nil {
+		fmt.Printf("Disconnecting testers over %s\n", params.RampDown.String())
+		rampDownInterval = params.RampDown / time.Duration(len(testers)-1)
+	}
 	stats := make(map[string]*testerStats)
-	for _, t := range testers {
+	// subscribers are stopped before publishers
+	for i := len(testers) - 1; i >= 0; i-- {
+		t := testers[i]
 		t.Stop()
 		stats[t.params.name] = t.getStats()
 		if e, _ := errs.Load(t.params.name); e != nil {
 			stats[t.params.name].err = e.(error)
 		}
+		if rampDownInterval > 0 && i > 0 {
+			select {
+			case <-ctx.Done():
+				rampDownInterval = 0
+			case <-time.After(rampDownInterval):
+			}
+		}
 	}
 
 	return stats, nil
@@ -15,12 +15,13 @@
 package loadtester
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pion/rtp"
-	"github.com/pion/rtp/codecs"
 	"github.com/pion/webrtc/v4"
 	"go.uber.org/atomic"
 
@@ -41,6 +42,26 @@ type LoadTester struct {
 	trackQualities map[string]livekit.VideoQuality
 
 	stats *sync.Map
+	// topic => *dataTopicStats
+	dataStats *sync.Map
+	// connection stats, accumulated across restarts
+	joins       atomic.Int64
+	failedJoins atomic.Int64
+	reconnects  atomic.Int64
+	joinRetries atomic.Int64
+	joinLatency latencyStats
+	// time from the first join attempt until the first subscribed track, and the first video keyframe
+	firstTrack    latencyStats
+	firstKeyframe latencyStats
+	// tracks that could not be subscribed
+	subscriptionFailures atomic.Int64
+	// time spent connected, across restarts
+	connected sessionTime
+
+	// current session
+	sessionStart     atomic.Time
+	sawFirstTrack    atomic.Bool
+	sawFirstKeyframe atomic.Bool
 }
 
 type Layout string
@@ -74,6 +95,45 @@ func LayoutFromString(str string) Layout {
 	return LayoutSpeaker
 }
 
+// PublisherProfile sets the tracks published by each video publisher
+type PublisherProfile string
+
+const (
+	// PublisherProfileCamera - a camera track
+	PublisherProfileCamera PublisherProfile = "camera"
+	// PublisherProfilePresenter - camera, microphone and screen share tracks, like a webinar presenter
+	PublisherProfilePresenter PublisherProfile = "presenter"
+	// PublisherProfileScreenShare - a screen share track instead of a camera
+	PublisherProfileScreenShare PublisherProfile = "screen"
+
+	// screen shares are published at a high resolution and a low frame rate
+	screenShareFps = 5
+)
+
+func PublisherProfileFromString(str string) (PublisherProfile, error) {
+	switch strings.ToLower(str) {
+	case "", string(PublisherProfileCamera):
+		return PublisherProfileCamera, nil
+	case string(PublisherProfilePresenter):
+		return PublisherProfilePresenter, nil
+	case string(PublisherProfileScreenShare), "screenshare":
+		return PublisherProfileScreenShare, nil
+	}
+	return PublisherProfileCamera, fmt.Errorf("unsupported publisher profile %q, choose from \"camera\", \"presenter\", \"screen\"", str)
+}
+
+func (p PublisherProfile) publishesCamera() bool {
+	return p != PublisherProfileScreenShare
+}
+
+func (p PublisherProfile) publishesScreenShare() bool {
+	return p == PublisherProfilePresenter || p == PublisherProfileScreenShare
+}
+
+func (p PublisherProfile) publishesMicrophone() bool {
+	return p == PublisherProfilePresenter
+}
+
 type TesterParams struct {
 	URL            string
 	APIKey         string
@@ -83,6 +143,23 @@ type TesterParams struct {
 	Layout         Layout
 	// true to subscribe to all published tracks
 	Subscribe bool
+	// publish timestamped synthetic media instead of looping video and audio files,
+	// subscribers use it to measure publish to receive latency
+	SyntheticMedia bool
+	// videos and audio samples published by publishers, the embedded media when nil
+	Media *provider2.MediaLibrary
+	// impair the tester's connection, nil for an unimpaired network
+	NetworkProfile *NetworkProfile
+	// subscribers switch video tracks between speaker, grid and hidden layouts at this interval when set,
+	// verifying that the received layer follows
+	LayoutSwitchInterval time.Duration
+	// stamp the index of each published H.264 frame, subscribers check that frames arrive in sequence
+	// whether or not it is set
+	Watermark bool
+	// fail to publish audio that does not carry Opus in-band FEC, which is added by the encoder of the media files
+	RequireAudioFEC bool
+	// suppress published audio packets without voice activity, like Opus DTX
+	AudioDTX bool
 
 	name           string
 	Sequence       int
@@ -93,6 +170,7 @@ func NewLoadTester(params TesterParams) *LoadTester {
 	return &LoadTester{
 		params:                 params,
 		stats:                  &sync.Map{},
+		dataStats:              &sync.Map{},
 		trackQualities:         make(map[string]livekit.VideoQuality),
 		subscribedParticipants: make(map[string]*lksdk.RemoteParticipant),
 	}
@@ -104,35 +182,70 @@ func (t *LoadTester) Start() error {
 	}
 
 	identity := fmt.Sprintf("%s_%d", t.params.IdentityPrefix, t.params.Sequence)
-	t.room = lksdk.NewRoom(&lksdk.RoomCallback{
+	room := lksdk.NewRoom(&lksdk.RoomCallback{
 		ParticipantCallback: lksdk.ParticipantCallback{
 			OnTrackSubscribed: t.onTrackSubscribed,
 			OnTrackSubscriptionFailed: func(sid string, rp *lksdk.RemoteParticipant) {
+				t.subscriptionFailures.Inc()
 				fmt.Printf("track subscription failed, lp:%v, sid:%v, rp:%v/%v\n", identity, sid, rp.Identity(), rp.SID())
 			},
 			OnTrackPublished: t.onTrackPublished,
+			OnDataPacket:     t.onDataPacket,
+		},
+		OnReconnected: func() {
+			t.reconnects.Inc()
 		},
 	})
+	// testers may be restarted, forget participants of the previous session
+	t.lock.Lock()
+	t.room = room
+	t.subscribedParticipants = make(map[string]*lksdk.RemoteParticipant)
+	t.trackQualities = make(map[string]livekit.VideoQuality)
+	t.lock.Unlock()
+	joinStart := time.Now()
+	t.sessionStart.Store(joinStart)
+	t.sawFirstTrack.Store(false)
+	t.sawFirstKeyframe.Store(false)
+
+	opts := []lksdk.ConnectOption{lksdk.WithAutoSubscribe(false)}
+	if t.params.NetworkProfile != nil {
+		interceptors, err := t.params.NetworkProfile.interceptors(t.params.Sequence, t.joins.Load())
+		if err != nil {
+			return err
+		}
+		opts = append(opts, lksdk.WithInterceptors(interceptors))
+	}
+
 	var err error
 	// make up to 10 reconnect attempts
 	for i := 0; i < 10; i++ {
-		err = t.room.Join(t.params.URL, lksdk.ConnectInfo{
+		if i > 0 {
+			t.joinRetries.Inc()
+		}
+		err = room.Join(t.params.URL, lksdk.ConnectInfo{
 			APIKey:              t.params.APIKey,
 			APISecret:           t.params.APISecret,
 			RoomName:            t.params.Room,
 			ParticipantIdentity: identity,
-		}, lksdk.WithAutoSubscribe(false))
+		}, opts...)
 		if err == nil {
 			break
 		}
 		time.Sleep(1 * time.Second)
 	}
 	if err != nil {
+		t.failedJoins.Inc()
 		return err
 	}
+	t.joins.Inc()
+	t.joinLatency.add(time.Since(joinStart))
 
 	t.running.Store(true)
-	for _, p := range t.room.GetRemoteParticipants() {
+	t.connected.begin(time.Now())
+	if t.params.Subscribe && t.params.LayoutSwitchInterval > 0 {
+		go t.cycleLayouts(room)
+	}
+	for _, p := range room.GetRemoteParticipants() {
 		for _, pub := range p.TrackPublications() {
 			if remotePub, ok := pub.(*lksdk.RemoteTrackPublication); ok {
 				t.onTrackPublished(remotePub, p)
@@ -147,13 +260,23 @@ func (t *LoadTester) IsRunning() bool {
 	return t.running.Load()
 }
 
+func (t *LoadTester) ConnectionState() lksdk.ConnectionState {
+	if !t.IsRunning() {
+		return lksdk.ConnectionStateDisconnected
+	}
+	t.lock.Lock()
+	room := t.room
+	t.lock.Unlock()
+	return room.ConnectionState()
+}
+
 func (t *LoadTester) PublishAudioTrack(name string) (string, error) {
 	if !t.IsRunning() {
 		return "", nil
 	}
 
 	fmt.Println("publishing audio track -", t.room.LocalParticipant.Identity())
-	audioLooper, err := provider2.CreateAudioLooper()
+	audioLooper, err := t.createAudioLooper()
 	if err != nil {
 		return "", err
 	}
@@ -180,21 +303,30 @@ func (t *LoadTester) PublishVideoTrack(name, resolution, codec string) (string,
 	}
 
 	fmt.Println("publishing video track -", t.room.LocalParticipant.Identity())
-	loopers, err := provider2.CreateVideoLoopers(resolution, codec, false)
+	loopers, err := t.createVideoLoopers(resolution, codec, false)
 	if err != nil {
 		return "", err
 	}
-	track, err := lksdk.NewLocalTrack(loopers[0].Codec())
+	return t.publishVideoLooper(name, loopers[0])
+}
+
+// publishVideoLooper publishes a single video track, with a single layer
+func (t *LoadTester) publishVideoLooper(name string, looper provider2.VideoLooper) (string, error) {
+	track, err := provider2.NewTrack(looper)
 	if err != nil {
 		return "", err
 	}
-	if err := track.StartWrite(loopers[0], nil); err != nil {
-		return "", err
-	}
 
-	p, err := t.room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{
+	opts := &lksdk.TrackPublicationOptions{
 		Name: name,
-	})
+	}
+	if provider2.IsSingleTrackVideo(looper) {
+		layer := looper.ToLayer(livekit.VideoQuality_HIGH)
+		opts.Source = livekit.TrackSource_CAMERA
+		opts.VideoWidth = int(layer.Width)
+		opts.VideoHeight = int(layer.Height)
+	}
+	p, err := t.room.LocalParticipant.PublishTrack(track, opts)
 	if err != nil {
 		return "", err
 	}
@@ -205,14 +337,17 @@ func (t *LoadTester) PublishSimulcastTrack(name, resolution, codec string) (stri
 	var tracks []*lksdk.LocalTrack
 
 	fmt.Println("publishing simulcast video track -", t.room.LocalParticipant.Identity())
-	loopers, err := provider2.CreateVideoLoopers(resolution, codec, true)
+	loopers, err := t.createVideoLoopers(resolution, codec, true)
 	if err != nil {
 		return "", err
 	}
+	// vp9 and av1 videos are not published with simulcast
+	if provider2.IsSingleTrackVideo(loopers[0]) {
+		return t.publishVideoLooper(name, loopers[len(loopers)-1])
+	}
 	// for video, publish three simulcast layers
 	for i, looper := range loopers {
 		layer := looper.ToLayer(livekit.VideoQuality(i))
-
 		track, err := lksdk.NewLocalTrack(looper.Codec(),
 			lksdk.WithSimulcast("loadtest-video", layer))
 		if err != nil {
@@ -231,19 +366,118 @@ func (t *LoadTester) PublishSimulcastTrack(name, resolution, codec string) (stri
 	if err != nil {
 		return "", err
 	}
+	return p.SID(), nil
+}
+
+// PublishScreenShareTrack publishes a high resolution, low frame rate video track as a screen share
+func (t *LoadTester) PublishScreenShareTrack(name, codec string) (string, error) {
+	if !t.IsRunning() {
+		return "", nil
+	}
 
+	fmt.Println("publishing screen share track -", t.room.LocalParticipant.Identity())
+	looper, err := t.createScreenShareLooper(codec)
+	if err != nil {
+		return "", err
+	}
+	track, err := provider2.NewTrack(looper)
+	if err != nil {
+		return "", err
+	}
+
+	layer := looper.ToLayer(livekit.VideoQuality_HIGH)
+	p, err := t.room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{
+		Name:        name,
+		Source:      livekit.TrackSource_SCREEN_SHARE,
+		VideoWidth:  int(layer.Width),
+		VideoHeight: int(layer.Height),
+	})
+	if err != nil {
+		return "", err
+	}
 	return p.SID(), nil
 }
 
+func (t *LoadTester) createAudioLooper() (provider2.Looper, error) {
+	if t.params.SyntheticMedia {
+		return NewLoadTestProvider(32_000)
+	}
+	looper, err := t.media().CreateAudioLooperAt(int64(t.params.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	if t.params.RequireAudioFEC {
+		// FEC is added by the encoder, pre-encoded audio has it or not
+		if opus, ok := looper.(*provider2.OpusAudioLooper); !ok || !opus.HasFEC() {
+			return nil, errors.New("published audio carries no Opus in-band FEC, publish a media library encoded with FEC")
+		}
+	}
+	if t.params.AudioDTX {
+		return provider2.NewDTXAudioLooper(looper)
+	}
+	return looper, nil
+}
+
+func (t *LoadTester) createVideoLoopers(resolution, codec string, simulcast bool) ([]provider2.VideoLooper, error) {
+	if t.params.SyntheticMedia {
+		return createLoadTestVideoProviders(resolution, simulcast)
+	}
+	loopers, err := t.media().CreateVideoLoopersAt(int64(t.params.Sequence), resolution, codec, simulcast)
+	if err != nil || !t.params.Watermark {
+		return loopers, err
+	}
+	for i, looper := range loopers {
+		if loopers[i], err = provider2.NewWatermarkVideoLooper(looper, uint8(i)); err != nil {
+			return nil, err
+		}
+	}
+	return loopers, nil
+}
+
+func (t *LoadTester) createScreenShareLooper(codec string) (provider2.VideoLooper, error) {
+	if t.params.SyntheticMedia {
+		return createLoadTestScreenShareProvider()
+	}
+	looper, err := t.media().CreateScreenShareLooperAt(int64(t.params.Sequence), codec)
+	if err != nil || !t.params.Watermark {
+		return looper, err
+	}
+	return provider2.NewWatermarkVideoLooper(looper, 0)
+}
+
+func (t *LoadTester) media() *provider2.MediaLibrary {
+	if t.params.Media != nil {
+		return t.params.Media
+	}
+	return provider2.EmbeddedMedia()
+}
+
 func (t *LoadTester) getStats() *testerStats {
 	stats := &testerStats{
 		expectedTracks: t.params.expectedTracks,
+		room:           t.params.Room,
 		trackStats:     make(map[string]*trackStats),
+		dataStats:      make(map[string]*dataTopicStats),
+		joins:          t.joins.Load(),
+		failedJoins:    t.failedJoins.Load(),
+		reconnects:     t.reconnects.Load(),
+		joinRetries:    t.joinRetries.Load(),
+		connected:      t.connected.elapsed(time.Now()),
+		joinLatency:    &t.joinLatency,
+		firstTrack:     &t.firstTrack,
+		firstKeyframe:  &t.firstKeyframe,
+	}
+	if t.params.NetworkProfile != nil {
+		stats.networkProfile = t.params.NetworkProfile.Name
 	}
 	t.stats.Range(func(key, value interface{}) bool {
 		stats.trackStats[key.(string)] = value.(*trackStats)
 		return true
 	})
+	t.dataStats.Range(func(key, value interface{}) bool {
+		stats.dataStats[key.(string)] = value.(*dataTopicStats)
+		return true
+	})
 	return stats
 }
 
@@ -265,6 +499,7 @@ func (t *LoadTester) Stop() {
 	}
 	t.running.Store(false)
 	t.room.Disconnect()
+	t.connected.end(time.Now())
 }
 
 func (t *LoadTester) numToSubscribe() int {
@@ -315,8 +550,14 @@ func (t *LoadTester) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Rem
 	s := &trackStats{
 		trackID: track.ID(),
 		kind:    pub.Kind(),
+		source:  trackSourceName(pub.Source()),
+		codec:   track.Codec().MimeType,
+	}
+	// keep counting into the same stats when the track is subscribed again after a restart
+	t.stats.LoadOrStore(track.ID(), s)
+	if t.sawFirstTrack.CompareAndSwap(false, true) {
+		t.firstTrack.add(time.Since(t.sessionStart.Load()))
 	}
-	t.stats.Store(track.ID(), s)
 	fmt.Println("subscribed to track", t.room.LocalParticipant.Identity(), pub.SID(), pub.Kind(), fmt.Sprintf("%d/%d", numSubscribed, numTotal))
 
 	// consume track
@@ -326,6 +567,13 @@ func (t *LoadTester) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Rem
 		return
 	}
 
+	if t.params.LayoutSwitchInterval > 0 {
+		// join the layout cycle in its current phase
+		phase, _ := layoutPhaseAt(time.Now(), t.params.LayoutSwitchInterval)
+		setVideoQuality(pub, phase.quality)
+		return
+	}
+
 	// ensure it's using the right layer
 	qualityCounts := make(map[livekit.VideoQuality]int)
 	t.lock.Lock()
@@ -362,16 +610,7 @@ func (t *LoadTester) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Rem
 	t.lock.Unlock()
 
 	// switch quality and/or enable/disable
-	switch targetQuality {
-	case livekit.VideoQuality_HIGH:
-		pub.SetVideoDimensions(highWidth, highHeight)
-	case livekit.VideoQuality_MEDIUM:
-		pub.SetVideoDimensions(mediumWidth, mediumHeight)
-	case livekit.VideoQuality_LOW:
-		pub.SetVideoDimensions(lowWidth, lowHeight)
-	case livekit.VideoQuality_OFF:
-		pub.SetEnabled(false)
-	}
+	setVideoQuality(pub, targetQuality)
 }
 
 func (t *LoadTester) consumeTrack(track *webrtc.TrackRemote, pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
@@ -384,12 +623,23 @@ func (t *LoadTester) consumeTrack(track *webrtc.TrackRemote, pub *lksdk.RemoteTr
 	}()
 
 	var dpkt rtp.Depacketizer
-	isVideo := false
-	if pub.Kind() == lksdk.TrackKindVideo {
-		dpkt = &codecs.H264Packet{}
-		isVideo = true
+	var loadTestDpkt *LoadTestDepacketizer
+	isVideo := pub.Kind() == lksdk.TrackKindVideo
+	mimeType := track.Codec().MimeType
+	// watermarks are carried in H.264 SEI
+	watermarked := isVideo && !t.params.SyntheticMedia && strings.EqualFold(mimeType, webrtc.MimeTypeH264)
+	opus := !t.params.SyntheticMedia && strings.EqualFold(mimeType, webrtc.MimeTypeOpus)
+	// lost audio packets are counted from gaps in sequence numbers, which DTX leaves continuous
+	var audioFrames audioFrameCounter
+	if t.params.SyntheticMedia {
+		loadTestDpkt = &LoadTestDepacketizer{Video: isVideo}
+		dpkt = loadTestDpkt
 	} else {
-		dpkt = &codecs.OpusPacket{}
+		var err error
+		if dpkt, err = newDepacketizer(mimeType); err != nil {
+			fmt.Println("could not consume track", track.ID(), err)
+			return
+		}
 	}
 	sb := samplebuilder.New(100, dpkt, track.Codec().ClockRate, samplebuilder.WithPacketDroppedHandler(func() {
 		value, _ := t.stats.Load(track.ID())
@@ -401,7 +651,10 @@ func (t *LoadTester) consumeTrack(track *webrtc.TrackRemote, pub *lksdk.RemoteTr
 	}))
 	value, _ := t.stats.Load(track.ID())
 	ts := value.(*trackStats)
-	ts.startedAt.Store(time.Now())
+	ts.consumed.begin(time.Now())
+	defer func() {
+		ts.consumed.end(time.Now())
+	}()
 	for {
 		pkt, _, err := track.ReadRTP()
 		if err != nil {
@@ -412,11 +665,51 @@ func (t *LoadTester) consumeTrack(track *webrtc.TrackRemote, pub *lksdk.RemoteTr
 		}
 		sb.Push(pkt)
 
-		for _, pkt := range sb.PopPackets() {
+		for {
+			pkts := sb.PopPackets()
+			if len(pkts) == 0 {
+				break
+			}
 			value, _ := t.stats.Load(track.ID())
 			ts := value.(*trackStats)
-			ts.bytes.Add(int64(len(pkt.Payload)))
-			ts.packets.Inc()
+			for _, pkt := range pkts {
+				ts.bytes.Add(int64(len(pkt.Payload)))
+				ts.packets.Inc()
+			}
+			ts.frames.Inc()
+			// synthetic samples are not decodable, so keyframes cannot be told apart
+			keyframe := isVideo && loadTestDpkt == nil && isKeyFrame(mimeType, pkts)
+			if keyframe {
+				ts.keyframes.Inc()
+			}
+			// but every synthetic frame can be shown on its own
+			if (keyframe || isVideo && loadTestDpkt != nil) && t.sawFirstKeyframe.CompareAndSwap(false, true) {
+				t.firstKeyframe.add(time.Since(t.sessionStart.Load()))
+			}
+			if isVideo && t.params.LayoutSwitchInterval > 0 {
+				var width, height uint32
+				if loadTestDpkt != nil {
+					width, height, _ = loadTestDpkt.SampleDimensions(pkts)
+				}
+				var size int
+				for _, pkt := range pkts {
+					size += len(pkt.Payload)
+				}
+				ts.layerSwitch.onFrame(time.Now(), size, keyframe, width, height)
+			}
+			if loadTestDpkt != nil {
+				if sentAt, ok := loadTestDpkt.SampleTimestamp(pkts); ok {
+					ts.latency.add(time.Since(sentAt))
+				}
+			}
+			if watermarked {
+				if index, layer, ok := findWatermark(pkts); ok {
+					ts.frameSequence.onFrame(index, layer, time.Now())
+				}
+			}
+			if opus {
+				audioFrames.onPacket(ts, pkts[0])
+			}
 		}
 	}
 }
@@ -0,0 +1,65 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestPublisherProfiles(t *testing.T) {
+	profile, err := PublisherProfileFromString("Presenter")
+	require.NoError(t, err)
+	require.Equal(t, PublisherProfilePresenter, profile)
+	_, err = PublisherProfileFromString("webinar")
+	require.Error(t, err)
+
+	params := &Params{VideoPublishers: 2, AudioPublishers: 3}
+	require.Equal(t, 5, params.publishedTracks())
+	// each presenter publishes camera, microphone and screen share, one audio publisher only has a microphone
+	params.PublisherProfile = PublisherProfilePresenter
+	require.Equal(t, 7, params.publishedTracks())
+}
+
+func TestTrackSources(t *testing.T) {
+	stats := newTestStats()
+	sub := stats["Sub 0"]
+	sub.trackStats["TR_audio"].source = trackSourceName(livekit.TrackSource_MICROPHONE)
+	sub.trackStats["TR_video"].source = trackSourceName(livekit.TrackSource_CAMERA)
+
+	screen := &trackStats{trackID: "TR_screen", kind: lksdk.TrackKindVideo, source: trackSourceName(livekit.TrackSource_SCREEN_SHARE)}
+	screen.consumed.begin(time.Now().Add(-10 * time.Second))
+	screen.packets.Store(200)
+	screen.dropped.Store(50)
+	sub.trackStats[screen.trackID] = screen
+
+	r := newRunReport("load-test", "room", stats)
+	require.Len(t, r.Sources, 3)
+	require.Equal(t, "camera", r.Sources[0].Source)
+	require.Equal(t, "microphone", r.Sources[1].Source)
+	require.EqualValues(t, 490, r.Sources[1].Packets)
+	require.Equal(t, "screen_share", r.Sources[2].Source)
+	require.InDelta(t, 20.0, r.Sources[2].PacketLoss, 0.001)
+
+	tracks := r.Testers[0].TrackStats
+	require.Equal(t, "audio", tracks[0].Kind)
+	require.Equal(t, "camera", tracks[1].Source)
+	require.Equal(t, "screen_share", tracks[2].Source)
+}
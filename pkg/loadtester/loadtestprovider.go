@@ -16,40 +16,121 @@ package loadtester
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"time"
 
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
 	"github.com/pion/webrtc/v4/pkg/media"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+	"github.com/livekit/protocol/livekit"
 )
 
+// width and height of video samples, as two uint16
+const sampleDimensionsSize = 4
+
 // LoadTestProvider is designed to be used with the load tester.
 // It provides packets that are encoded with Sequence and timing information, in order determine RTT and loss
 type LoadTestProvider struct {
 	BytesPerSample uint32
 	SampleDuration time.Duration
+
+	// samples are carried as opus or vp8 payloads, but are not decodable media
+	codec webrtc.RTPCodecCapability
+	layer *livekit.VideoLayer
 }
 
 func NewLoadTestProvider(bitrate uint32) (*LoadTestProvider, error) {
 	bytesPerSample := bitrate / 8 / 30
-	if bytesPerSample < 8 {
-		return nil, errors.New("bitrate lower than minimum of 1920")
+	if bytesPerSample < 14 {
+		return nil, errors.New("bitrate lower than minimum of 3360")
 	}
 
 	return &LoadTestProvider{
 		SampleDuration: time.Second / 30,
 		BytesPerSample: bytesPerSample,
+		codec: webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeOpus,
+			ClockRate: 48000,
+			Channels:  2,
+		},
 	}, nil
 }
 
-func (p *LoadTestProvider) NextSample() (media.Sample, error) {
+// NewLoadTestVideoProvider creates a provider that publishes a video layer at the layer's bitrate
+func NewLoadTestVideoProvider(layer *livekit.VideoLayer) (*LoadTestProvider, error) {
+	p, err := NewLoadTestProvider(layer.Bitrate)
+	if err != nil {
+		return nil, err
+	}
+	p.layer = layer
+	p.codec = webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeVP8,
+		ClockRate: 90000,
+		RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: webrtc.TypeRTCPFBNACK},
+			{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"},
+		},
+	}
+	return p, nil
+}
+
+func createLoadTestVideoProviders(resolution string, simulcast bool) ([]provider2.VideoLooper, error) {
+	layers := []*livekit.VideoLayer{
+		{Width: lowWidth, Height: lowHeight, Bitrate: 150_000},
+		{Width: mediumWidth, Height: mediumHeight, Bitrate: 500_000},
+		{Width: highWidth, Height: highHeight, Bitrate: 1_500_000},
+	}
+	switch resolution {
+	case "medium":
+		layers = layers[:2]
+	case "low":
+		layers = layers[:1]
+	}
+	if !simulcast {
+		layers = layers[len(layers)-1:]
+	}
+
+	providers := make([]provider2.VideoLooper, 0, len(layers))
+	for _, layer := range layers {
+		p, err := NewLoadTestVideoProvider(layer)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// createLoadTestScreenShareProvider creates a provider resembling a shared screen, high resolution at a low frame rate
+func createLoadTestScreenShareProvider() (provider2.VideoLooper, error) {
+	p, err := NewLoadTestVideoProvider(&livekit.VideoLayer{Width: highWidth, Height: highHeight, Bitrate: 500_000})
+	if err != nil {
+		return nil, err
+	}
+	p.SampleDuration = time.Second / screenShareFps
+	p.BytesPerSample = p.layer.Bitrate / 8 / screenShareFps
+	return p, nil
+}
+
+func (p *LoadTestProvider) NextSample(_ context.Context) (media.Sample, error) {
 	// sample format:
 	// 0xfafafa + 0000... + 8 bytes for ts
+	// video samples carry the width and height of their layer after the 0xfafafa prefix
 	buf := bytes.NewBuffer(nil)
 	buf.Write([]byte{
 		0xfa, 0xfa, 0xfa, 0xfa,
 	})
-	buf.Write(make([]byte, p.BytesPerSample-12))
+	padding := make([]byte, p.BytesPerSample-12)
+	if p.layer != nil && len(padding) >= sampleDimensionsSize {
+		binary.LittleEndian.PutUint16(padding, uint16(p.layer.Width))
+		binary.LittleEndian.PutUint16(padding[2:], uint16(p.layer.Height))
+	}
+	buf.Write(padding)
 	ts := make([]byte, 8)
 	binary.LittleEndian.PutUint64(ts, uint64(time.Now().UnixNano()))
 	buf.Write(ts)
@@ -60,6 +141,22 @@ func (p *LoadTestProvider) NextSample() (media.Sample, error) {
 	}, nil
 }
 
+func (p *LoadTestProvider) Codec() webrtc.RTPCodecCapability {
+	return p.codec
+}
+
+func (p *LoadTestProvider) ToLayer(quality livekit.VideoQuality) *livekit.VideoLayer {
+	if p.layer == nil {
+		return nil
+	}
+	return &livekit.VideoLayer{
+		Quality: quality,
+		Width:   p.layer.Width,
+		Height:  p.layer.Height,
+		Bitrate: p.layer.Bitrate,
+	}
+}
+
 func (p *LoadTestProvider) OnBind() error {
 	return nil
 }
@@ -68,15 +165,26 @@ func (p *LoadTestProvider) OnUnbind() error {
 	return nil
 }
 
+func (p *LoadTestProvider) Close() error {
+	return nil
+}
+
 type LoadTestDepacketizer struct {
+	// set when samples are carried in VP8 payloads, which are fragmented and prefixed with a descriptor
+	Video bool
 }
 
 func (d *LoadTestDepacketizer) Unmarshal(packet []byte) ([]byte, error) {
-	return packet, nil
+	if !d.Video {
+		return packet, nil
+	}
+	vp8 := &codecs.VP8Packet{}
+	return vp8.Unmarshal(packet)
 }
 
 func (d *LoadTestDepacketizer) IsPartitionHead(payload []byte) bool {
-	if len(payload) < 4 {
+	payload, err := d.Unmarshal(payload)
+	if err != nil || len(payload) < 4 {
 		return false
 	}
 	for i := 0; i < 4; i++ {
@@ -88,6 +196,11 @@ func (d *LoadTestDepacketizer) IsPartitionHead(payload []byte) bool {
 }
 
 func (d *LoadTestDepacketizer) IsPartitionTail(marker bool, payload []byte) bool {
+	if d.Video {
+		// video samples may be fragmented, the marker is set on the last packet of each sample
+		return marker
+	}
+
 	size := len(payload)
 	if size < 10 {
 		return false
@@ -101,3 +214,43 @@ func (d *LoadTestDepacketizer) IsPartitionTail(marker bool, payload []byte) bool
 	ts := binary.LittleEndian.Uint64(payload[size-8:])
 	return ts > uint64(time.Now().Add(-time.Minute).UnixNano()) && ts < uint64(time.Now().UnixNano())
 }
+
+// SampleTimestamp returns the time at which the sample carried by pkts was created by a LoadTestProvider
+func (d *LoadTestDepacketizer) SampleTimestamp(pkts []*rtp.Packet) (time.Time, bool) {
+	sample, ok := d.sample(pkts)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts := binary.LittleEndian.Uint64(sample[len(sample)-8:])
+	return time.Unix(0, int64(ts)), true
+}
+
+// SampleDimensions returns the width and height of the video layer the sample carried by pkts was published on
+func (d *LoadTestDepacketizer) SampleDimensions(pkts []*rtp.Packet) (uint32, uint32, bool) {
+	sample, ok := d.sample(pkts)
+	if !ok || !d.Video || len(sample) < 12+sampleDimensionsSize {
+		return 0, 0, false
+	}
+	width := binary.LittleEndian.Uint16(sample[4:])
+	height := binary.LittleEndian.Uint16(sample[6:])
+	if width == 0 || height == 0 {
+		return 0, 0, false
+	}
+	return uint32(width), uint32(height), true
+}
+
+// sample reassembles the sample carried by pkts
+func (d *LoadTestDepacketizer) sample(pkts []*rtp.Packet) ([]byte, bool) {
+	var sample []byte
+	for _, pkt := range pkts {
+		payload, err := d.Unmarshal(pkt.Payload)
+		if err != nil {
+			return nil, false
+		}
+		sample = append(sample, payload...)
+	}
+	if len(sample) < 12 || !d.IsPartitionHead(pkts[0].Payload) {
+		return nil, false
+	}
+	return sample, true
+}
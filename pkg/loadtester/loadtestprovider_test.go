@@ -0,0 +1,127 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+func packetize(payloader rtp.Payloader, data []byte) []*rtp.Packet {
+	payloads := payloader.Payload(1200, data)
+	pkts := make([]*rtp.Packet, 0, len(payloads))
+	for i, payload := range payloads {
+		pkts = append(pkts, &rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: uint16(i),
+				Marker:         i == len(payloads)-1,
+			},
+			Payload: payload,
+		})
+	}
+	return pkts
+}
+
+func TestLoadTestDepacketizer(t *testing.T) {
+	t.Run("audio", func(t *testing.T) {
+		p, err := NewLoadTestProvider(32_000)
+		require.NoError(t, err)
+		sample, err := p.NextSample(context.Background())
+		require.NoError(t, err)
+
+		d := &LoadTestDepacketizer{}
+		pkts := packetize(&codecs.OpusPayloader{}, sample.Data)
+		require.Len(t, pkts, 1)
+		require.True(t, d.IsPartitionHead(pkts[0].Payload))
+		require.True(t, d.IsPartitionTail(false, pkts[0].Payload))
+
+		sentAt, ok := d.SampleTimestamp(pkts)
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now(), sentAt, time.Second)
+	})
+
+	t.Run("fragmented video", func(t *testing.T) {
+		p, err := NewLoadTestVideoProvider(&livekit.VideoLayer{Width: 1280, Height: 720, Bitrate: 1_500_000})
+		require.NoError(t, err)
+		sample, err := p.NextSample(context.Background())
+		require.NoError(t, err)
+
+		d := &LoadTestDepacketizer{Video: true}
+		pkts := packetize(&codecs.VP8Payloader{EnablePictureID: true}, sample.Data)
+		require.Greater(t, len(pkts), 1)
+		require.True(t, d.IsPartitionHead(pkts[0].Payload))
+		require.False(t, d.IsPartitionHead(pkts[1].Payload))
+		require.True(t, d.IsPartitionTail(true, pkts[len(pkts)-1].Payload))
+
+		sentAt, ok := d.SampleTimestamp(pkts)
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now(), sentAt, time.Second)
+
+		width, height, ok := d.SampleDimensions(pkts)
+		require.True(t, ok)
+		require.EqualValues(t, 1280, width)
+		require.EqualValues(t, 720, height)
+	})
+}
+
+func TestLatencyStats(t *testing.T) {
+	l := &latencyStats{}
+	for i := 1; i <= 100; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	p := l.percentiles(50, 95, 99)
+	require.Equal(t, 50*time.Millisecond, p[0])
+	require.Equal(t, 95*time.Millisecond, p[1])
+	require.Equal(t, 99*time.Millisecond, p[2])
+
+	merged := &latencyStats{}
+	for i := 0; i < 3; i++ {
+		big := &latencyStats{}
+		for j := 0; j < maxLatencySamples; j++ {
+			big.add(time.Millisecond)
+		}
+		merged.merge(big)
+	}
+	require.EqualValues(t, 3*maxLatencySamples, merged.count)
+	require.Len(t, merged.samples, maxLatencySamples)
+
+	// the samples of a tester that recorded 100 times more latencies weigh 100 times more
+	merged = &latencyStats{}
+	for j := 0; j < maxLatencySamples; j++ {
+		merged.add(100 * time.Millisecond)
+	}
+	big := &latencyStats{count: 100 * maxLatencySamples}
+	for j := 0; j < maxLatencySamples; j++ {
+		big.samples = append(big.samples, time.Millisecond)
+	}
+	merged.merge(big)
+	require.EqualValues(t, 101*maxLatencySamples, merged.count)
+	require.Len(t, merged.samples, maxLatencySamples)
+	slow := 0
+	for _, d := range merged.samples {
+		if d == 100*time.Millisecond {
+			slow++
+		}
+	}
+	require.InDelta(t, maxLatencySamples/101, slow, 1)
+	require.Equal(t, time.Millisecond, merged.percentiles(95)[0])
+}
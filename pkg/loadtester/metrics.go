@@ -0,0 +1,255 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const metricsPath = "/metrics"
+
+// serveMetrics serves the metrics written by collect in the Prometheus text format, until stop is called
+func serveMetrics(addr string, collect func(w *metricsWriter)) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metricsHandler(collect))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("metrics server failed:", err)
+		}
+	}()
+	fmt.Printf("Serving metrics on http://%s%s\n", listener.Addr(), metricsPath)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = server.Shutdown(ctx)
+		})
+	}, nil
+}
+
+func metricsHandler(collect func(w *metricsWriter)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw := newMetricsWriter(w)
+		collect(mw)
+		_ = mw.flush()
+	})
+}
+
+type metricType string
+
+const (
+	metricCounter metricType = "counter"
+	metricGauge   metricType = "gauge"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format.
+// Samples of a metric must be written one after another
+type metricsWriter struct {
+	w    *bufio.Writer
+	last string
+}
+
+func newMetricsWriter(w io.Writer) *metricsWriter {
+	return &metricsWriter{w: bufio.NewWriter(w)}
+}
+
+// write adds a sample, labels are given as name, value pairs
+func (m *metricsWriter) write(name string, typ metricType, help string, value float64, labels ...string) {
+	if name != m.last {
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		m.last = name
+	}
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			fmt.Fprintf(m.w, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.w.WriteByte('\n')
+}
+
+func (m *metricsWriter) flush() error {
+	return m.w.Flush()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// loadTestMetrics exposes the testers of the current run
+type loadTestMetrics struct {
+	lock    sync.Mutex
+	room    string
+	testers []*LoadTester
+}
+
+func (m *loadTestMetrics) startRun(room string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.room = room
+	m.testers = nil
+}
+
+func (m *loadTestMetrics) addTester(t *LoadTester) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.testers = append(m.testers, t)
+}
+
+// stats returns the stats of the testers of the current run, while they run
+func (m *loadTestMetrics) stats() map[string]*testerStats {
+	m.lock.Lock()
+	testers := append([]*LoadTester{}, m.testers...)
+	m.lock.Unlock()
+
+	stats := make(map[string]*testerStats, len(testers))
+	for _, t := range testers {
+		stats[t.params.name] = t.getStats()
+	}
+	return stats
+}
+
+type testerMetrics struct {
+	name                 string
+	room                 string
+	connected            bool
+	tracks               int64
+	packets              int64
+	bytes                int64
+	dropped              int64
+	subscriptionFailures int64
+	joins                int64
+	failedJoins          int64
+	reconnects           int64
+}
+
+func (m *loadTestMetrics) write(w *metricsWriter) {
+	m.lock.Lock()
+	room := m.room
+	testers := append([]*LoadTester{}, m.testers...)
+	m.lock.Unlock()
+
+	total := &testerMetrics{}
+	var active int
+	snapshots := make([]*testerMetrics, 0, len(testers))
+	for _, t := range testers {
+		s := &testerMetrics{
+			name:                 t.params.name,
+			connected:            t.ConnectionState() == lksdk.ConnectionStateConnected,
+			subscriptionFailures: t.subscriptionFailures.Load(),
+			joins:                t.joins.Load(),
+			failedJoins:          t.failedJoins.Load(),
+			reconnects:           t.reconnects.Load(),
+		}
+		t.stats.Range(func(_, value interface{}) bool {
+			ts := value.(*trackStats)
+			s.tracks++
+			s.packets += ts.packets.Load()
+			s.bytes += ts.bytes.Load()
+			s.dropped += ts.dropped.Load()
+			return true
+		})
+		// testers are labeled with their own room when spread over several rooms
+		s.room = t.params.Room
+		if s.room == "" {
+			s.room = room
+		}
+		snapshots = append(snapshots, s)
+
+		if s.connected {
+			active++
+		}
+		total.tracks += s.tracks
+		total.packets += s.packets
+		total.bytes += s.bytes
+		total.dropped += s.dropped
+		total.subscriptionFailures += s.subscriptionFailures
+		total.joins += s.joins
+		total.failedJoins += s.failedJoins
+		total.reconnects += s.reconnects
+	}
+
+	perTester := []struct {
+		name  string
+		typ   metricType
+		help  string
+		value func(s *testerMetrics) float64
+	}{
+		{"lk_loadtest_tester_connected", metricGauge, "Whether the tester is connected to the room.",
+			func(s *testerMetrics) float64 { return boolToFloat(s.connected) }},
+		{"lk_loadtest_tester_tracks", metricGauge, "Tracks subscribed by the tester.",
+			func(s *testerMetrics) float64 { return float64(s.tracks) }},
+		{"lk_loadtest_tester_packets_total", metricCounter, "RTP packets received by the tester.",
+			func(s *testerMetrics) float64 { return float64(s.packets) }},
+		{"lk_loadtest_tester_bytes_total", metricCounter, "RTP payload bytes received by the tester.",
+			func(s *testerMetrics) float64 { return float64(s.bytes) }},
+		{"lk_loadtest_tester_dropped_packets_total", metricCounter, "RTP packets lost before reaching the tester.",
+			func(s *testerMetrics) float64 { return float64(s.dropped) }},
+		{"lk_loadtest_tester_subscription_failures_total", metricCounter, "Track subscriptions that failed for the tester.",
+			func(s *testerMetrics) float64 { return float64(s.subscriptionFailures) }},
+	}
+	for _, metric := range perTester {
+		for _, s := range snapshots {
+			w.write(metric.name, metric.typ, metric.help, metric.value(s), "room", s.room, "tester", s.name)
+		}
+	}
+
+	w.write("lk_loadtest_testers", metricGauge, "Testers started in the current run.", float64(len(testers)), "room", room)
+	w.write("lk_loadtest_active_testers", metricGauge, "Testers connected to the room.", float64(active), "room", room)
+	w.write("lk_loadtest_tracks", metricGauge, "Tracks subscribed by all testers.", float64(total.tracks), "room", room)
+	w.write("lk_loadtest_packets_total", metricCounter, "RTP packets received by all testers.", float64(total.packets), "room", room)
+	w.write("lk_loadtest_bytes_total", metricCounter, "RTP payload bytes received by all testers.", float64(total.bytes), "room", room)
+	w.write("lk_loadtest_dropped_packets_total", metricCounter, "RTP packets lost before reaching testers.", float64(total.dropped), "room", room)
+	w.write("lk_loadtest_subscription_failures_total", metricCounter, "Track subscriptions that failed.", float64(total.subscriptionFailures), "room", room)
+	w.write("lk_loadtest_joins_total", metricCounter, "Successful room joins.", float64(total.joins), "room", room)
+	w.write("lk_loadtest_failed_joins_total", metricCounter, "Room joins that failed after all retries.", float64(total.failedJoins), "room", room)
+	w.write("lk_loadtest_reconnects_total", metricCounter, "Reconnections after connectivity was lost.", float64(total.reconnects), "room", room)
+}
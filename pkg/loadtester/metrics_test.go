@@ -0,0 +1,67 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := newMetricsWriter(buf)
+	w.write("lk_test_total", metricCounter, "Test counter.", 1, "tester", "Sub 0")
+	w.write("lk_test_total", metricCounter, "Test counter.", 2.5, "tester", `Sub "1"`)
+	w.write("lk_test", metricGauge, "Test gauge.", 3)
+	require.NoError(t, w.flush())
+
+	require.Equal(t, `# HELP lk_test_total Test counter.
+# TYPE lk_test_total counter
+lk_test_total{tester="Sub 0"} 1
+lk_test_total{tester="Sub \"1\""} 2.5
+# HELP lk_test Test gauge.
+# TYPE lk_test gauge
+lk_test 3
+`, buf.String())
+}
+
+func TestLoadTestMetrics(t *testing.T) {
+	tester := NewLoadTester(TesterParams{name: "Sub 0"})
+	for _, ts := range newTestStats()["Sub 0"].trackStats {
+		tester.stats.Store(ts.trackID, ts)
+	}
+	tester.subscriptionFailures.Inc()
+
+	m := &loadTestMetrics{}
+	m.startRun("room")
+	m.addTester(tester)
+
+	rec := httptest.NewRecorder()
+	metricsHandler(m.write).ServeHTTP(rec, httptest.NewRequest("GET", metricsPath, nil))
+	require.Equal(t, 200, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	out := rec.Body.String()
+
+	require.Contains(t, out, `lk_loadtest_tester_packets_total{room="room",tester="Sub 0"} 1490`)
+	require.Contains(t, out, `lk_loadtest_tester_connected{room="room",tester="Sub 0"} 0`)
+	require.Contains(t, out, `lk_loadtest_dropped_packets_total{room="room"} 10`)
+	require.Contains(t, out, `lk_loadtest_subscription_failures_total{room="room"} 1`)
+	require.Contains(t, out, `lk_loadtest_active_testers{room="room"} 0`)
+	require.Equal(t, 1, strings.Count(out, "# TYPE lk_loadtest_tester_tracks gauge"))
+}
@@ -0,0 +1,796 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReportFormat string
+
+const (
+	ReportFormatNone  ReportFormat = ""
+	ReportFormatJSON  ReportFormat = "json"
+	ReportFormatCSV   ReportFormat = "csv"
+	ReportFormatJUnit ReportFormat = "junit"
+)
+
+func ReportFormatFromString(str string) (ReportFormat, error) {
+	switch strings.ToLower(str) {
+	case "":
+		return ReportFormatNone, nil
+	case string(ReportFormatJSON):
+		return ReportFormatJSON, nil
+	case string(ReportFormatCSV):
+		return ReportFormatCSV, nil
+	case string(ReportFormatJUnit), "xml":
+		return ReportFormatJUnit, nil
+	}
+	return ReportFormatNone, fmt.Errorf("unsupported report format %q, choose from \"json\", \"csv\", \"junit\"", str)
+}
+
+// Report is the machine-readable result of a load test, one RunReport per test run
+type Report struct {
+	StartedAt time.Time `json:"started_at"`
+	// replays the random choices of the test with --seed
+	Seed int64        `json:"seed,omitempty"`
+	Runs []*RunReport `json:"runs"`
+	// set when the runs are the steps of a capacity search
+	Capacity *CapacityReport `json:"capacity,omitempty"`
+}
+
+type RunReport struct {
+	Name       string             `json:"name"`
+	Room       string             `json:"room"`
+	Testers    []*TesterReport    `json:"testers"`
+	Total      *SummaryReport     `json:"total"`
+	Thresholds []*ThresholdResult `json:"thresholds,omitempty"`
+	// totals of subscribers sharing a network profile
+	Profiles []*ProfileReport `json:"network_profiles,omitempty"`
+	// data packets sent by data publishers and received by subscribers
+	Data []*DataTopicReport `json:"data,omitempty"`
+	// totals of subscribed tracks by track source, e.g. camera, microphone and screen share
+	Sources []*SourceReport `json:"sources,omitempty"`
+	// joins and time to connect of each publisher, subscribers report theirs in Testers
+	Publishers []*PublisherReport `json:"publishers,omitempty"`
+	// joins and time to connect of every tester, publishers included
+	Connections *ConnectionReport `json:"connections,omitempty"`
+	// totals of the subscribers of each room, and of rooms of the same size, when testers are spread over several rooms
+	Rooms     []*RoomReport     `json:"rooms,omitempty"`
+	RoomSizes []*RoomSizeReport `json:"room_sizes,omitempty"`
+}
+
+type TesterReport struct {
+	Name           string         `json:"name"`
+	Room           string         `json:"room,omitempty"`
+	NetworkProfile string         `json:"network_profile,omitempty"`
+	TrackStats     []*TrackReport `json:"track_stats"`
+	SummaryReport
+}
+
+type DataTopicReport struct {
+	Topic    string `json:"topic"`
+	Reliable bool   `json:"reliable"`
+	Sent     int64  `json:"sent"`
+	// packets sent times the number of subscribers
+	Expected   int64          `json:"expected"`
+	Received   int64          `json:"received"`
+	Delivery   float64        `json:"delivery_pct"`
+	OutOfOrder int64          `json:"out_of_order"`
+	Bytes      int64          `json:"bytes"`
+	Latency    *LatencyReport `json:"latency,omitempty"`
+}
+
+type ProfileReport struct {
+	Name string `json:"name"`
+	SummaryReport
+}
+
+// RoomReport sums up the subscribers of a room
+type RoomReport struct {
+	Name string `json:"name"`
+	// publishers and subscribers
+	Participants int `json:"participants"`
+	SummaryReport
+}
+
+// RoomSizeReport sums up the subscribers of rooms with the same number of participants
+type RoomSizeReport struct {
+	Participants int `json:"participants"`
+	Rooms        int `json:"rooms"`
+	SummaryReport
+}
+
+// LayerSwitchReport verifies that the layer received on video tracks follows the layout cycle
+type LayerSwitchReport struct {
+	Requested int64 `json:"requested"`
+	// the new layer was received, or the track paused when hidden
+	Completed int64 `json:"completed"`
+	// the received layer matched the requested layout
+	Verified int64 `json:"verified"`
+	// from the request until the new layer was received
+	Latency *LatencyReport `json:"latency,omitempty"`
+}
+
+// FrameSequenceReport checks the frame indexes stamped in watermarked video
+type FrameSequenceReport struct {
+	Frames int64 `json:"frames"`
+	// the previous frame received again
+	Duplicated int64 `json:"duplicated"`
+	Skipped    int64 `json:"skipped"`
+	Reordered  int64 `json:"reordered"`
+	// gaps between frames well above the frame interval
+	Freezes        int64         `json:"freezes"`
+	FreezeDuration time.Duration `json:"freeze_duration_ns"`
+	MaxFreeze      time.Duration `json:"max_freeze_ns"`
+}
+
+// AudioFrameReport counts the Opus packets received on audio tracks, each carrying a frame of audio
+type AudioFrameReport struct {
+	Frames int64 `json:"frames"`
+	// packets carrying in-band FEC data of the previous packet
+	FEC  int64 `json:"fec"`
+	Lost int64 `json:"lost"`
+	// lost packets that decoders recover from the FEC data of the next packet
+	Recovered int64 `json:"recovered"`
+}
+
+// SourceReport sums up the subscribed tracks of a track source
+type SourceReport struct {
+	Source     string         `json:"source"`
+	Tracks     int            `json:"tracks"`
+	Packets    int64          `json:"packets"`
+	Bytes      int64          `json:"bytes"`
+	Dropped    int64          `json:"dropped"`
+	PacketLoss float64        `json:"packet_loss_pct"`
+	Bitrate    float64        `json:"bitrate_bps"`
+	Frames     int64          `json:"frames"`
+	Keyframes  int64          `json:"keyframes"`
+	Latency    *LatencyReport `json:"latency,omitempty"`
+}
+
+type TrackReport struct {
+	TrackID    string         `json:"track_id"`
+	Kind       string         `json:"kind"`
+	Source     string         `json:"source,omitempty"`
+	Codec      string         `json:"codec"`
+	Packets    int64          `json:"packets"`
+	Bytes      int64          `json:"bytes"`
+	Dropped    int64          `json:"dropped"`
+	PacketLoss float64        `json:"packet_loss_pct"`
+	Bitrate    float64        `json:"bitrate_bps"`
+	Frames     int64          `json:"frames"`
+	Keyframes  int64          `json:"keyframes"`
+	Elapsed    time.Duration  `json:"elapsed_ns"`
+	Latency    *LatencyReport `json:"latency,omitempty"`
+
+	LayerSwitches *LayerSwitchReport   `json:"layer_switches,omitempty"`
+	FrameSequence *FrameSequenceReport `json:"frame_sequence,omitempty"`
+	AudioFrames   *AudioFrameReport    `json:"audio_frames,omitempty"`
+}
+
+type SummaryReport struct {
+	Tracks     int            `json:"tracks"`
+	Expected   int            `json:"expected_tracks"`
+	Packets    int64          `json:"packets"`
+	Bytes      int64          `json:"bytes"`
+	Dropped    int64          `json:"dropped"`
+	PacketLoss float64        `json:"packet_loss_pct"`
+	Bitrate    float64        `json:"bitrate_bps"`
+	Frames     int64          `json:"frames"`
+	Keyframes  int64          `json:"keyframes"`
+	Elapsed    time.Duration  `json:"elapsed_ns"`
+	Errors     int64          `json:"errors"`
+	Error      string         `json:"error,omitempty"`
+	Latency    *LatencyReport `json:"latency,omitempty"`
+
+	ConnectionReport
+
+	LayerSwitches *LayerSwitchReport   `json:"layer_switches,omitempty"`
+	FrameSequence *FrameSequenceReport `json:"frame_sequence,omitempty"`
+	AudioFrames   *AudioFrameReport    `json:"audio_frames,omitempty"`
+}
+
+type ConnectionReport struct {
+	Joins       int64          `json:"joins"`
+	FailedJoins int64          `json:"failed_joins"`
+	Reconnects  int64          `json:"reconnects"`
+	JoinRetries int64          `json:"join_retries"`
+	JoinLatency *LatencyReport `json:"join_latency,omitempty"`
+	// from the first join attempt
+	TimeToFirstTrack    *LatencyReport `json:"time_to_first_track,omitempty"`
+	TimeToFirstKeyframe *LatencyReport `json:"time_to_first_keyframe,omitempty"`
+}
+
+type PublisherReport struct {
+	Name string `json:"name"`
+	ConnectionReport
+}
+
+// LatencyReport contains publish to receive latency percentiles, measured with synthetic media
+type LatencyReport struct {
+	Samples int64         `json:"samples"`
+	P50     time.Duration `json:"p50_ns"`
+	P95     time.Duration `json:"p95_ns"`
+	P99     time.Duration `json:"p99_ns"`
+}
+
+func newRunReport(name, room string, stats map[string]*testerStats) *RunReport {
+	r := &RunReport{
+		Name: name,
+		Room: room,
+	}
+
+	names := make([]string, 0, len(stats))
+	var publishers []string
+	for name := range stats {
+		if strings.HasPrefix(name, "Pub") {
+			publishers = append(publishers, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.Strings(publishers)
+
+	summaries := make(map[string]*summary)
+	subscriberStats := make([]*testerStats, 0, len(names))
+	profileSummaries := make(map[string]map[string]*summary)
+	for _, name := range names {
+		testerStats := stats[name]
+		s := getTesterSummary(testerStats)
+		summaries[name] = s
+		subscriberStats = append(subscriberStats, testerStats)
+		if profile := testerStats.networkProfile; profile != "" {
+			if profileSummaries[profile] == nil {
+				profileSummaries[profile] = make(map[string]*summary)
+			}
+			profileSummaries[profile][name] = s
+		}
+
+		tr := &TesterReport{
+			Name:           name,
+			NetworkProfile: testerStats.networkProfile,
+			SummaryReport:  *s.toReport(),
+		}
+		for _, ts := range testerStats.trackStats {
+			tr.TrackStats = append(tr.TrackStats, ts.toReport())
+		}
+		sort.Slice(tr.TrackStats, func(i, j int) bool {
+			if c := strings.Compare(tr.TrackStats[i].Kind, tr.TrackStats[j].Kind); c != 0 {
+				return c < 0
+			}
+			return tr.TrackStats[i].Source < tr.TrackStats[j].Source
+		})
+		r.Testers = append(r.Testers, tr)
+	}
+	r.Total = getTestSummary(summaries).toReport()
+
+	connections := make(map[string]*summary, len(stats))
+	for name, s := range summaries {
+		connections[name] = s
+	}
+	for _, name := range publishers {
+		s := getTesterSummary(stats[name])
+		connections[name] = s
+		r.Publishers = append(r.Publishers, &PublisherReport{
+			Name:             name,
+			ConnectionReport: s.toConnectionReport(),
+		})
+	}
+	if total := getTestSummary(connections).toConnectionReport(); total.Joins+total.FailedJoins > 0 {
+		r.Connections = &total
+	}
+	r.Rooms, r.RoomSizes = newRoomReports(stats, summaries)
+	if len(r.Rooms) > 0 {
+		for _, tr := range r.Testers {
+			tr.Room = stats[tr.Name].room
+		}
+	}
+
+	for profile, s := range profileSummaries {
+		r.Profiles = append(r.Profiles, &ProfileReport{
+			Name:          profile,
+			SummaryReport: *getTestSummary(s).toReport(),
+		})
+	}
+	sort.Slice(r.Profiles, func(i, j int) bool {
+		return r.Profiles[i].Name < r.Profiles[j].Name
+	})
+
+	for source, s := range getSourceSummaries(subscriberStats) {
+		r.Sources = append(r.Sources, &SourceReport{
+			Source:     source,
+			Tracks:     s.tracks,
+			Packets:    s.packets,
+			Bytes:      s.bytes,
+			Dropped:    s.dropped,
+			PacketLoss: lossPercentage(s.packets, s.dropped),
+			Bitrate:    bitsPerSecond(s.bytes, s.elapsed),
+			Frames:     s.frames,
+			Keyframes:  s.keyframes,
+			Latency:    s.latency.toReport(),
+		})
+	}
+	sort.Slice(r.Sources, func(i, j int) bool {
+		return r.Sources[i].Source < r.Sources[j].Source
+	})
+
+	r.Data = newDataTopicReports(stats)
+	return r
+}
+
+func newDataTopicReports(stats map[string]*testerStats) []*DataTopicReport {
+	topics := make(map[string]*DataTopicReport)
+	latencies := make(map[string]*latencyStats)
+	// packets are only received by the subscribers of the sender's room, while they are connected
+	subscribers := make(map[string][]time.Duration)
+	for name, testerStats := range stats {
+		if !strings.HasPrefix(name, "Pub") && testerStats.connected > 0 {
+			subscribers[testerStats.room] = append(subscribers[testerStats.room], testerStats.connected)
+		}
+	}
+	for name, testerStats := range stats {
+		isPublisher := strings.HasPrefix(name, "Pub")
+		for topic, ds := range testerStats.dataStats {
+			tr := topics[topic]
+			if tr == nil {
+				tr = &DataTopicReport{Topic: topic}
+				topics[topic] = tr
+				latencies[topic] = &latencyStats{}
+			}
+			if isPublisher {
+				sent := ds.sent.Load()
+				tr.Sent += sent
+				tr.Expected += expectedDataPackets(sent, testerStats.connected, subscribers[testerStats.room])
+				tr.Reliable = ds.reliable
+				continue
+			}
+			tr.Received += ds.received.Load()
+			tr.OutOfOrder += ds.outOfOrder.Load()
+			tr.Bytes += ds.bytes.Load()
+			latencies[topic].merge(&ds.latency)
+		}
+	}
+
+	reports := make([]*DataTopicReport, 0, len(topics))
+	for topic, tr := range topics {
+		if tr.Expected > 0 {
+			tr.Delivery = float64(tr.Received) / float64(tr.Expected) * 100
+		}
+		tr.Latency = latencies[topic].toReport()
+		reports = append(reports, tr)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Topic < reports[j].Topic
+	})
+	return reports
+}
+
+// expectedDataPackets returns how many of the packets sent by a publisher its subscribers should receive,
+// packets are sent at a steady rate and a subscriber only receives them for the part of that time it was connected
+func expectedDataPackets(sent int64, publisherConnected time.Duration, subscribersConnected []time.Duration) int64 {
+	if publisherConnected <= 0 {
+		return 0
+	}
+	var share float64
+	for _, connected := range subscribersConnected {
+		share += math.Min(1, float64(connected)/float64(publisherConnected))
+	}
+	return int64(math.Round(float64(sent) * share))
+}
+
+func (s *summary) toReport() *SummaryReport {
+	r := &SummaryReport{
+		Tracks:     s.tracks,
+		Expected:   s.expected,
+		Packets:    s.packets,
+		Bytes:      s.bytes,
+		Dropped:    s.dropped,
+		PacketLoss: lossPercentage(s.packets, s.dropped),
+		Bitrate:    bitsPerSecond(s.bytes, s.elapsed),
+		Frames:     s.frames,
+		Keyframes:  s.keyframes,
+		Elapsed:    s.elapsed,
+		Errors:     s.errCount,
+		Latency:    s.latency.toReport(),
+
+		ConnectionReport: s.toConnectionReport(),
+	}
+	if s.layerSwitches > 0 {
+		r.LayerSwitches = &LayerSwitchReport{
+			Requested: s.layerSwitches,
+			Completed: s.layerSwitchesCompleted,
+			Verified:  s.layerSwitchesVerified,
+			Latency:   s.layerSwitchLatency.toReport(),
+		}
+	}
+	if s.frameSequence.Frames > 0 {
+		frameSequence := s.frameSequence
+		r.FrameSequence = &frameSequence
+	}
+	if s.audioFrames.Frames > 0 {
+		audioFrames := s.audioFrames
+		r.AudioFrames = &audioFrames
+	}
+	if s.errCount > 0 && s.errString != "-" {
+		r.Error = s.errString
+	}
+	return r
+}
+
+func (s *summary) toConnectionReport() ConnectionReport {
+	return ConnectionReport{
+		Joins:       s.joins,
+		FailedJoins: s.failedJoins,
+		Reconnects:  s.reconnects,
+		JoinRetries: s.joinRetries,
+		JoinLatency: s.joinLatency.toReport(),
+
+		TimeToFirstTrack:    s.firstTrack.toReport(),
+		TimeToFirstKeyframe: s.firstKeyframe.toReport(),
+	}
+}
+
+func (ts *trackStats) toReport() *TrackReport {
+	packets := ts.packets.Load()
+	dropped := ts.dropped.Load()
+	bytes := ts.bytes.Load()
+	elapsed := ts.elapsed()
+	return &TrackReport{
+		TrackID:    ts.trackID,
+		Kind:       string(ts.kind),
+		Source:     ts.source,
+		Codec:      ts.codec,
+		Packets:    packets,
+		Bytes:      bytes,
+		Dropped:    dropped,
+		PacketLoss: lossPercentage(packets, dropped),
+		Bitrate:    bitsPerSecond(bytes, elapsed),
+		Frames:     ts.frames.Load(),
+		Keyframes:  ts.keyframes.Load(),
+		Elapsed:    elapsed,
+		Latency:    ts.latency.toReport(),
+
+		LayerSwitches: ts.layerSwitch.toReport(),
+		FrameSequence: ts.frameSequence.toReport(),
+		AudioFrames:   ts.audioFrames.toReport(),
+	}
+}
+
+func (l *latencyStats) toReport() *LatencyReport {
+	if l.empty() {
+		return nil
+	}
+	p := l.percentiles(50, 95, 99)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return &LatencyReport{
+		Samples: l.count,
+		P50:     p[0],
+		P95:     p[1],
+		P99:     p[2],
+	}
+}
+
+func (r *Report) WriteFile(path string, format ReportFormat) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = r.Write(f, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Report) Write(w io.Writer, format ReportFormat) error {
+	switch format {
+	case ReportFormatJSON:
+		return r.writeJSON(w)
+	case ReportFormatCSV:
+		return r.writeCSV(w)
+	case ReportFormatJUnit:
+		return r.writeJUnit(w)
+	}
+	return fmt.Errorf("unsupported report format %q", format)
+}
+
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(append(append([]string{}, trackCSVHeader...), connectionCSVHeader...))
+	for _, run := range r.Runs {
+		for _, tester := range run.Testers {
+			for _, track := range tester.TrackStats {
+				_ = cw.Write(append([]string{
+					run.Name, tester.Name, track.TrackID, track.Kind, track.Codec, "", "",
+					strconv.FormatInt(track.Packets, 10),
+					strconv.FormatInt(track.Bytes, 10),
+					strconv.FormatInt(track.Dropped, 10),
+					formatFloat(track.PacketLoss),
+					formatFloat(track.Bitrate),
+					strconv.FormatInt(track.Frames, 10),
+					strconv.FormatInt(track.Keyframes, 10),
+					"", "",
+				}, append(latencyCSVColumns(track.Latency), make([]string, len(connectionCSVHeader))...)...))
+			}
+			_ = cw.Write(summaryCSVRow(run.Name, tester.Name, &tester.SummaryReport))
+		}
+		for _, data := range run.Data {
+			kind := "lossy"
+			if data.Reliable {
+				kind = "reliable"
+			}
+			lost := max(data.Expected-data.Received, 0)
+			_ = cw.Write(append([]string{
+				run.Name, "Data", data.Topic, "data", kind, "", "",
+				strconv.FormatInt(data.Received, 10),
+				strconv.FormatInt(data.Bytes, 10),
+				strconv.FormatInt(lost, 10),
+				formatFloat(lossPercentage(data.Received, lost)),
+				"", "", "", "", "",
+			}, append(latencyCSVColumns(data.Latency), make([]string, len(connectionCSVHeader))...)...))
+		}
+		for _, source := range run.Sources {
+			_ = cw.Write(append([]string{
+				run.Name, "Source " + source.Source, "", "", "",
+				strconv.Itoa(source.Tracks), "",
+				strconv.FormatInt(source.Packets, 10),
+				strconv.FormatInt(source.Bytes, 10),
+				strconv.FormatInt(source.Dropped, 10),
+				formatFloat(source.PacketLoss),
+				formatFloat(source.Bitrate),
+				strconv.FormatInt(source.Frames, 10),
+				strconv.FormatInt(source.Keyframes, 10),
+				"", "",
+			}, append(latencyCSVColumns(source.Latency), make([]string, len(connectionCSVHeader))...)...))
+		}
+		for _, publisher := range run.Publishers {
+			_ = cw.Write(append(append([]string{run.Name, publisher.Name}, make([]string, len(trackCSVHeader)-2)...),
+				connectionCSVColumns(&publisher.ConnectionReport)...))
+		}
+		for _, profile := range run.Profiles {
+			_ = cw.Write(summaryCSVRow(run.Name, "Profile "+profile.Name, &profile.SummaryReport))
+		}
+		for _, room := range run.Rooms {
+			_ = cw.Write(summaryCSVRow(run.Name, "Room "+room.Name, &room.SummaryReport))
+		}
+		_ = cw.Write(summaryCSVRow(run.Name, "Total", run.Total))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var trackCSVHeader = []string{
+	"run", "tester", "track", "kind", "codec", "tracks", "expected_tracks",
+	"packets", "bytes", "dropped", "packet_loss_pct", "bitrate_bps", "frames", "keyframes", "errors", "error",
+	"latency_p50_ms", "latency_p95_ms", "latency_p99_ms",
+}
+
+// joins, retries and time to connect columns, left empty in track rows
+var connectionCSVHeader = []string{
+	"joins", "failed_joins", "reconnects", "join_retries",
+	"join_latency_p50_ms", "join_latency_p95_ms", "join_latency_p99_ms",
+	"first_track_p50_ms", "first_track_p95_ms", "first_track_p99_ms",
+	"first_keyframe_p50_ms", "first_keyframe_p95_ms", "first_keyframe_p99_ms",
+}
+
+func summaryCSVRow(run, tester string, s *SummaryReport) []string {
+	row := append([]string{
+		run, tester, "", "", "",
+		strconv.Itoa(s.Tracks),
+		strconv.Itoa(s.Expected),
+		strconv.FormatInt(s.Packets, 10),
+		strconv.FormatInt(s.Bytes, 10),
+		strconv.FormatInt(s.Dropped, 10),
+		formatFloat(s.PacketLoss),
+		formatFloat(s.Bitrate),
+		strconv.FormatInt(s.Frames, 10),
+		strconv.FormatInt(s.Keyframes, 10),
+		strconv.FormatInt(s.Errors, 10),
+		s.Error,
+	}, latencyCSVColumns(s.Latency)...)
+	return append(row, connectionCSVColumns(&s.ConnectionReport)...)
+}
+
+func connectionCSVColumns(c *ConnectionReport) []string {
+	row := []string{
+		strconv.FormatInt(c.Joins, 10),
+		strconv.FormatInt(c.FailedJoins, 10),
+		strconv.FormatInt(c.Reconnects, 10),
+		strconv.FormatInt(c.JoinRetries, 10),
+	}
+	row = append(row, latencyCSVColumns(c.JoinLatency)...)
+	row = append(row, latencyCSVColumns(c.TimeToFirstTrack)...)
+	return append(row, latencyCSVColumns(c.TimeToFirstKeyframe)...)
+}
+
+func latencyCSVColumns(l *LatencyReport) []string {
+	if l == nil {
+		return []string{"", "", ""}
+	}
+	return []string{
+		formatMilliseconds(l.P50),
+		formatMilliseconds(l.P95),
+		formatMilliseconds(l.P99),
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties []*junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []*junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+func (r *Report) writeJUnit(w io.Writer) error {
+	suites := &junitTestSuites{}
+	for _, run := range r.Runs {
+		suite := &junitTestSuite{
+			Name:      run.Name,
+			Time:      formatSeconds(run.Total.Elapsed),
+			Timestamp: r.StartedAt.Format(time.RFC3339),
+			Properties: []*junitProperty{
+				{Name: "room", Value: run.Room},
+				{Name: "tracks", Value: fmt.Sprintf("%d/%d", run.Total.Tracks, run.Total.Expected)},
+				{Name: "packets", Value: strconv.FormatInt(run.Total.Packets, 10)},
+				{Name: "dropped", Value: strconv.FormatInt(run.Total.Dropped, 10)},
+				{Name: "packet_loss_pct", Value: formatFloat(run.Total.PacketLoss)},
+				{Name: "bitrate_bps", Value: formatFloat(run.Total.Bitrate)},
+				{Name: "frames", Value: strconv.FormatInt(run.Total.Frames, 10)},
+				{Name: "keyframes", Value: strconv.FormatInt(run.Total.Keyframes, 10)},
+				{Name: "joins", Value: strconv.FormatInt(run.Total.Joins, 10)},
+				{Name: "failed_joins", Value: strconv.FormatInt(run.Total.FailedJoins, 10)},
+				{Name: "reconnects", Value: strconv.FormatInt(run.Total.Reconnects, 10)},
+				{Name: "join_retries", Value: strconv.FormatInt(run.Total.JoinRetries, 10)},
+			},
+		}
+		if r.Seed != 0 {
+			suite.Properties = append(suite.Properties,
+				&junitProperty{Name: "seed", Value: strconv.FormatInt(r.Seed, 10)},
+			)
+		}
+		if len(run.Rooms) > 0 {
+			suite.Properties = append(suite.Properties,
+				&junitProperty{Name: "rooms", Value: strconv.Itoa(len(run.Rooms))},
+			)
+		}
+		if ls := run.Total.LayerSwitches; ls != nil {
+			suite.Properties = append(suite.Properties,
+				&junitProperty{Name: "layer_switches", Value: strconv.FormatInt(ls.Requested, 10)},
+				&junitProperty{Name: "layer_switches_verified", Value: strconv.FormatInt(ls.Verified, 10)},
+			)
+		}
+		if fs := run.Total.FrameSequence; fs != nil {
+			suite.Properties = append(suite.Properties,
+				&junitProperty{Name: "skipped_frames", Value: strconv.FormatInt(fs.Skipped, 10)},
+				&junitProperty{Name: "freezes", Value: strconv.FormatInt(fs.Freezes, 10)},
+				&junitProperty{Name: "freeze_duration", Value: formatSeconds(fs.FreezeDuration)},
+			)
+		}
+		if af := run.Total.AudioFrames; af != nil {
+			suite.Properties = append(suite.Properties,
+				&junitProperty{Name: "lost_audio_frames", Value: strconv.FormatInt(af.Lost, 10)},
+				&junitProperty{Name: "recovered_audio_frames", Value: strconv.FormatInt(af.Recovered, 10)},
+			)
+		}
+		for _, tester := range run.Testers {
+			tc := &junitTestCase{
+				ClassName: "loadtest." + run.Name,
+				Name:      tester.Name,
+				Time:      formatSeconds(tester.Elapsed),
+				SystemOut: fmt.Sprintf("tracks: %d/%d, packets: %d, dropped: %d (%s%%), bitrate: %s",
+					tester.Tracks, tester.Expected, tester.Packets, tester.Dropped,
+					formatPercentage(tester.Dropped, tester.Packets+tester.Dropped),
+					formatBitrate(tester.Bytes, tester.Elapsed)),
+			}
+			if tester.Latency != nil {
+				tc.SystemOut += ", latency p50/p95/p99: " + formatLatency(tester.Latency)
+			}
+			if tester.Error != "" {
+				tc.Error = &junitMessage{Message: tester.Error, Type: "ConnectionError"}
+				suite.Errors++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		for _, res := range run.Thresholds {
+			tc := &junitTestCase{
+				ClassName: "loadtest." + run.Name + ".thresholds",
+				Name:      res.Threshold,
+				Time:      "0",
+				SystemOut: fmt.Sprintf("limit: %s, actual: %s", formatFloat(res.Limit), formatFloat(res.Actual)),
+			}
+			if !res.Passed {
+				tc.Failure = &junitMessage{
+					Message: fmt.Sprintf("%s was %s, limit %s", res.Threshold, formatFloat(res.Actual), formatFloat(res.Limit)),
+					Type:    "ThresholdViolation",
+				}
+				suite.Failures++
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		suite.Tests = len(suite.TestCases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
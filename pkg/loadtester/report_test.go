@@ -0,0 +1,159 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func newTestStats() map[string]*testerStats {
+	audio := &trackStats{trackID: "TR_audio", kind: lksdk.TrackKindAudio}
+	audio.consumed.begin(time.Now().Add(-10 * time.Second))
+	audio.packets.Store(490)
+	audio.dropped.Store(10)
+	audio.bytes.Store(40000)
+
+	video := &trackStats{trackID: "TR_video", kind: lksdk.TrackKindVideo}
+	video.consumed.begin(time.Now().Add(-10 * time.Second))
+	video.packets.Store(1000)
+	video.bytes.Store(1000000)
+
+	return map[string]*testerStats{
+		"Pub 0": {trackStats: map[string]*trackStats{}, connected: 10 * time.Second},
+		"Sub 0": {
+			expectedTracks: 2,
+			connected:      10 * time.Second,
+			trackStats: map[string]*trackStats{
+				audio.trackID: audio,
+				video.trackID: video,
+			},
+		},
+		"Sub 1": {
+			expectedTracks: 2,
+			trackStats:     map[string]*trackStats{},
+			err:            errors.New("could not connect"),
+		},
+	}
+}
+
+func TestNewRunReport(t *testing.T) {
+	r := newRunReport("load-test", "room", newTestStats())
+
+	require.Len(t, r.Testers, 2, "publishers should be excluded")
+	require.Equal(t, "Sub 0", r.Testers[0].Name)
+	require.Len(t, r.Testers[0].TrackStats, 2)
+	require.Equal(t, "audio", r.Testers[0].TrackStats[0].Kind)
+	require.InDelta(t, 2.0, r.Testers[0].TrackStats[0].PacketLoss, 0.001)
+	require.Equal(t, "could not connect", r.Testers[1].Error)
+
+	require.Equal(t, 2, r.Total.Tracks)
+	require.Equal(t, 4, r.Total.Expected)
+	require.EqualValues(t, 1490, r.Total.Packets)
+	require.EqualValues(t, 10, r.Total.Dropped)
+	require.EqualValues(t, 1, r.Total.Errors)
+}
+
+func TestConnectionTimings(t *testing.T) {
+	stats := newTestStats()
+	for i, name := range []string{"Sub 0", "Sub 1"} {
+		s := stats[name]
+		s.joins = 1
+		s.joinRetries = int64(i)
+		s.joinLatency = &latencyStats{}
+		s.joinLatency.add(time.Duration(i+1) * 100 * time.Millisecond)
+		s.firstTrack = &latencyStats{}
+		s.firstTrack.add(time.Duration(i+1) * 200 * time.Millisecond)
+	}
+	stats["Sub 0"].firstKeyframe = &latencyStats{}
+	stats["Sub 0"].firstKeyframe.add(500 * time.Millisecond)
+	stats["Pub 0"].joins = 1
+	stats["Pub 0"].joinRetries = 2
+	stats["Pub 0"].joinLatency = &latencyStats{}
+	stats["Pub 0"].joinLatency.add(300 * time.Millisecond)
+
+	r := newRunReport("load-test", "room", stats)
+	require.EqualValues(t, 1, r.Total.JoinRetries)
+	require.EqualValues(t, 2, r.Total.TimeToFirstTrack.Samples)
+	require.Equal(t, 200*time.Millisecond, r.Total.TimeToFirstTrack.P50)
+	require.EqualValues(t, 1, r.Total.TimeToFirstKeyframe.Samples)
+	require.Equal(t, 400*time.Millisecond, r.Testers[1].TimeToFirstTrack.P50)
+	require.Nil(t, r.Testers[1].TimeToFirstKeyframe)
+
+	// publishers are only counted in connections
+	require.Len(t, r.Publishers, 1)
+	require.Equal(t, "Pub 0", r.Publishers[0].Name)
+	require.EqualValues(t, 2, r.Publishers[0].JoinRetries)
+	require.Nil(t, r.Publishers[0].TimeToFirstTrack)
+	require.EqualValues(t, 3, r.Connections.Joins)
+	require.EqualValues(t, 3, r.Connections.JoinRetries)
+	require.EqualValues(t, 3, r.Connections.JoinLatency.Samples)
+	require.EqualValues(t, 2, r.Connections.TimeToFirstTrack.Samples)
+}
+
+func TestReportFormats(t *testing.T) {
+	report := &Report{
+		StartedAt: time.Now(),
+		Runs:      []*RunReport{newRunReport("load-test", "room", newTestStats())},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, report.Write(buf, ReportFormatJSON))
+		decoded := &Report{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), decoded))
+		require.Len(t, decoded.Runs, 1)
+		require.Equal(t, 2, decoded.Runs[0].Total.Tracks)
+		require.Len(t, decoded.Runs[0].Testers[0].TrackStats, 2)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, report.Write(buf, ReportFormatCSV))
+		records, err := csv.NewReader(buf).ReadAll()
+		require.NoError(t, err)
+		// header, 2 tracks + summary for Sub 0, summary for Sub 1, Pub 0 connections, total
+		require.Len(t, records, 7)
+		require.Equal(t, "Pub 0", records[5][1])
+		require.Equal(t, "Total", records[6][1])
+		for _, record := range records {
+			require.Len(t, record, len(trackCSVHeader)+len(connectionCSVHeader))
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, report.Write(buf, ReportFormatJUnit))
+		decoded := &junitTestSuites{}
+		require.NoError(t, xml.Unmarshal(buf.Bytes(), decoded))
+		require.Len(t, decoded.Suites, 1)
+		require.Equal(t, 2, decoded.Suites[0].Tests)
+		require.Equal(t, 1, decoded.Suites[0].Errors)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := ReportFormatFromString("yaml")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,197 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// smallest room, a publisher and a subscriber
+const minRoomSize = 2
+
+// RoomSizes is the distribution of participants per room when testers are spread over several rooms
+type RoomSizes []*RoomSizeRange
+
+// RoomSizeRange is a range of room sizes, picked uniformly, chosen with a relative weight among the ranges
+type RoomSizeRange struct {
+	Min    int
+	Max    int
+	Weight float64
+}
+
+// RoomSizesFromString parses comma separated sizes or ranges of sizes, each with an optional weight,
+// e.g. "4", "2-10" or "2-4:80,8-10:20"
+func RoomSizesFromString(str string) (RoomSizes, error) {
+	if str == "" {
+		return nil, nil
+	}
+	var sizes RoomSizes
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		r := &RoomSizeRange{Weight: 1}
+		if sizeStr, weightStr, ok := strings.Cut(part, ":"); ok {
+			weight, err := strconv.ParseFloat(weightStr, 64)
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid room size weight %q", weightStr)
+			}
+			r.Weight = weight
+			part = sizeStr
+		}
+		minStr, maxStr, ok := strings.Cut(part, "-")
+		if !ok {
+			maxStr = minStr
+		}
+		var err error
+		if r.Min, err = strconv.Atoi(minStr); err != nil {
+			return nil, fmt.Errorf("invalid room size %q", part)
+		}
+		if r.Max, err = strconv.Atoi(maxStr); err != nil {
+			return nil, fmt.Errorf("invalid room size %q", part)
+		}
+		if r.Min < minRoomSize || r.Max < r.Min {
+			return nil, fmt.Errorf("invalid room size %q, rooms need at least %d participants", part, minRoomSize)
+		}
+		sizes = append(sizes, r)
+	}
+	return sizes, nil
+}
+
+func (s RoomSizes) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		part := strconv.Itoa(r.Min)
+		if r.Max != r.Min {
+			part += "-" + strconv.Itoa(r.Max)
+		}
+		if len(s) > 1 {
+			part += ":" + strconv.FormatFloat(r.Weight, 'f', -1, 64)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s RoomSizes) sample() int {
+	var total float64
+	for _, r := range s {
+		total += r.Weight
+	}
+	pick := random.Float64() * total
+	for _, r := range s {
+		if pick -= r.Weight; pick < 0 || r == s[len(s)-1] {
+			return r.Min + random.Intn(r.Max-r.Min+1)
+		}
+	}
+	return minRoomSize
+}
+
+// rooms returns the parameters of each room of the run. Publisher counts apply to every room,
+// leaving at least one subscriber, and the other participants of the room subscribe
+func (p *Params) rooms() []Params {
+	if p.Rooms <= 1 {
+		return []Params{*p}
+	}
+	rooms := make([]Params, 0, p.Rooms)
+	for i := 0; i < p.Rooms; i++ {
+		size := p.RoomSizes.sample()
+		room := *p
+		room.Room = fmt.Sprintf("%s-%d", p.Room, i)
+		room.VideoPublishers = min(p.VideoPublishers, size-1)
+		room.AudioPublishers = min(p.AudioPublishers, size-1)
+		room.DataPublishers = min(p.DataPublishers, size-1)
+		room.Subscribers = size - max(room.VideoPublishers, room.AudioPublishers, room.DataPublishers)
+		// every room has its own publishers
+		room.ExpectedTracks = 0
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// maximum number of rooms listed in the results, the rooms with the highest packet loss are listed
+// when there are more
+const maxListedRooms = 20
+
+// newRoomReports sums up the subscribers of each room, and of rooms of the same size.
+// Nil when all testers are in the same room
+func newRoomReports(stats map[string]*testerStats, summaries map[string]*summary) ([]*RoomReport, []*RoomSizeReport) {
+	participants := make(map[string]int)
+	for _, testerStats := range stats {
+		participants[testerStats.room]++
+	}
+	if len(participants) <= 1 {
+		return nil, nil
+	}
+
+	roomSummaries := make(map[string]map[string]*summary)
+	for name, s := range summaries {
+		room := stats[name].room
+		if roomSummaries[room] == nil {
+			roomSummaries[room] = make(map[string]*summary)
+		}
+		roomSummaries[room][name] = s
+	}
+
+	sizeSummaries := make(map[int]map[string]*summary)
+	sizeRooms := make(map[int]int)
+	rooms := make([]*RoomReport, 0, len(participants))
+	for room, count := range participants {
+		rooms = append(rooms, &RoomReport{
+			Name:          room,
+			Participants:  count,
+			SummaryReport: *getTestSummary(roomSummaries[room]).toReport(),
+		})
+		if sizeSummaries[count] == nil {
+			sizeSummaries[count] = make(map[string]*summary)
+		}
+		for name, s := range roomSummaries[room] {
+			sizeSummaries[count][name] = s
+		}
+		sizeRooms[count]++
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+
+	sizes := make([]*RoomSizeReport, 0, len(sizeRooms))
+	for size, count := range sizeRooms {
+		sizes = append(sizes, &RoomSizeReport{
+			Participants:  size,
+			Rooms:         count,
+			SummaryReport: *getTestSummary(sizeSummaries[size]).toReport(),
+		})
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].Participants < sizes[j].Participants
+	})
+	return rooms, sizes
+}
+
+// worstRooms returns up to n rooms, with the most errors and the highest packet loss first
+func worstRooms(rooms []*RoomReport, n int) []*RoomReport {
+	worst := append([]*RoomReport{}, rooms...)
+	sort.SliceStable(worst, func(i, j int) bool {
+		if worst[i].Errors != worst[j].Errors {
+			return worst[i].Errors > worst[j].Errors
+		}
+		return worst[i].PacketLoss > worst[j].PacketLoss
+	})
+	if len(worst) > n {
+		worst = worst[:n]
+	}
+	return worst
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomSizes(t *testing.T) {
+	sizes, err := RoomSizesFromString("4")
+	require.NoError(t, err)
+	require.Equal(t, RoomSizes{{Min: 4, Max: 4, Weight: 1}}, sizes)
+
+	sizes, err = RoomSizesFromString("2-4:80, 8-10:20")
+	require.NoError(t, err)
+	require.Equal(t, RoomSizes{{Min: 2, Max: 4, Weight: 80}, {Min: 8, Max: 10, Weight: 20}}, sizes)
+	require.Equal(t, "2-4:80,8-10:20", sizes.String())
+	for i := 0; i < 100; i++ {
+		size := sizes.sample()
+		require.True(t, size >= 2 && size <= 4 || size >= 8 && size <= 10, size)
+	}
+
+	for _, invalid := range []string{"1", "5-3", "two", "2-4:0", "2-x"} {
+		_, err = RoomSizesFromString(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParamsRooms(t *testing.T) {
+	p := &Params{VideoPublishers: 3, AudioPublishers: 1, Subscribers: 100, ExpectedTracks: 5}
+	p.Room = "test"
+	require.Len(t, p.rooms(), 1)
+	require.Equal(t, 100, p.rooms()[0].Subscribers)
+
+	p.Rooms = 3
+	p.RoomSizes = RoomSizes{{Min: 2, Max: 2, Weight: 1}, {Min: 6, Max: 6, Weight: 1}}
+	for i, room := range p.rooms() {
+		require.Equal(t, "test-"+strconv.Itoa(i), room.Room)
+		require.Zero(t, room.ExpectedTracks)
+		require.Equal(t, 1, room.AudioPublishers)
+		switch room.VideoPublishers {
+		case 1:
+			// two participants leave room for a single publisher
+			require.Equal(t, 1, room.Subscribers)
+		case 3:
+			require.Equal(t, 3, room.Subscribers)
+		default:
+			t.Fatalf("unexpected video publishers %d", room.VideoPublishers)
+		}
+	}
+}
+
+func TestRoomReports(t *testing.T) {
+	stats := newTestStats()
+	r := newRunReport("load-test", "room", stats)
+	require.Empty(t, r.Rooms, "single room")
+	require.Empty(t, r.Testers[0].Room)
+
+	// Pub 0 and Sub 0 share a room, Sub 1 is alone in another one
+	stats["Pub 0"].room = "room-0"
+	stats["Sub 0"].room = "room-0"
+	stats["Sub 1"].room = "room-1"
+	pub := newDataTopicStats("chat", true)
+	pub.sent.Store(10)
+	stats["Pub 0"].dataStats = map[string]*dataTopicStats{"chat": pub}
+
+	r = newRunReport("load-test", "room", stats)
+	require.Len(t, r.Rooms, 2)
+	require.Equal(t, "room-0", r.Rooms[0].Name)
+	require.Equal(t, 2, r.Rooms[0].Participants)
+	require.Equal(t, 2, r.Rooms[0].Tracks)
+	require.EqualValues(t, 0, r.Rooms[0].Errors)
+	require.Equal(t, "room-1", r.Rooms[1].Name)
+	require.EqualValues(t, 1, r.Rooms[1].Errors)
+	require.Equal(t, "room-0", r.Testers[0].Room)
+
+	require.Len(t, r.RoomSizes, 2)
+	require.Equal(t, 1, r.RoomSizes[0].Participants)
+	require.Equal(t, 1, r.RoomSizes[0].Rooms)
+	require.Equal(t, 2, r.RoomSizes[1].Participants)
+	require.Equal(t, 2, r.RoomSizes[1].Tracks)
+
+	require.Equal(t, []*RoomReport{r.Rooms[1]}, worstRooms(r.Rooms, 1))
+
+	// data packets only reach subscribers of the sender's room
+	require.Len(t, r.Data, 1)
+	require.EqualValues(t, 10, r.Data[0].Expected)
+	stats["Sub 1"].connected = 10 * time.Second
+	r = newRunReport("load-test", "room", stats)
+	require.EqualValues(t, 10, r.Data[0].Expected)
+}
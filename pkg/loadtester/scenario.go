@@ -0,0 +1,259 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/livekit/livekit-cli/v2/pkg/util"
+)
+
+// Scenario is a declarative load test plan, made of phases that run one after another.
+// Scenarios are written in YAML, or JSON since it is a subset of YAML.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// room used by every phase, a random room is used per phase when empty
+	Room       string              `yaml:"room"`
+	Thresholds *ScenarioThresholds `yaml:"thresholds"`
+	Phases     []*ScenarioPhase    `yaml:"phases"`
+}
+
+// ScenarioThresholds are evaluated against each phase, in addition to thresholds given on the command line
+type ScenarioThresholds struct {
+	MaxPacketLoss *float64 `yaml:"max_packet_loss"`
+	MinTrackRatio *float64 `yaml:"min_track_ratio"`
+	MaxErrors     *int64   `yaml:"max_errors"`
+}
+
+type ScenarioPhase struct {
+	Name string `yaml:"name"`
+	// number of testers to start each second
+	RampUp           float64 `yaml:"ramp_up"`
+	VideoPublishers  int     `yaml:"video_publishers"`
+	AudioPublishers  int     `yaml:"audio_publishers"`
+	Subscribers      int     `yaml:"subscribers"`
+	Layout           string  `yaml:"layout"`
+	VideoCodec       string  `yaml:"video_codec"`
+	VideoResolution  string  `yaml:"video_resolution"`
+	Simulcast        *bool   `yaml:"simulcast"`
+	SimulateSpeakers bool    `yaml:"simulate_speakers"`
+	// how long to keep all testers connected once the ramp-up is done
+	Hold time.Duration `yaml:"hold"`
+	// period over which testers disconnect at the end of the phase, all at once when 0
+	RampDown time.Duration `yaml:"ramp_down"`
+}
+
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(data)
+}
+
+func ParseScenario(data []byte) (*Scenario, error) {
+	s := &Scenario{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return errors.New("at least one phase is required")
+	}
+	if th := s.Thresholds; th != nil && th.MinTrackRatio != nil && (*th.MinTrackRatio < 0 || *th.MinTrackRatio > 1) {
+		return errors.New("min_track_ratio must be between 0 and 1")
+	}
+	for i, p := range s.Phases {
+		name := p.phaseName(i)
+		if p.VideoPublishers < 0 || p.AudioPublishers < 0 || p.Subscribers < 0 {
+			return fmt.Errorf("%s: participant counts cannot be negative", name)
+		}
+		if p.VideoPublishers+p.AudioPublishers+p.Subscribers == 0 {
+			return fmt.Errorf("%s: at least one publisher or subscriber is required", name)
+		}
+		if p.RampUp < 0 || p.RampUp > 10 {
+			return fmt.Errorf("%s: ramp_up must be between 0 and 10 testers per second", name)
+		}
+		if p.Hold <= 0 {
+			return fmt.Errorf("%s: hold duration is required", name)
+		}
+		if p.RampDown < 0 {
+			return fmt.Errorf("%s: ramp_down cannot be negative", name)
+		}
+		switch Layout(p.Layout) {
+		case "", LayoutSpeaker, LayoutGrid3x3, LayoutGrid4x4, LayoutGrid5x5:
+		default:
+			return fmt.Errorf("%s: unknown layout %q", name, p.Layout)
+		}
+		switch p.VideoResolution {
+		case "", "high", "medium", "low":
+		default:
+			return fmt.Errorf("%s: unknown video_resolution %q", name, p.VideoResolution)
+		}
+		switch p.VideoCodec {
+		case "", "h264", "vp8", "vp9", "av1":
+		default:
+			return fmt.Errorf("%s: unsupported video_codec %q, expected h264, vp8, vp9 or av1", name, p.VideoCodec)
+		}
+	}
+	return nil
+}
+
+func (p *ScenarioPhase) phaseName(i int) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return fmt.Sprintf("phase-%d", i+1)
+}
+
+func (s *Scenario) thresholds() []Threshold {
+	if s.Thresholds == nil {
+		return nil
+	}
+	var thresholds []Threshold
+	if s.Thresholds.MaxPacketLoss != nil {
+		thresholds = append(thresholds, MaxPacketLoss(*s.Thresholds.MaxPacketLoss))
+	}
+	if s.Thresholds.MinTrackRatio != nil {
+		thresholds = append(thresholds, MinTrackRatio(*s.Thresholds.MinTrackRatio))
+	}
+	if s.Thresholds.MaxErrors != nil {
+		thresholds = append(thresholds, MaxErrors(*s.Thresholds.MaxErrors))
+	}
+	return thresholds
+}
+
+// params returns the parameters of a phase, unset fields are taken from base
+func (p *ScenarioPhase) params(base Params) Params {
+	params := base
+	params.VideoPublishers = p.VideoPublishers
+	params.AudioPublishers = p.AudioPublishers
+	params.Subscribers = p.Subscribers
+	params.Duration = p.Hold
+	params.RampDown = p.RampDown
+	if p.RampUp > 0 {
+		params.NumPerSecond = p.RampUp
+	}
+	if p.Layout != "" {
+		params.Layout = LayoutFromString(p.Layout)
+	}
+	if p.VideoCodec != "" {
+		params.VideoCodec = p.VideoCodec
+	}
+	if p.VideoResolution != "" {
+		params.VideoResolution = p.VideoResolution
+	}
+	if p.Simulcast != nil {
+		params.Simulcast = *p.Simulcast
+	}
+	if p.SimulateSpeakers {
+		params.SimulateSpeakers = true
+	}
+	params.setDefaults()
+	return params
+}
+
+// RunScenario runs each phase of the scenario with a new set of testers
+func (t *LoadTest) RunScenario(ctx context.Context, s *Scenario) error {
+	for i, p := range s.Phases {
+		if err := checkAcceptableUse(t.Params.URL, p.VideoPublishers, p.AudioPublishers, p.Subscribers); err != nil {
+			return err
+		}
+		// fail before the first phase rather than when publishers start
+		params := p.params(t.Params)
+		if err := params.checkVideoCodec(); err != nil {
+			return fmt.Errorf("invalid scenario: %s: %w", p.phaseName(i), err)
+		}
+	}
+
+	stopMetrics, err := t.serveMetrics()
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	thresholds := append(append([]Threshold{}, t.Params.Thresholds...), s.thresholds()...)
+	report := &Report{
+		StartedAt: time.Now(),
+		Seed:      t.Params.Seed,
+	}
+	resultTable := util.CreateTable().
+		Headers("Phase", "Video Pubs", "Audio Pubs", "Subs", "Tracks", "Bitrate", "Pkt. Loss", "Errors", "Thresholds")
+
+	for i, p := range s.Phases {
+		name := p.phaseName(i)
+		params := p.params(t.Params)
+		if s.Room != "" {
+			params.Room = s.Room
+		}
+		params.setDefaultNames()
+		fmt.Printf("\nRunning phase %d/%d: %s\n", i+1, len(s.Phases), name)
+
+		stats, err := t.run(ctx, params)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		runReport := newRunReport(name, params.Room, stats)
+		printRunReport(runReport)
+		runReport.Thresholds = evaluateThresholds(thresholds, runReport.Total)
+		printThresholdResults(runReport.Thresholds)
+		report.Runs = append(report.Runs, runReport)
+
+		total := runReport.Total
+		resultTable.Row(
+			name,
+			strconv.Itoa(params.VideoPublishers),
+			strconv.Itoa(params.AudioPublishers),
+			strconv.Itoa(params.Subscribers),
+			fmt.Sprintf("%d/%d", total.Tracks, total.Expected),
+			formatBitrate(total.Bytes, total.Elapsed),
+			formatLossRate(total.Packets, total.Dropped),
+			strconv.FormatInt(total.Errors, 10),
+			formatThresholdResult(runReport),
+		)
+	}
+
+	scenarioName := s.Name
+	if scenarioName == "" {
+		scenarioName = "Scenario"
+	}
+	fmt.Printf("\n%s results:\n", scenarioName)
+	fmt.Println(resultTable)
+
+	if err := t.writeReport(report); err != nil {
+		return err
+	}
+	return thresholdError(report.Runs)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScenario(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		s, err := ParseScenario([]byte(`
+name: soak
+thresholds:
+  max_packet_loss: 1.5
+  max_errors: 0
+phases:
+  - name: warmup
+    ramp_up: 2
+    video_publishers: 2
+    subscribers: 10
+    layout: 3x3
+    hold: 30s
+  - audio_publishers: 5
+    subscribers: 50
+    video_codec: h264
+    simulcast: false
+    hold: 2m
+    ramp_down: 10s
+`))
+		require.NoError(t, err)
+		require.Equal(t, "soak", s.Name)
+		require.Len(t, s.Phases, 2)
+		require.Len(t, s.thresholds(), 2)
+
+		base := Params{VideoResolution: "high", Simulcast: true, NumPerSecond: 5}
+		warmup := s.Phases[0].params(base)
+		require.Equal(t, 2.0, warmup.NumPerSecond)
+		require.Equal(t, LayoutGrid3x3, warmup.Layout)
+		require.Equal(t, 30*time.Second, warmup.Duration)
+		require.True(t, warmup.Simulcast)
+
+		second := s.Phases[1].params(base)
+		require.Equal(t, "phase-2", s.Phases[1].phaseName(1))
+		require.Equal(t, 5.0, second.NumPerSecond)
+		require.Equal(t, "h264", second.VideoCodec)
+		require.False(t, second.Simulcast)
+		require.Equal(t, 10*time.Second, second.RampDown)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		s, err := ParseScenario([]byte(`{"phases": [{"video_publishers": 1, "subscribers": 1, "hold": "1m"}]}`))
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, s.Phases[0].Hold)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"no phases":     `name: empty`,
+			"unknown field": `phases: [{subscribers: 1, hold: 1m, subscriber: 2}]`,
+			"no hold":       `phases: [{subscribers: 1}]`,
+			"no testers":    `phases: [{hold: 1m}]`,
+			"layout":        `phases: [{subscribers: 1, hold: 1m, layout: 6x6}]`,
+			"ramp up":       `phases: [{subscribers: 1, hold: 1m, ramp_up: 20}]`,
+			"resolution":    `phases: [{subscribers: 1, hold: 1m, video_resolution: 4k}]`,
+			"video codec":   `phases: [{subscribers: 1, hold: 1m, video_codec: h265}]`,
+		} {
+			_, err := ParseScenario([]byte(data))
+			require.Error(t, err, name)
+		}
+	})
+	t.Run("video codec", func(t *testing.T) {
+		// checked against the media and the watermark before the first phase starts, like the command line flags
+		for name, tc := range map[string]struct {
+			params Params
+			data   string
+		}{
+			"vp9 without media": {
+				data: `phases: [{video_publishers: 1, hold: 1m}, {video_publishers: 1, hold: 1m, video_codec: vp9}]`,
+			},
+			"watermark": {
+				params: Params{VideoCodec: "h264", TesterParams: TesterParams{Watermark: true}},
+				data:   `phases: [{video_publishers: 1, hold: 1m, video_codec: vp8}]`,
+			},
+		} {
+			s, err := ParseScenario([]byte(tc.data))
+			require.NoError(t, err, name)
+			err = NewLoadTest(tc.params).RunScenario(context.Background(), s)
+			require.ErrorContains(t, err, "invalid scenario", name)
+		}
+
+		s, err := ParseScenario([]byte(`phases: [{video_publishers: 1, hold: 1m, video_codec: vp8}]`))
+		require.NoError(t, err)
+		params := s.Phases[0].params(Params{})
+		require.NoError(t, params.checkVideoCodec())
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+)
+
+// random drives the random choices made while setting up the load tests, so that a run can be replayed with the same seed
+var random = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano()).(rand.Source64)})
+
+// seed of the run, the sources of components running concurrently derive from it
+var runSeed atomic.Int64
+
+// components with their own random source, the first key of newRandom
+const (
+	randomChurn = iota + 1
+	randomSpeakers
+	randomNetwork
+)
+
+// lockedSource is a rand.Source that can be used from multiple goroutines
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.src.Seed(seed)
+}
+
+// SetSeed seeds the random choices of the load tests and of the media they publish.
+// A random seed is picked when seed is 0, the seed is returned to replay the run
+func SetSeed(seed int64) int64 {
+	for seed == 0 {
+		seed = rand.Int63()
+	}
+	random.Seed(seed)
+	runSeed.Store(seed)
+	provider2.SetSeed(seed)
+	return seed
+}
+
+// newRandom returns a source for a component with its own timing, such as a network link or a churning tester.
+// It derives from the seed and the keys identifying the component, such as the tester's sequence, so that the
+// choices of a component do not depend on when the others start or how often they draw
+func newRandom(keys ...int64) *rand.Rand {
+	h := fnv.New64a()
+	b := binary.BigEndian.AppendUint64(nil, uint64(runSeed.Load()))
+	for _, key := range keys {
+		b = binary.BigEndian.AppendUint64(b, uint64(key))
+	}
+	_, _ = h.Write(b)
+	return rand.New(&lockedSource{src: rand.NewSource(int64(h.Sum64())).(rand.Source64)})
+}
@@ -0,0 +1,59 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeed(t *testing.T) {
+	choices := func(seed int64) (Params, []Params, int64) {
+		require.Equal(t, seed, SetSeed(seed))
+		p := Params{Rooms: 5, RoomSizes: RoomSizes{{Min: 2, Max: 10, Weight: 1}}}
+		p.setDefaultNames()
+		return p, p.rooms(), newRandom(randomChurn, 1).Int63()
+	}
+
+	p1, rooms1, r1 := choices(42)
+	p2, rooms2, r2 := choices(42)
+	require.Equal(t, p1.Room, p2.Room)
+	require.Equal(t, p1.IdentityPrefix, p2.IdentityPrefix)
+	require.Equal(t, rooms1, rooms2)
+	require.Equal(t, r1, r2)
+
+	p3, rooms3, _ := choices(43)
+	require.False(t, p1.IdentityPrefix == p3.IdentityPrefix && equalRoomSizes(rooms1, rooms3))
+
+	// sources of components do not depend on the choices made before them, nor on each other
+	SetSeed(42)
+	churn := newRandom(randomChurn, 1).Int63()
+	random.Int63()
+	require.Equal(t, churn, newRandom(randomChurn, 1).Int63())
+	require.NotEqual(t, churn, newRandom(randomChurn, 2).Int63())
+	require.NotEqual(t, churn, newRandom(randomNetwork, 1).Int63())
+
+	require.NotZero(t, SetSeed(0))
+}
+
+func equalRoomSizes(a, b []Params) bool {
+	for i := range a {
+		if a[i].Subscribers != b[i].Subscribers {
+			return false
+		}
+	}
+	return true
+}
@@ -31,6 +31,7 @@ type SpeakerSimulatorParams struct {
 
 type SpeakerSimulator struct {
 	params SpeakerSimulatorParams
+	random *rand.Rand
 	fuse   *core.Fuse
 }
 
@@ -38,8 +39,14 @@ func NewSpeakerSimulator(params SpeakerSimulatorParams) *SpeakerSimulator {
 	if params.Pause == 0 {
 		params.Pause = 1
 	}
+	// each room has its own simulator, told apart by its first tester
+	var sequence int64
+	if len(params.Testers) > 0 {
+		sequence = int64(params.Testers[0].params.Sequence)
+	}
 	return &SpeakerSimulator{
 		params: params,
+		random: newRandom(randomSpeakers, sequence),
 	}
 }
 
@@ -67,7 +74,7 @@ func (s *SpeakerSimulator) worker() {
 		case <-s.fuse.Watch():
 			return
 		case <-t.C:
-			speaker := s.params.Testers[rand.Intn(len(s.params.Testers))]
+			speaker := s.params.Testers[s.random.Intn(len(s.params.Testers))]
 			speaker.room.Simulate(lksdk.SimulateSpeakerUpdate)
 			t.Reset(time.Duration(s.params.Pause+lksdk.SimulateSpeakerUpdateInterval) * time.Second)
 		}
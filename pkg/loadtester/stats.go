@@ -15,37 +15,227 @@
 package loadtester
 
 import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/atomic"
 
+	"github.com/livekit/protocol/livekit"
 	lksdk "github.com/livekit/server-sdk-go/v2"
 )
 
 type testerStats struct {
 	expectedTracks int
 	trackStats     map[string]*trackStats
+	dataStats      map[string]*dataTopicStats
 	err            error
+	networkProfile string
+	room           string
+
+	joins       int64
+	failedJoins int64
+	reconnects  int64
+	joinRetries int64
+	// time spent connected, across restarts
+	connected time.Duration
+	// time from the first join attempt until connected
+	joinLatency *latencyStats
+	// time from the first join attempt until the first subscribed track, and the first video keyframe
+	firstTrack    *latencyStats
+	firstKeyframe *latencyStats
 }
 
 type trackStats struct {
-	trackID   string
-	kind      lksdk.TrackKind
-	startedAt atomic.Time
+	trackID string
+	kind    lksdk.TrackKind
+	// camera, microphone, screen_share, ..
+	source string
+	codec  string
+	// time spent consuming the track, a subscriber may leave and consume it again
+	consumed  sessionTime
 	packets   atomic.Int64
 	bytes     atomic.Int64
 	dropped   atomic.Int64
+	frames    atomic.Int64
+	keyframes atomic.Int64
+	// publish to receive latency, only measured with synthetic media
+	latency latencyStats
+	// layers received during the layout cycle
+	layerSwitch layerSwitchStats
+	// frame indexes of watermarked video
+	frameSequence frameSequenceStats
+	// lost and recovered Opus packets
+	audioFrames audioFrameStats
+}
+
+// elapsed returns how long the track has been consumed, leaving out the time between sessions
+func (ts *trackStats) elapsed() time.Duration {
+	return ts.consumed.elapsed(time.Now())
+}
+
+// sessionTime adds up the duration of sessions, such as a tester being connected or a track being consumed
+type sessionTime struct {
+	lock sync.Mutex
+	// start of the current session, zero between sessions
+	start time.Time
+	// duration of the sessions that ended
+	total time.Duration
+}
+
+func (s *sessionTime) begin(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.start.IsZero() {
+		s.start = now
+	}
+}
+
+func (s *sessionTime) end(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.start.IsZero() {
+		s.total += now.Sub(s.start)
+		s.start = time.Time{}
+	}
+}
+
+// elapsed returns the duration of all sessions, including the current one until now
+func (s *sessionTime) elapsed(now time.Time) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.start.IsZero() {
+		return s.total
+	}
+	return s.total + now.Sub(s.start)
+}
+
+func trackSourceName(source livekit.TrackSource) string {
+	return strings.ToLower(source.String())
+}
+
+// maximum number of samples kept to compute percentiles, older samples are replaced at random
+const maxLatencySamples = 10000
+
+type latencyStats struct {
+	lock    sync.Mutex
+	count   int64
+	samples []time.Duration
+}
+
+func (l *latencyStats) add(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.addLocked(d)
+}
+
+func (l *latencyStats) addLocked(d time.Duration) {
+	l.count++
+	if len(l.samples) < maxLatencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	// reservoir sampling
+	if i := rand.Int63n(l.count); i < maxLatencySamples {
+		l.samples[i] = d
+	}
+}
+
+// merge adds the latencies of other. Each side keeps a uniform sample of its latencies, the merged samples
+// are drawn from both sides in proportion of their counts, so that a sample stands for as many latencies on either side
+func (l *latencyStats) merge(other *latencyStats) {
+	count, samples := other.snapshot()
+	if count == 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	total := l.count + count
+	size := min(len(l.samples)+len(samples), maxLatencySamples)
+	kept := min(int((int64(size)*l.count+total/2)/total), len(l.samples))
+	added := min(size-kept, len(samples))
+	kept = min(size-added, len(l.samples))
+
+	l.samples = append(pickLatencies(l.samples, kept), pickLatencies(samples, added)...)
+	l.count = total
+}
+
+// pickLatencies returns n samples picked at random, reordering samples
+func pickLatencies(samples []time.Duration, n int) []time.Duration {
+	if n == len(samples) {
+		return samples
+	}
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(samples)-i)
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+	return samples[:n]
+}
+
+// snapshot returns the number of recorded latencies and a copy of the retained samples
+func (l *latencyStats) snapshot() (int64, []time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.count, append([]time.Duration{}, l.samples...)
+}
+
+func (l *latencyStats) empty() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.count == 0
+}
+
+// percentiles returns the requested percentiles (0-100) of the recorded samples
+func (l *latencyStats) percentiles(ps ...float64) []time.Duration {
+	l.lock.Lock()
+	sorted := append([]time.Duration{}, l.samples...)
+	l.lock.Unlock()
+
+	results := make([]time.Duration, len(ps))
+	if len(sorted) == 0 {
+		return results
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, p := range ps {
+		idx := int(p / 100 * float64(len(sorted)-1))
+		results[i] = sorted[idx]
+	}
+	return results
 }
 
 type summary struct {
+	latency   latencyStats
 	tracks    int
 	expected  int
 	packets   int64
 	bytes     int64
 	dropped   int64
+	frames    int64
+	keyframes int64
 	elapsed   time.Duration
 	errString string
 	errCount  int64
+
+	joins       int64
+	failedJoins int64
+	reconnects  int64
+	joinRetries int64
+	joinLatency latencyStats
+
+	firstTrack    latencyStats
+	firstKeyframe latencyStats
+
+	// layer switches requested by the layout cycle, completed and verified
+	layerSwitches          int64
+	layerSwitchesCompleted int64
+	layerSwitchesVerified  int64
+	layerSwitchLatency     latencyStats
+
+	frameSequence FrameSequenceReport
+	audioFrames   AudioFrameReport
 }
 
 func getTestSummary(summaries map[string]*summary) *summary {
@@ -56,27 +246,49 @@ func getTestSummary(summaries map[string]*summary) *summary {
 		s.packets += testerSummary.packets
 		s.bytes += testerSummary.bytes
 		s.dropped += testerSummary.dropped
+		s.frames += testerSummary.frames
+		s.keyframes += testerSummary.keyframes
 		if testerSummary.elapsed > s.elapsed {
 			s.elapsed = testerSummary.elapsed
 		}
 		s.errCount += testerSummary.errCount
+		s.joins += testerSummary.joins
+		s.failedJoins += testerSummary.failedJoins
+		s.reconnects += testerSummary.reconnects
+		s.joinRetries += testerSummary.joinRetries
+		s.latency.merge(&testerSummary.latency)
+		s.joinLatency.merge(&testerSummary.joinLatency)
+		s.firstTrack.merge(&testerSummary.firstTrack)
+		s.firstKeyframe.merge(&testerSummary.firstKeyframe)
+		s.layerSwitches += testerSummary.layerSwitches
+		s.layerSwitchesCompleted += testerSummary.layerSwitchesCompleted
+		s.layerSwitchesVerified += testerSummary.layerSwitchesVerified
+		s.layerSwitchLatency.merge(&testerSummary.layerSwitchLatency)
+		s.frameSequence.add(&testerSummary.frameSequence)
+		s.audioFrames.add(&testerSummary.audioFrames)
 	}
 	return s
 }
 
 func getTesterSummary(testerStats *testerStats) *summary {
 	s := &summary{
-		expected: testerStats.expectedTracks,
+		expected:    testerStats.expectedTracks,
+		joins:       testerStats.joins,
+		failedJoins: testerStats.failedJoins,
+		reconnects:  testerStats.reconnects,
+		joinRetries: testerStats.joinRetries,
+	}
+	if testerStats.joinLatency != nil {
+		s.joinLatency.merge(testerStats.joinLatency)
+	}
+	if testerStats.firstTrack != nil {
+		s.firstTrack.merge(testerStats.firstTrack)
+	}
+	if testerStats.firstKeyframe != nil {
+		s.firstKeyframe.merge(testerStats.firstKeyframe)
 	}
 	for _, trackStats := range testerStats.trackStats {
-		s.tracks++
-		s.packets += trackStats.packets.Load()
-		s.bytes += trackStats.bytes.Load()
-		s.dropped += trackStats.dropped.Load()
-		elapsed := time.Since(trackStats.startedAt.Load())
-		if elapsed > s.elapsed {
-			s.elapsed = elapsed
-		}
+		s.addTrack(trackStats)
 	}
 	if testerStats.err == nil {
 		s.errString = "-"
@@ -86,3 +298,48 @@ func getTesterSummary(testerStats *testerStats) *summary {
 	}
 	return s
 }
+
+// getSourceSummaries sums up the tracks of all testers by track source, tracks of unknown source are left out
+func getSourceSummaries(stats []*testerStats) map[string]*summary {
+	summaries := make(map[string]*summary)
+	for _, testerStats := range stats {
+		for _, trackStats := range testerStats.trackStats {
+			source := trackStats.source
+			if source == "" {
+				continue
+			}
+			s := summaries[source]
+			if s == nil {
+				s = &summary{}
+				summaries[source] = s
+			}
+			s.addTrack(trackStats)
+		}
+	}
+	return summaries
+}
+
+func (s *summary) addTrack(trackStats *trackStats) {
+	s.tracks++
+	s.packets += trackStats.packets.Load()
+	s.bytes += trackStats.bytes.Load()
+	s.dropped += trackStats.dropped.Load()
+	s.frames += trackStats.frames.Load()
+	s.keyframes += trackStats.keyframes.Load()
+	s.latency.merge(&trackStats.latency)
+	requested, completed, verified := trackStats.layerSwitch.counts()
+	s.layerSwitches += requested
+	s.layerSwitchesCompleted += completed
+	s.layerSwitchesVerified += verified
+	s.layerSwitchLatency.merge(&trackStats.layerSwitch.latency)
+	if r := trackStats.frameSequence.toReport(); r != nil {
+		s.frameSequence.add(r)
+	}
+	if r := trackStats.audioFrames.toReport(); r != nil {
+		s.audioFrames.add(r)
+	}
+	elapsed := trackStats.elapsed()
+	if elapsed > s.elapsed {
+		s.elapsed = elapsed
+	}
+}
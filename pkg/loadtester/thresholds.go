@@ -0,0 +1,152 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/livekit/livekit-cli/v2/pkg/util"
+)
+
+var ErrThresholdsViolated = errors.New("load test thresholds violated")
+
+// Threshold is a pass/fail criterion evaluated against the summary of a test run
+type Threshold struct {
+	Name  string
+	Limit float64
+	// returns the measured value and whether it is within the limit
+	measure func(s *SummaryReport) (float64, bool)
+}
+
+type ThresholdResult struct {
+	Threshold string  `json:"threshold"`
+	Limit     float64 `json:"limit"`
+	Actual    float64 `json:"actual"`
+	Passed    bool    `json:"passed"`
+}
+
+// MaxPacketLoss fails the test when total packet loss exceeds the given percentage
+func MaxPacketLoss(percent float64) Threshold {
+	return Threshold{
+		Name:  "max-packet-loss",
+		Limit: percent,
+		measure: func(s *SummaryReport) (float64, bool) {
+			return s.PacketLoss, s.PacketLoss <= percent
+		},
+	}
+}
+
+// MinTrackRatio fails the test when the ratio of subscribed to expected tracks is below ratio (0-1)
+func MinTrackRatio(ratio float64) Threshold {
+	return Threshold{
+		Name:  "min-track-ratio",
+		Limit: ratio,
+		measure: func(s *SummaryReport) (float64, bool) {
+			actual := 1.0
+			if s.Expected > 0 {
+				actual = float64(s.Tracks) / float64(s.Expected)
+			}
+			return actual, actual >= ratio
+		},
+	}
+}
+
+// MaxErrors fails the test when more than count testers encountered errors
+func MaxErrors(count int64) Threshold {
+	return Threshold{
+		Name:  "max-errors",
+		Limit: float64(count),
+		measure: func(s *SummaryReport) (float64, bool) {
+			return float64(s.Errors), s.Errors <= count
+		},
+	}
+}
+
+func evaluateThresholds(thresholds []Threshold, s *SummaryReport) []*ThresholdResult {
+	results := make([]*ThresholdResult, 0, len(thresholds))
+	for _, th := range thresholds {
+		actual, passed := th.measure(s)
+		results = append(results, &ThresholdResult{
+			Threshold: th.Name,
+			Limit:     th.Limit,
+			Actual:    actual,
+			Passed:    passed,
+		})
+	}
+	return results
+}
+
+func (r *RunReport) Passed() bool {
+	for _, res := range r.Thresholds {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func formatThresholdResult(r *RunReport) string {
+	if len(r.Thresholds) == 0 {
+		return "-"
+	}
+	if r.Passed() {
+		return "pass"
+	}
+	return "FAIL"
+}
+
+func printThresholdResults(results []*ThresholdResult) {
+	if len(results) == 0 {
+		return
+	}
+	thresholdTable := util.CreateTable().
+		Headers("Threshold", "Limit", "Actual", "Result")
+	for _, res := range results {
+		result := "pass"
+		if !res.Passed {
+			result = "FAIL"
+		}
+		thresholdTable.Row(
+			res.Threshold,
+			strconv.FormatFloat(res.Limit, 'f', -1, 64),
+			strconv.FormatFloat(res.Actual, 'f', 3, 64),
+			result,
+		)
+	}
+	fmt.Println("\nThresholds:")
+	fmt.Println(thresholdTable)
+}
+
+func thresholdError(runs []*RunReport) error {
+	var violations []string
+	for _, run := range runs {
+		for _, res := range run.Thresholds {
+			if !res.Passed {
+				violations = append(violations, fmt.Sprintf("%s: %s was %s, limit %s",
+					run.Name, res.Threshold,
+					strconv.FormatFloat(res.Actual, 'f', 3, 64),
+					strconv.FormatFloat(res.Limit, 'f', -1, 64),
+				))
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrThresholdsViolated, strings.Join(violations, "; "))
+}
@@ -0,0 +1,55 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholds(t *testing.T) {
+	summary := &SummaryReport{
+		Tracks:     9,
+		Expected:   10,
+		Packets:    990,
+		Dropped:    10,
+		PacketLoss: 1,
+		Errors:     1,
+	}
+
+	results := evaluateThresholds([]Threshold{
+		MaxPacketLoss(2),
+		MinTrackRatio(0.95),
+		MaxErrors(1),
+	}, summary)
+	require.Len(t, results, 3)
+	require.True(t, results[0].Passed)
+	require.False(t, results[1].Passed)
+	require.InDelta(t, 0.9, results[1].Actual, 0.0001)
+	require.True(t, results[2].Passed)
+
+	run := &RunReport{Name: "load-test", Total: summary, Thresholds: results}
+	require.False(t, run.Passed())
+
+	err := thresholdError([]*RunReport{run})
+	require.True(t, errors.Is(err, ErrThresholdsViolated))
+	require.Contains(t, err.Error(), "min-track-ratio")
+	require.NotContains(t, err.Error(), "max-packet-loss")
+
+	run.Thresholds = evaluateThresholds([]Threshold{MinTrackRatio(0.9)}, summary)
+	require.NoError(t, thresholdError([]*RunReport{run}))
+}
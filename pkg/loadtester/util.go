@@ -16,7 +16,6 @@ package loadtester
 
 import (
 	"fmt"
-	"math/rand"
 	"strings"
 	"time"
 )
@@ -26,7 +25,7 @@ var letterRunes = []rune("abcdefghijklmnopqrstuvwxyz")
 func randStringRunes(n int) string {
 	b := make([]rune, n)
 	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+		b[i] = letterRunes[random.Intn(len(letterRunes))]
 	}
 	return string(b)
 }
@@ -49,8 +48,25 @@ func formatPercentage(num int64, total int64) string {
 	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", float64(num)/float64(total)*100), "0"), ".")
 }
 
+func lossPercentage(packets, dropped int64) float64 {
+	if packets+dropped == 0 {
+		return 0
+	}
+	return float64(dropped) / float64(packets+dropped) * 100
+}
+
+func bitsPerSecond(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes*8) / elapsed.Seconds()
+}
+
 func formatBitrate(bytes int64, elapsed time.Duration) string {
-	bps := float64(bytes*8) / elapsed.Seconds()
+	return formatBps(bitsPerSecond(bytes, elapsed))
+}
+
+func formatBps(bps float64) string {
 	if bps < 1000 {
 		return fmt.Sprintf("%dbps", int(bps))
 	} else if bps < 1000000 {
@@ -59,3 +75,14 @@ func formatBitrate(bytes int64, elapsed time.Duration) string {
 		return fmt.Sprintf("%.1fmbps", bps/1000000)
 	}
 }
+
+func formatLatency(l *LatencyReport) string {
+	if l == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s/%s/%s",
+		l.P50.Round(time.Millisecond/10),
+		l.P95.Round(time.Millisecond/10),
+		l.P99.Round(time.Millisecond/10),
+	)
+}
@@ -0,0 +1,170 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+)
+
+// a gap between frames is a freeze when it exceeds three times the average frame interval,
+// and the average interval by 150ms, like the freeze detection of WebRTC statistics
+const (
+	freezeIntervalFactor = 3
+	freezeMinDelay       = 150 * time.Millisecond
+)
+
+// findWatermark returns the frame index and layer stamped in an H.264 sample by a watermarked publisher
+func findWatermark(pkts []*rtp.Packet) (uint64, uint8, bool) {
+	for _, pkt := range pkts {
+		payload := pkt.Payload
+		if len(payload) == 0 {
+			continue
+		}
+		switch payload[0] & 0x1f {
+		case h264NaluSEI:
+			if index, layer, ok := provider2.ParseWatermark(payload); ok {
+				return index, layer, true
+			}
+		case h264NaluSTAPA:
+			for i := 1; i+2 < len(payload); {
+				size := int(binary.BigEndian.Uint16(payload[i:]))
+				i += 2
+				if i+size > len(payload) {
+					break
+				}
+				if index, layer, ok := provider2.ParseWatermark(payload[i : i+size]); ok {
+					return index, layer, true
+				}
+				i += size
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// frameSequenceStats follows the frame indexes of a watermarked video track, telling duplicated, skipped and
+// reordered frames apart from lost packets, and measuring how long the picture froze
+type frameSequenceStats struct {
+	lock    sync.Mutex
+	started bool
+	layer   uint8
+	last    uint64
+	lastAt  time.Time
+	// average interval between frames, freezes left out
+	interval time.Duration
+
+	// watermarked frames received
+	frames int64
+	// the previous frame received again
+	duplicated int64
+	skipped    int64
+	reordered  int64
+
+	freezes        int64
+	freezeDuration time.Duration
+	maxFreeze      time.Duration
+}
+
+func (s *frameSequenceStats) onFrame(index uint64, layer uint8, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.frames++
+	if !s.started || layer != s.layer {
+		// each simulcast layer is numbered on its own, a layer switch starts over from the new layer's index
+		if s.started {
+			s.checkFreeze(now)
+		}
+		s.started = true
+		s.layer = layer
+		s.last = index
+		s.lastAt = now
+		return
+	}
+	switch {
+	case index == s.last:
+		s.duplicated++
+		return
+	case index < s.last:
+		s.reordered++
+		return
+	case index > s.last+1:
+		s.skipped += int64(index - s.last - 1)
+	}
+	s.checkFreeze(now)
+	s.last = index
+}
+
+func (s *frameSequenceStats) checkFreeze(now time.Time) {
+	gap := now.Sub(s.lastAt)
+	s.lastAt = now
+	if s.interval > 0 && gap > max(freezeIntervalFactor*s.interval, s.interval+freezeMinDelay) {
+		s.freezes++
+		s.freezeDuration += gap
+		s.maxFreeze = max(s.maxFreeze, gap)
+		return
+	}
+	if s.interval == 0 {
+		s.interval = gap
+	} else {
+		s.interval = (7*s.interval + gap) / 8
+	}
+}
+
+// toReport returns nil when the track was not watermarked
+func (s *frameSequenceStats) toReport() *FrameSequenceReport {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.frames == 0 {
+		return nil
+	}
+	return &FrameSequenceReport{
+		Frames:         s.frames,
+		Duplicated:     s.duplicated,
+		Skipped:        s.skipped,
+		Reordered:      s.reordered,
+		Freezes:        s.freezes,
+		FreezeDuration: s.freezeDuration,
+		MaxFreeze:      s.maxFreeze,
+	}
+}
+
+// restore sets the counts of a report received from a distributed worker
+func (s *frameSequenceStats) restore(r *FrameSequenceReport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.frames = r.Frames
+	s.duplicated = r.Duplicated
+	s.skipped = r.Skipped
+	s.reordered = r.Reordered
+	s.freezes = r.Freezes
+	s.freezeDuration = r.FreezeDuration
+	s.maxFreeze = r.MaxFreeze
+}
+
+func (r *FrameSequenceReport) add(other *FrameSequenceReport) {
+	r.Frames += other.Frames
+	r.Duplicated += other.Duplicated
+	r.Skipped += other.Skipped
+	r.Reordered += other.Reordered
+	r.Freezes += other.Freezes
+	r.FreezeDuration += other.FreezeDuration
+	r.MaxFreeze = max(r.MaxFreeze, other.MaxFreeze)
+}
@@ -0,0 +1,134 @@
+// Copyright 2021-2024 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/stretchr/testify/require"
+
+	provider2 "github.com/livekit/livekit-cli/v2/pkg/provider"
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// nalLooper returns NAL units without start code, like loopers reading H.264 files
+type nalLooper struct {
+	lksdk.BaseSampleProvider
+	samples []media.Sample
+}
+
+func (l *nalLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264}
+}
+
+func (l *nalLooper) ToLayer(quality livekit.VideoQuality) *livekit.VideoLayer {
+	return &livekit.VideoLayer{Quality: quality}
+}
+
+func (l *nalLooper) NextSample(_ context.Context) (media.Sample, error) {
+	sample := l.samples[0]
+	l.samples = append(l.samples[1:], sample)
+	return sample, nil
+}
+
+func TestFindWatermark(t *testing.T) {
+	pattern, err := provider2.NewTestPatternVideoLooper(320, 180, 300, 30)
+	require.NoError(t, err)
+	looper, err := provider2.NewWatermarkVideoLooper(pattern, 2)
+	require.NoError(t, err)
+
+	// index 3 is escaped against start code emulation
+	for i := uint64(0); i < 5; i++ {
+		frame, err := looper.NextSample(context.Background())
+		require.NoError(t, err)
+		require.NotZero(t, frame.Duration)
+
+		pkts := packetize(&codecs.H264Payloader{}, frame.Data)
+		index, layer, ok := findWatermark(pkts)
+		require.True(t, ok)
+		require.Equal(t, i, index)
+		require.Equal(t, uint8(2), layer)
+		// the frame follows the SEI in the same sample
+		require.True(t, isKeyFrame(webrtc.MimeTypeH264, pkts) == (i == 0))
+	}
+
+	sps := media.Sample{Data: []byte{0x67, 0x42, 0x00, 0x1f}}
+	idr := media.Sample{Data: []byte{0x65, 0x88, 0x84, 0x00}, Duration: 33 * time.Millisecond}
+	looper, err = provider2.NewWatermarkVideoLooper(&nalLooper{samples: []media.Sample{sps, idr}}, 0)
+	require.NoError(t, err)
+	sample, err := looper.NextSample(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, sps, sample)
+	_, _, ok := findWatermark(packetize(&codecs.H264Payloader{}, sample.Data))
+	require.False(t, ok)
+
+	sample, err = looper.NextSample(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, idr.Duration, sample.Duration)
+	pkts := packetize(&codecs.H264Payloader{}, sample.Data)
+	index, _, ok := findWatermark(pkts)
+	require.True(t, ok)
+	require.Zero(t, index)
+	require.True(t, isKeyFrame(webrtc.MimeTypeH264, pkts))
+
+	vp8, err := provider2.EmbeddedMedia().CreateVideoLoopers("low", "vp8", false)
+	require.NoError(t, err)
+	_, err = provider2.NewWatermarkVideoLooper(vp8[0], 0)
+	require.Error(t, err)
+}
+
+func TestFrameSequenceStats(t *testing.T) {
+	s := &frameSequenceStats{}
+	require.Nil(t, s.toReport())
+
+	now := time.Now()
+	frame := func(index uint64, layer uint8, after time.Duration) {
+		now = now.Add(after)
+		s.onFrame(index, layer, now)
+	}
+	for i := uint64(0); i < 10; i++ {
+		frame(i, 0, 33*time.Millisecond)
+	}
+	// two frames lost, then one arriving late
+	frame(12, 0, 33*time.Millisecond)
+	frame(11, 0, time.Millisecond)
+	// the same frame twice
+	frame(13, 0, 33*time.Millisecond)
+	frame(13, 0, time.Millisecond)
+	// a half second freeze
+	frame(14, 0, 499*time.Millisecond)
+	// a switch to another layer, numbered on its own
+	frame(400, 1, 33*time.Millisecond)
+	frame(401, 1, 33*time.Millisecond)
+
+	r := s.toReport()
+	require.Equal(t, int64(17), r.Frames)
+	require.Equal(t, int64(2), r.Skipped)
+	require.Equal(t, int64(1), r.Reordered)
+	require.Equal(t, int64(1), r.Duplicated)
+	require.Equal(t, int64(1), r.Freezes)
+	require.Equal(t, 500*time.Millisecond, r.FreezeDuration)
+	require.Equal(t, 500*time.Millisecond, r.MaxFreeze)
+
+	restored := &frameSequenceStats{}
+	restored.restore(r)
+	require.Equal(t, r, restored.toReport())
+}
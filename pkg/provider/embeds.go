@@ -28,18 +28,30 @@ import (
 const (
 	h264Codec = "h264"
 	vp8Codec  = "vp8"
+	vp9Codec  = "vp9"
+	av1Codec  = "av1"
+
+	// screen shares change little from frame to frame, and are sent at a low frame rate
+	screenShareFps = 5
 )
 
 type videoSpec struct {
 	codec  string
 	prefix string
-	height int
-	width  int
-	kbps   int
-	fps    int
+	// path of the video in its media library, named after the other fields when empty
+	file string
+	// generated as a test pattern instead of read from a file
+	generated bool
+	height    int
+	width     int
+	kbps      int
+	fps       int
 }
 
 func (v *videoSpec) Name() string {
+	if v.file != "" {
+		return v.file
+	}
 	ext := "h264"
 	if v.codec == vp8Codec {
 		ext = "ivf"
@@ -99,9 +111,11 @@ var (
 	res embed.FS
 
 	videoSpecs [][]*videoSpec
-	videoIndex atomic.Int64
 	audioNames []string
-	audioIndex atomic.Int64
+	// media played by default, loaded from the embedded resources
+	embeddedMedia *MediaLibrary
+	// offsets the rotation of videos and audio samples, set by SetSeed
+	seedOffset atomic.Int64
 )
 
 func init() {
@@ -126,65 +140,35 @@ func init() {
 		"change-ken",
 		"change-sophie",
 	}
+	embeddedMedia = &MediaLibrary{
+		fs:     res,
+		videos: videoSpecs,
+	}
+	for _, name := range audioNames {
+		embeddedMedia.audio = append(embeddedMedia.audio, fmt.Sprintf("resources/%s.ogg", name))
+	}
 }
 
-func randomVideoSpecsForCodec(videoCodec string) []*videoSpec {
-	filtered := make([][]*videoSpec, 0)
-	for _, specs := range videoSpecs {
-		if videoCodec == "" || specs[0].codec == videoCodec {
-			filtered = append(filtered, specs)
-		}
-	}
-	chosen := int(videoIndex.Inc()) % len(filtered)
-	return filtered[chosen]
+// SetSeed changes the videos and audio samples picked first, the same seed picks the same media in the same order
+func SetSeed(seed int64) {
+	seedOffset.Store(int64(uint64(seed) % math.MaxInt32))
+}
+
+// EmbeddedMedia returns the videos and audio samples built into the binary
+func EmbeddedMedia() *MediaLibrary {
+	return embeddedMedia
 }
 
 func CreateVideoLoopers(resolution string, codecFilter string, simulcast bool) ([]VideoLooper, error) {
-	specs := randomVideoSpecsForCodec(codecFilter)
-	numToKeep := 0
-	switch resolution {
-	case "medium":
-		numToKeep = 2
-	case "low":
-		numToKeep = 1
-	default:
-		numToKeep = 3
-	}
-	specs = specs[:numToKeep]
-	if !simulcast {
-		specs = specs[numToKeep-1:]
-	}
-	loopers := make([]VideoLooper, 0)
-	for _, spec := range specs {
-		f, err := res.Open(spec.Name())
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		if spec.codec == h264Codec {
-			looper, err := NewH264VideoLooper(f, spec)
-			if err != nil {
-				return nil, err
-			}
-			loopers = append(loopers, looper)
-		} else if spec.codec == vp8Codec {
-			looper, err := NewVP8VideoLooper(f, spec)
-			if err != nil {
-				return nil, err
-			}
-			loopers = append(loopers, looper)
-		}
-	}
-	return loopers, nil
+	return embeddedMedia.CreateVideoLoopers(resolution, codecFilter, simulcast)
+}
+
+// CreateScreenShareLooper creates a looper of the highest resolution video, played back at a low frame rate
+// to resemble a shared screen. Bitrate is scaled down with the frame rate.
+func CreateScreenShareLooper(codecFilter string) (VideoLooper, error) {
+	return embeddedMedia.CreateScreenShareLooper(codecFilter)
 }
 
 func CreateAudioLooper() (*OpusAudioLooper, error) {
-	chosenName := audioNames[int(audioIndex.Load())%len(audioNames)]
-	audioIndex.Inc()
-	f, err := res.Open(fmt.Sprintf("resources/%s.ogg", chosenName))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	return NewOpusAudioLooper(f)
+	return embeddedMedia.openAudioLooperAt(embeddedMedia.audioIndex.Inc() - 1)
 }
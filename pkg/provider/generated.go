@@ -0,0 +1,538 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// pixels of a macroblock side
+	mbSize = 16
+	// largest frame counter shown by test patterns
+	maxCounterDigits = 6
+	// keyframes are sent every keyframeInterval
+	keyframeInterval = 2 * time.Second
+
+	// constrained baseline profile, profile_idc and constraint_set0 and 1 flags
+	profileIdcBaseline       = 66
+	constrainedBaselineFlags = 0xc0
+
+	// log2 of the range of frame_num in slice headers
+	log2MaxFrameNum = 16
+
+	// H.264 NAL unit types
+	nalSliceNonIdr = 1
+	nalSliceIdr    = 5
+	nalSEI         = 6
+	nalSPS         = 7
+	nalPPS         = 8
+
+	// mb_type of a 16x16 intra macroblock with DC prediction and no residual, in I slices
+	mbTypeI16x16DC = 3
+	// mb_type of a macroblock of raw samples, in I slices. P slices add pSliceIntraMbTypeOffset
+	mbTypeIPCM              = 25
+	pSliceIntraMbTypeOffset = 5
+
+	// samples of flat areas and of the frame counter
+	lumaGray   = 128
+	lumaBlack  = 16
+	lumaWhite  = 235
+	chromaGray = 128
+
+	// largest Opus frame, and TOC byte of a mono 20ms CELT fullband frame
+	maxOpusFrameSize  = 1275
+	opusCeltFB20msTOC = 31 << 3
+)
+
+// SEI user data that pads frames up to their bitrate, ignored by decoders
+var paddingUUID = [16]byte{0x6c, 0x6b, 0x2d, 0x70, 0x61, 0x64, 0x64, 0x69, 0x6e, 0x67, 0x2d, 0x63, 0x6c, 0x69, 0x00, 0x01}
+
+// TestPatternVideoLooper generates H.264 video of any resolution, bitrate and frame rate, without media files.
+// Frames are flat gray with a frame counter in the top left corner, and are padded up to the bitrate
+type TestPatternVideoLooper struct {
+	lksdk.BaseSampleProvider
+	spec          *videoSpec
+	frameDuration time.Duration
+	mbWidth       int
+	mbHeight      int
+	digits        int
+	sps           []byte
+	pps           []byte
+
+	frame            uint64
+	framesSinceIdr   int
+	keyframeInterval int
+	idrCount         int
+	// bytes the next frames may use to reach the bitrate, negative after large frames
+	budget        int
+	bytesPerFrame int
+}
+
+// NewTestPatternVideoLooper creates a test pattern of width x height pixels, rounded up to even sizes
+func NewTestPatternVideoLooper(width, height, kbps, fps int) (*TestPatternVideoLooper, error) {
+	return newTestPatternVideoLooper(&videoSpec{
+		codec:     h264Codec,
+		width:     width,
+		height:    height,
+		kbps:      kbps,
+		fps:       fps,
+		generated: true,
+	})
+}
+
+func newTestPatternVideoLooper(spec *videoSpec) (*TestPatternVideoLooper, error) {
+	if spec.width <= 0 || spec.height <= 0 || spec.kbps <= 0 || spec.fps <= 0 {
+		return nil, errors.New("width, height, kbps and fps are required")
+	}
+	// library specs are shared by loopers
+	s := *spec
+	spec = &s
+	spec.width += spec.width % 2
+	spec.height += spec.height % 2
+	l := &TestPatternVideoLooper{
+		spec:             spec,
+		frameDuration:    time.Second / time.Duration(spec.fps),
+		mbWidth:          (spec.width + mbSize - 1) / mbSize,
+		mbHeight:         (spec.height + mbSize - 1) / mbSize,
+		keyframeInterval: max(int(keyframeInterval.Seconds()*float64(spec.fps)), 1),
+		bytesPerFrame:    spec.kbps * 1000 / 8 / spec.fps,
+	}
+	// the counter starts at the second macroblock of the first row
+	l.digits = min(l.mbWidth-1, maxCounterDigits)
+	l.sps = l.writeSPS()
+	l.pps = writePPS()
+	return l, nil
+}
+
+func (l *TestPatternVideoLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:  "video/h264",
+		ClockRate: 90000,
+		Channels:  0,
+		// profile-level-id matches the SPS, larger pictures need higher levels
+		SDPFmtpLine: fmt.Sprintf("level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=%02x%02x%02x",
+			profileIdcBaseline, constrainedBaselineFlags, l.levelIdc()),
+		RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: webrtc.TypeRTCPFBNACK},
+			{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"},
+		},
+	}
+}
+
+func (l *TestPatternVideoLooper) ToLayer(quality livekit.VideoQuality) *livekit.VideoLayer {
+	return l.spec.ToVideoLayer(quality)
+}
+
+// NextSample returns a frame in Annex B format, with parameter sets before keyframes
+func (l *TestPatternVideoLooper) NextSample(_ context.Context) (media.Sample, error) {
+	var data []byte
+	if l.framesSinceIdr%l.keyframeInterval == 0 {
+		l.framesSinceIdr = 0
+		data = appendNAL(data, 3, nalSPS, l.sps)
+		data = appendNAL(data, 3, nalPPS, l.pps)
+		data = appendNAL(data, 3, nalSliceIdr, l.writeSlice(true))
+		l.idrCount++
+	} else {
+		data = appendNAL(data, 2, nalSliceNonIdr, l.writeSlice(false))
+	}
+	l.frame++
+	l.framesSinceIdr++
+
+	l.budget = min(l.budget+l.bytesPerFrame, 2*l.bytesPerFrame)
+	if pad := l.budget - len(data); pad > 0 {
+		data = appendPadding(data, pad)
+	}
+	l.budget -= len(data)
+
+	return media.Sample{
+		Data:     data,
+		Duration: l.frameDuration,
+	}, nil
+}
+
+// h264Levels are the levels from 3.1, with their largest frame size and macroblock rate
+var h264Levels = []struct {
+	levelIdc uint64
+	maxFS    int
+	maxMBPS  int
+}{
+	{31, 3600, 108000},
+	{32, 5120, 216000},
+	{40, 8192, 245760},
+	{42, 8704, 522240},
+	{50, 22080, 589824},
+	{51, 36864, 983040},
+	{52, 36864, 2073600},
+}
+
+// levelIdc returns the lowest level allowing the frame size and rate, or the highest level
+func (l *TestPatternVideoLooper) levelIdc() uint64 {
+	mbs := l.mbWidth * l.mbHeight
+	for _, level := range h264Levels {
+		if mbs <= level.maxFS && mbs*l.spec.fps <= level.maxMBPS {
+			return level.levelIdc
+		}
+	}
+	return h264Levels[len(h264Levels)-1].levelIdc
+}
+
+func (l *TestPatternVideoLooper) writeSPS() []byte {
+	w := &bitWriter{}
+	w.writeBits(profileIdcBaseline, 8)
+	w.writeBits(constrainedBaselineFlags, 8)
+	w.writeBits(l.levelIdc(), 8)
+	w.writeUE(0) // seq_parameter_set_id
+	w.writeUE(log2MaxFrameNum - 4)
+	w.writeUE(2) // pic_order_cnt_type, every picture is a reference
+	w.writeUE(1) // max_num_ref_frames
+	w.writeBits(0, 1)
+	w.writeUE(uint64(l.mbWidth - 1))
+	w.writeUE(uint64(l.mbHeight - 1))
+	w.writeBits(1, 1) // frame_mbs_only_flag
+	w.writeBits(1, 1) // direct_8x8_inference_flag
+	cropRight := (l.mbWidth*mbSize - l.spec.width) / 2
+	cropBottom := (l.mbHeight*mbSize - l.spec.height) / 2
+	if cropRight > 0 || cropBottom > 0 {
+		w.writeBits(1, 1)
+		w.writeUE(0)
+		w.writeUE(uint64(cropRight))
+		w.writeUE(0)
+		w.writeUE(uint64(cropBottom))
+	} else {
+		w.writeBits(0, 1)
+	}
+	w.writeBits(0, 1) // vui_parameters_present_flag
+	w.writeTrailingBits()
+	return w.bytes()
+}
+
+func writePPS() []byte {
+	w := &bitWriter{}
+	w.writeUE(0)      // pic_parameter_set_id
+	w.writeUE(0)      // seq_parameter_set_id
+	w.writeBits(0, 1) // entropy_coding_mode_flag, CAVLC
+	w.writeBits(0, 1) // bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)      // num_slice_groups_minus1
+	w.writeUE(0)      // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)      // num_ref_idx_l1_default_active_minus1
+	w.writeBits(0, 1) // weighted_pred_flag
+	w.writeBits(0, 2) // weighted_bipred_idc
+	w.writeSE(0)      // pic_init_qp_minus26
+	w.writeSE(0)      // pic_init_qs_minus26
+	w.writeSE(0)      // chroma_qp_index_offset
+	w.writeBits(1, 1) // deblocking_filter_control_present_flag
+	w.writeBits(0, 1) // constrained_intra_pred_flag
+	w.writeBits(0, 1) // redundant_pic_cnt_present_flag
+	w.writeTrailingBits()
+	return w.bytes()
+}
+
+// writeSlice encodes the frame as a single slice. Keyframes code flat macroblocks and the counter,
+// other frames skip every macroblock but the counter digits that changed
+func (l *TestPatternVideoLooper) writeSlice(idr bool) []byte {
+	w := &bitWriter{}
+	w.writeUE(0) // first_mb_in_slice
+	if idr {
+		w.writeUE(7) // I slice
+	} else {
+		w.writeUE(5) // P slice
+	}
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(uint64(l.framesSinceIdr), log2MaxFrameNum)
+	if idr {
+		w.writeUE(uint64(l.idrCount % 2)) // idr_pic_id
+	} else {
+		w.writeBits(0, 1) // num_ref_idx_active_override_flag
+		w.writeBits(0, 1) // ref_pic_list_modification_flag_l0
+	}
+	if idr {
+		w.writeBits(0, 1) // no_output_of_prior_pics_flag
+		w.writeBits(0, 1) // long_term_reference_flag
+	} else {
+		w.writeBits(0, 1) // adaptive_ref_pic_marking_mode_flag
+	}
+	w.writeSE(0) // slice_qp_delta
+	w.writeUE(1) // disable_deblocking_filter_idc, keeps the counter sharp
+
+	digits := counterDigits(l.frame, l.digits)
+	var previous []int
+	if !idr {
+		previous = counterDigits(l.frame-1, l.digits)
+	}
+	isDigit := func(x, y int) bool {
+		return y == 0 && x >= 1 && x <= l.digits
+	}
+
+	skipRun := 0
+	for y := 0; y < l.mbHeight; y++ {
+		for x := 0; x < l.mbWidth; x++ {
+			if idr {
+				if isDigit(x, y) {
+					w.writeUE(mbTypeIPCM)
+					writePCMDigit(w, digits[x-1])
+					continue
+				}
+				w.writeUE(mbTypeI16x16DC)
+				w.writeUE(0) // intra_chroma_pred_mode, DC
+				w.writeSE(0) // mb_qp_delta
+				// no Intra16x16DCLevel coefficient. Raw sample macroblocks count as 16 coefficients
+				var neighbors []int
+				if x > 0 {
+					neighbors = append(neighbors, coeffCount(isDigit(x-1, y)))
+				}
+				if y > 0 {
+					neighbors = append(neighbors, coeffCount(isDigit(x, y-1)))
+				}
+				writeNoCoeffToken(w, predictedCoeffCount(neighbors))
+				continue
+			}
+			if isDigit(x, y) && digits[x-1] != previous[x-1] {
+				w.writeUE(uint64(skipRun))
+				skipRun = 0
+				w.writeUE(pSliceIntraMbTypeOffset + mbTypeIPCM)
+				writePCMDigit(w, digits[x-1])
+				continue
+			}
+			skipRun++
+		}
+	}
+	if skipRun > 0 {
+		w.writeUE(uint64(skipRun))
+	}
+	w.writeTrailingBits()
+	return w.bytes()
+}
+
+func coeffCount(pcm bool) int {
+	if pcm {
+		return 16
+	}
+	return 0
+}
+
+// predictedCoeffCount returns nC, the coefficient count predicted from the available neighbors
+func predictedCoeffCount(neighbors []int) int {
+	switch len(neighbors) {
+	case 1:
+		return neighbors[0]
+	case 2:
+		return (neighbors[0] + neighbors[1] + 1) >> 1
+	}
+	return 0
+}
+
+// writeNoCoeffToken writes the coeff_token of a block without coefficients
+func writeNoCoeffToken(w *bitWriter, nC int) {
+	switch {
+	case nC < 2:
+		w.writeBits(0b1, 1)
+	case nC < 4:
+		w.writeBits(0b11, 2)
+	case nC < 8:
+		w.writeBits(0b1111, 4)
+	default:
+		w.writeBits(0b000011, 6)
+	}
+}
+
+// counterDigits returns the last n decimal digits of frame, most significant first
+func counterDigits(frame uint64, n int) []int {
+	digits := make([]int, n)
+	for i := n - 1; i >= 0; i-- {
+		digits[i] = int(frame % 10)
+		frame /= 10
+	}
+	return digits
+}
+
+// 3x5 pixel glyphs of the counter digits, a row per byte
+var digitGlyphs = [10][5]byte{
+	{0b111, 0b101, 0b101, 0b101, 0b111},
+	{0b010, 0b110, 0b010, 0b010, 0b111},
+	{0b111, 0b001, 0b111, 0b100, 0b111},
+	{0b111, 0b001, 0b111, 0b001, 0b111},
+	{0b101, 0b101, 0b111, 0b001, 0b001},
+	{0b111, 0b100, 0b111, 0b001, 0b111},
+	{0b111, 0b100, 0b111, 0b101, 0b111},
+	{0b111, 0b001, 0b010, 0b010, 0b010},
+	{0b111, 0b101, 0b111, 0b101, 0b111},
+	{0b111, 0b101, 0b111, 0b001, 0b111},
+}
+
+// writePCMDigit writes the raw samples of a macroblock showing a digit, white on black.
+// The edges stay gray, so that the flat macroblocks predicted from them stay gray as well
+func writePCMDigit(w *bitWriter, digit int) {
+	w.alignZero()
+	glyph := digitGlyphs[digit]
+	for y := 0; y < mbSize; y++ {
+		for x := 0; x < mbSize; x++ {
+			sample := byte(lumaGray)
+			if x >= 1 && x <= 14 && y >= 1 && y <= 14 {
+				sample = lumaBlack
+				// glyph scaled by 2, from (5, 2)
+				gx, gy := (x-5)/2, (y-2)/2
+				if x >= 5 && gx < 3 && y >= 2 && gy < 5 && glyph[gy]&(1<<(2-gx)) != 0 {
+					sample = lumaWhite
+				}
+			}
+			w.writeBits(uint64(sample), 8)
+		}
+	}
+	for i := 0; i < 2*(mbSize/2)*(mbSize/2); i++ {
+		w.writeBits(chromaGray, 8)
+	}
+}
+
+// appendNAL appends a NAL unit with a start code, escaping the emulation of start codes in rbsp
+func appendNAL(data []byte, refIdc byte, nalType byte, rbsp []byte) []byte {
+	data = append(data, 0, 0, 0, 1, refIdc<<5|nalType)
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			data = append(data, 3)
+			zeros = 0
+		}
+		data = append(data, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return data
+}
+
+// appendPadding appends about n bytes of user data SEI, which is sent but ignored by decoders
+func appendPadding(data []byte, n int) []byte {
+	// start code, NAL header, payload type and size, trailing bits
+	const overhead = 4 + 1 + 1 + 1 + 1
+	size := n - overhead - (n / 255)
+	if size < len(paddingUUID) {
+		return data
+	}
+	rbsp := []byte{5} // user_data_unregistered
+	for s := size; ; s -= 255 {
+		if s < 255 {
+			rbsp = append(rbsp, byte(s))
+			break
+		}
+		rbsp = append(rbsp, 0xff)
+	}
+	rbsp = append(rbsp, paddingUUID[:]...)
+	for i := len(paddingUUID); i < size; i++ {
+		rbsp = append(rbsp, 0xff)
+	}
+	rbsp = append(rbsp, 0x80)
+	return appendNAL(data, 0, nalSEI, rbsp)
+}
+
+// bitWriter writes the fields of H.264 parameter sets and slices
+type bitWriter struct {
+	buf  []byte
+	cur  byte
+	bits int
+}
+
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | byte(v>>i&1)
+		w.bits++
+		if w.bits == 8 {
+			w.buf = append(w.buf, w.cur)
+			w.cur, w.bits = 0, 0
+		}
+	}
+}
+
+// writeUE writes an unsigned Exp-Golomb code
+func (w *bitWriter) writeUE(v uint64) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(v, n+1)
+}
+
+// writeSE writes a signed Exp-Golomb code
+func (w *bitWriter) writeSE(v int64) {
+	if v > 0 {
+		w.writeUE(uint64(2*v - 1))
+	} else {
+		w.writeUE(uint64(-2 * v))
+	}
+}
+
+func (w *bitWriter) alignZero() {
+	for w.bits != 0 {
+		w.writeBits(0, 1)
+	}
+}
+
+func (w *bitWriter) writeTrailingBits() {
+	w.writeBits(1, 1)
+	w.alignZero()
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// NoiseAudioLooper generates Opus audio at any bitrate, without media files.
+// Frames carry random CELT data, which decodes to noise
+type NoiseAudioLooper struct {
+	lksdk.BaseSampleProvider
+	frameSize int
+	random    *rand.Rand
+}
+
+func NewNoiseAudioLooper(kbps int) (*NoiseAudioLooper, error) {
+	frameSize := kbps * 1000 / 8 / int(time.Second/defaultOpusFrameDuration)
+	if frameSize < 2 || frameSize > maxOpusFrameSize {
+		return nil, errors.New("audio bitrate must be between 1 and 510 kbps")
+	}
+	return &NoiseAudioLooper{
+		frameSize: frameSize,
+		random:    rand.New(rand.NewSource(seedOffset.Load())),
+	}, nil
+}
+
+func (l *NoiseAudioLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType: "audio/opus",
+	}
+}
+
+func (l *NoiseAudioLooper) NextSample(_ context.Context) (media.Sample, error) {
+	data := make([]byte, l.frameSize)
+	data[0] = opusCeltFB20msTOC
+	_, _ = l.random.Read(data[1:])
+	return media.Sample{
+		Data:     data,
+		Duration: defaultOpusFrameDuration,
+	}, nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bitReader reads the fields written by bitWriter, from NAL units without emulation prevention bytes
+type bitReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		require.Less(r.t, r.pos/8, len(r.buf), "read past the end of the NAL unit")
+		v = v<<1 | uint64(r.buf[r.pos/8]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) readUE() uint64 {
+	n := 0
+	for r.readBits(1) == 0 {
+		n++
+	}
+	return 1<<n - 1 + r.readBits(n)
+}
+
+func (r *bitReader) readSE() int64 {
+	v := r.readUE()
+	if v%2 == 1 {
+		return int64(v+1) / 2
+	}
+	return -int64(v / 2)
+}
+
+func (r *bitReader) skipPCM() {
+	r.pos += (8 - r.pos%8) % 8
+	// 16x16 luma and two 8x8 chroma samples
+	r.pos += 8 * 384
+}
+
+func (r *bitReader) requireTrailingBits() {
+	require.Equal(r.t, uint64(1), r.readBits(1))
+	for r.pos%8 != 0 {
+		require.Zero(r.t, r.readBits(1))
+	}
+	require.Equal(r.t, len(r.buf), r.pos/8)
+}
+
+// splitNALs splits an Annex B sample into NAL units, removing emulation prevention bytes
+func splitNALs(t *testing.T, data []byte) [][]byte {
+	require.True(t, bytes.HasPrefix(data, []byte{0, 0, 0, 1}))
+	var nals [][]byte
+	for _, escaped := range bytes.Split(data[4:], []byte{0, 0, 0, 1}) {
+		var nal []byte
+		zeros := 0
+		for _, b := range escaped {
+			if zeros >= 2 && b == 3 {
+				zeros = 0
+				continue
+			}
+			require.False(t, zeros >= 2 && b <= 2, "start code emulation")
+			nal = append(nal, b)
+			if b == 0 {
+				zeros++
+			} else {
+				zeros = 0
+			}
+		}
+		nals = append(nals, nal)
+	}
+	return nals
+}
+
+type parsedSPS struct {
+	profileLevelID string
+	mbWidth        int
+	mbHeight       int
+	width          int
+	height         int
+}
+
+func parseSPS(t *testing.T, nal []byte) parsedSPS {
+	r := &bitReader{t: t, buf: nal[1:]}
+	sps := parsedSPS{profileLevelID: fmt.Sprintf("%02x%02x%02x", r.readBits(8), r.readBits(8), r.readBits(8))}
+	require.Zero(t, r.readUE())                             // seq_parameter_set_id
+	require.Equal(t, uint64(log2MaxFrameNum-4), r.readUE()) // log2_max_frame_num_minus4
+	require.Equal(t, uint64(2), r.readUE())                 // pic_order_cnt_type
+	require.Equal(t, uint64(1), r.readUE())                 // max_num_ref_frames
+	require.Zero(t, r.readBits(1))                          // gaps_in_frame_num_value_allowed_flag
+	sps.mbWidth = int(r.readUE()) + 1
+	sps.mbHeight = int(r.readUE()) + 1
+	require.Equal(t, uint64(1), r.readBits(1)) // frame_mbs_only_flag
+	require.Equal(t, uint64(1), r.readBits(1)) // direct_8x8_inference_flag
+	sps.width, sps.height = sps.mbWidth*mbSize, sps.mbHeight*mbSize
+	if r.readBits(1) == 1 {
+		// 4:2:0 crops by pairs of samples
+		left, right, top, bottom := r.readUE(), r.readUE(), r.readUE(), r.readUE()
+		sps.width -= 2 * int(left+right)
+		sps.height -= 2 * int(top+bottom)
+	}
+	require.Zero(t, r.readBits(1)) // vui_parameters_present_flag
+	r.requireTrailingBits()
+	return sps
+}
+
+func parsePPS(t *testing.T, nal []byte) {
+	r := &bitReader{t: t, buf: nal[1:]}
+	for i := 0; i < 2; i++ {
+		require.Zero(t, r.readUE()) // pic_parameter_set_id, seq_parameter_set_id
+	}
+	require.Zero(t, r.readBits(2)) // CAVLC, no field order
+	for i := 0; i < 3; i++ {
+		require.Zero(t, r.readUE()) // slice groups and reference indexes
+	}
+	require.Zero(t, r.readBits(3)) // no weighted prediction
+	for i := 0; i < 3; i++ {
+		require.Zero(t, r.readSE()) // quantizers
+	}
+	require.Equal(t, uint64(0b100), r.readBits(3))
+	r.requireTrailingBits()
+}
+
+type parsedSlice struct {
+	idr      bool
+	frameNum uint64
+	idrPicID uint64
+	// macroblocks that are not skipped
+	coded int
+}
+
+// parseSlice reads a slice header and its macroblocks, which must cover the picture
+func parseSlice(t *testing.T, nal []byte, sps parsedSPS) parsedSlice {
+	s := parsedSlice{idr: nal[0]&0x1f == nalSliceIdr}
+	r := &bitReader{t: t, buf: nal[1:]}
+	require.Zero(t, r.readUE()) // first_mb_in_slice
+	sliceType := r.readUE()
+	if s.idr {
+		require.Equal(t, uint64(7), sliceType)
+	} else {
+		require.Equal(t, uint64(5), sliceType)
+	}
+	require.Zero(t, r.readUE()) // pic_parameter_set_id
+	s.frameNum = r.readBits(log2MaxFrameNum)
+	if s.idr {
+		s.idrPicID = r.readUE()
+		require.Zero(t, r.readBits(2)) // no_output_of_prior_pics_flag, long_term_reference_flag
+	} else {
+		require.Zero(t, r.readBits(3)) // no overrides or modifications, sliding window
+	}
+	require.Zero(t, r.readSE())             // slice_qp_delta
+	require.Equal(t, uint64(1), r.readUE()) // disable_deblocking_filter_idc
+
+	total := sps.mbWidth * sps.mbHeight
+	pcm := make([]bool, total)
+	for mb := 0; mb < total; {
+		if !s.idr {
+			mb += int(r.readUE()) // mb_skip_run
+			if mb == total {
+				break
+			}
+			require.Less(t, mb, total)
+		}
+		mbType := r.readUE()
+		s.coded++
+		switch {
+		case !s.idr:
+			require.Equal(t, uint64(pSliceIntraMbTypeOffset+mbTypeIPCM), mbType)
+			r.skipPCM()
+		case mbType == mbTypeIPCM:
+			pcm[mb] = true
+			r.skipPCM()
+		default:
+			require.Equal(t, uint64(mbTypeI16x16DC), mbType)
+			require.Zero(t, r.readUE()) // intra_chroma_pred_mode
+			require.Zero(t, r.readSE()) // mb_qp_delta
+			// coeff_token of a DC block without coefficients, its table depends on the neighbors
+			var counts []int
+			if mb%sps.mbWidth > 0 {
+				counts = append(counts, coeffCount(pcm[mb-1]))
+			}
+			if mb >= sps.mbWidth {
+				counts = append(counts, coeffCount(pcm[mb-sps.mbWidth]))
+			}
+			nC := 0
+			if len(counts) == 1 {
+				nC = counts[0]
+			} else if len(counts) == 2 {
+				nC = (counts[0] + counts[1] + 1) / 2
+			}
+			switch {
+			case nC < 2:
+				require.Equal(t, uint64(0b1), r.readBits(1))
+			case nC < 4:
+				require.Equal(t, uint64(0b11), r.readBits(2))
+			case nC < 8:
+				require.Equal(t, uint64(0b1111), r.readBits(4))
+			default:
+				require.Equal(t, uint64(0b000011), r.readBits(6))
+			}
+		}
+		mb++
+	}
+	r.requireTrailingBits()
+	return s
+}
+
+func TestTestPatternVideoLooper(t *testing.T) {
+	for _, tc := range []struct {
+		width, height, kbps, fps int
+		// expected picture size and level
+		decodedWidth, decodedHeight int
+		profileLevelID              string
+	}{
+		{320, 180, 150, 15, 320, 180, "42c01f"},
+		{321, 179, 300, 30, 322, 180, "42c01f"},
+		{1280, 720, 1700, 60, 1280, 720, "42c020"},
+		{1920, 1080, 3000, 30, 1920, 1080, "42c028"},
+		{3840, 2160, 8000, 30, 3840, 2160, "42c033"},
+	} {
+		t.Run(fmt.Sprintf("%dx%d@%d", tc.width, tc.height, tc.fps), func(t *testing.T) {
+			looper, err := NewTestPatternVideoLooper(tc.width, tc.height, tc.kbps, tc.fps)
+			require.NoError(t, err)
+			require.True(t, strings.HasSuffix(looper.Codec().SDPFmtpLine, "profile-level-id="+tc.profileLevelID))
+
+			var sps parsedSPS
+			var total int
+			var lastIdrPicID uint64
+			// two keyframe intervals and a half
+			frames := 5 * tc.fps
+			for i := 0; i < frames; i++ {
+				sample, err := looper.NextSample(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, time.Second/time.Duration(tc.fps), sample.Duration)
+				total += len(sample.Data)
+
+				keyframe := i%(2*tc.fps) == 0
+				var slices []parsedSlice
+				for _, nal := range splitNALs(t, sample.Data) {
+					switch nal[0] & 0x1f {
+					case nalSPS:
+						require.True(t, keyframe)
+						sps = parseSPS(t, nal)
+						require.Equal(t, tc.profileLevelID, sps.profileLevelID)
+						require.Equal(t, tc.decodedWidth, sps.width)
+						require.Equal(t, tc.decodedHeight, sps.height)
+					case nalPPS:
+						require.True(t, keyframe)
+						parsePPS(t, nal)
+					case nalSliceIdr, nalSliceNonIdr:
+						slices = append(slices, parseSlice(t, nal, sps))
+					case nalSEI:
+						// user data unregistered, its size is coded with as many 0xff as needed
+						require.Equal(t, byte(5), nal[1])
+						size := 2
+						for nal[size] == 0xff {
+							size++
+						}
+						require.Equal(t, paddingUUID[:], nal[size+1:size+1+len(paddingUUID)])
+					default:
+						require.Fail(t, "unexpected NAL unit", "type %d", nal[0]&0x1f)
+					}
+				}
+				require.Len(t, slices, 1)
+				slice := slices[0]
+				require.Equal(t, keyframe, slice.idr)
+				require.Equal(t, uint64(i%(2*tc.fps)), slice.frameNum)
+				if keyframe {
+					if i > 0 {
+						require.NotEqual(t, lastIdrPicID, slice.idrPicID)
+					}
+					lastIdrPicID = slice.idrPicID
+				} else {
+					// only the counter digits that changed are coded
+					changed := 0
+					current, previous := counterDigits(uint64(i), looper.digits), counterDigits(uint64(i-1), looper.digits)
+					for d := range current {
+						if current[d] != previous[d] {
+							changed++
+						}
+					}
+					require.Equal(t, changed, slice.coded)
+				}
+			}
+
+			// padding fills the bitrate, within a frame
+			expected := tc.kbps * 1000 / 8 * frames / tc.fps
+			require.InDelta(t, expected, total, float64(2*expected/frames))
+		})
+	}
+}
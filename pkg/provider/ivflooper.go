@@ -0,0 +1,150 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// IsSingleTrackVideo returns true for VP9 and AV1 loopers, which are published as a single track with a single layer.
+// The SDK cannot announce spatial layers to the server, so layers encoded in their files are not used to switch qualities
+func IsSingleTrackVideo(looper VideoLooper) bool {
+	mimeType := looper.Codec().MimeType
+	return strings.EqualFold(mimeType, webrtc.MimeTypeVP9) || strings.EqualFold(mimeType, webrtc.MimeTypeAV1)
+}
+
+// ivfVideoLooper loops the frames of a VP9 or AV1 IVF file
+type ivfVideoLooper struct {
+	lksdk.BaseSampleProvider
+	buffer        []byte
+	frameDuration time.Duration
+	spec          *videoSpec
+	reader        *ivfreader.IVFReader
+}
+
+func newIVFVideoLooper(input io.Reader, spec *videoSpec, fourcc string) (*ivfVideoLooper, error) {
+	l := &ivfVideoLooper{
+		spec:          spec,
+		frameDuration: time.Second / time.Duration(spec.fps),
+	}
+
+	buf := bytes.NewBuffer(nil)
+
+	if _, err := io.Copy(buf, input); err != nil {
+		return nil, err
+	}
+	l.buffer = buf.Bytes()
+
+	_, header, err := ivfreader.NewWith(bytes.NewReader(l.buffer))
+	if err != nil {
+		return nil, err
+	}
+	if header.FourCC != fourcc {
+		return nil, fmt.Errorf("expected %s IVF, found %s", fourcc, header.FourCC)
+	}
+	return l, nil
+}
+
+func (l *ivfVideoLooper) NextSample(_ctx context.Context) (media.Sample, error) {
+	return l.nextSample(true)
+}
+
+func (l *ivfVideoLooper) ToLayer(quality livekit.VideoQuality) *livekit.VideoLayer {
+	return l.spec.ToVideoLayer(quality)
+}
+
+func (l *ivfVideoLooper) nextSample(rewindEOF bool) (media.Sample, error) {
+	sample := media.Sample{}
+	if l.reader == nil {
+		var err error
+		l.reader, _, err = ivfreader.NewWith(bytes.NewReader(l.buffer))
+		if err != nil {
+			return sample, err
+		}
+	}
+
+	frame, _, err := l.reader.ParseNextFrame()
+	if err == io.EOF && rewindEOF {
+		l.reader = nil
+		return l.nextSample(false)
+	}
+	if err != nil {
+		return sample, err
+	}
+	sample.Data = frame
+	sample.Duration = l.frameDuration
+	return sample, nil
+}
+
+// VP9VideoLooper loops a VP9 IVF file
+type VP9VideoLooper struct {
+	*ivfVideoLooper
+}
+
+func NewVP9VideoLooper(input io.Reader, spec *videoSpec) (*VP9VideoLooper, error) {
+	l, err := newIVFVideoLooper(input, spec, "VP90")
+	if err != nil {
+		return nil, err
+	}
+	return &VP9VideoLooper{ivfVideoLooper: l}, nil
+}
+
+func (l *VP9VideoLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:    "video/vp9",
+		ClockRate:   90000,
+		SDPFmtpLine: "profile-id=0",
+		RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: webrtc.TypeRTCPFBNACK},
+			{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"},
+		},
+	}
+}
+
+// AV1VideoLooper loops an AV1 IVF file
+type AV1VideoLooper struct {
+	*ivfVideoLooper
+}
+
+func NewAV1VideoLooper(input io.Reader, spec *videoSpec) (*AV1VideoLooper, error) {
+	l, err := newIVFVideoLooper(input, spec, "AV01")
+	if err != nil {
+		return nil, err
+	}
+	return &AV1VideoLooper{ivfVideoLooper: l}, nil
+}
+
+func (l *AV1VideoLooper) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{
+		MimeType:  "video/av1",
+		ClockRate: 90000,
+		RTCPFeedback: []webrtc.RTCPFeedback{
+			{Type: webrtc.TypeRTCPFBNACK},
+			{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"},
+		},
+	}
+}
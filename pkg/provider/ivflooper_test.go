@@ -0,0 +1,99 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeIVF returns an IVF file holding frames, 32 bytes of file header then a 12 bytes header per frame
+func writeIVF(fourcc string, width, height int, frames [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	header := make([]byte, 32)
+	copy(header, "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], 32)
+	copy(header[8:], fourcc)
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+	binary.LittleEndian.PutUint32(header[16:], 30)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	binary.LittleEndian.PutUint32(header[24:], uint32(len(frames)))
+	buf.Write(header)
+	for i, frame := range frames {
+		frameHeader := make([]byte, 12)
+		binary.LittleEndian.PutUint32(frameHeader, uint32(len(frame)))
+		binary.LittleEndian.PutUint64(frameHeader[4:], uint64(i))
+		buf.Write(frameHeader)
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func TestIVFVideoLoopers(t *testing.T) {
+	frames := [][]byte{{0x82, 0x49, 0x83}, {0x86, 0x00}, {0x86, 0x01, 0x02, 0x03}}
+	manifest := &MediaManifest{Videos: []*MediaManifestVideo{
+		{Codec: vp9Codec, Layers: []*MediaManifestLayer{{File: "video.vp9.ivf", Width: 640, Height: 360, Kbps: 500, Fps: 25}}},
+		{Codec: av1Codec, Layers: []*MediaManifestLayer{{File: "video.av1.ivf", Width: 640, Height: 360, Kbps: 400, Fps: 30}}},
+	}}
+	library, err := manifest.library(fstest.MapFS{
+		"video.vp9.ivf": {Data: writeIVF("VP90", 640, 360, frames)},
+		"video.av1.ivf": {Data: writeIVF("AV01", 640, 360, frames)},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		codec    string
+		mimeType string
+		duration time.Duration
+	}{
+		{vp9Codec, "video/vp9", 40 * time.Millisecond},
+		{av1Codec, "video/av1", time.Second / 30},
+	} {
+		t.Run(tc.codec, func(t *testing.T) {
+			loopers, err := library.CreateVideoLoopers("high", tc.codec, true)
+			require.NoError(t, err)
+			// a single layer, without simulcast
+			require.Len(t, loopers, 1)
+			looper := loopers[0]
+			require.Equal(t, tc.mimeType, looper.Codec().MimeType)
+			require.True(t, IsSingleTrackVideo(looper))
+			require.EqualValues(t, 640, looper.ToLayer(0).Width)
+
+			// frames are returned in order, and again from the first one at the end of the file
+			for i := 0; i < 2*len(frames)+1; i++ {
+				sample, err := looper.NextSample(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, frames[i%len(frames)], sample.Data)
+				require.Equal(t, tc.duration, sample.Duration)
+			}
+		})
+	}
+
+	h264, err := NewTestPatternVideoLooper(320, 180, 300, 30)
+	require.NoError(t, err)
+	require.False(t, IsSingleTrackVideo(h264))
+
+	_, err = NewAV1VideoLooper(bytes.NewReader(writeIVF("VP90", 640, 360, frames)), &videoSpec{fps: 30})
+	require.Error(t, err, "a VP9 file is not an AV1 video")
+	_, err = NewVP9VideoLooper(bytes.NewReader([]byte("DKIF")), &videoSpec{fps: 30})
+	require.Error(t, err, "truncated header")
+}
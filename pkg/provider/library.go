@@ -0,0 +1,316 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/atomic"
+	"gopkg.in/yaml.v3"
+)
+
+// manifest file names looked up in a media library directory
+var manifestNames = []string{"manifest.yaml", "manifest.yml", "manifest.json"}
+
+// maximum number of simulcast layers of a video
+const maxVideoLayers = 3
+
+// MediaLibrary is a set of videos and audio samples that loopers are created from, in rotation
+type MediaLibrary struct {
+	fs fs.FS
+	// layers of each video, from the lowest to the highest resolution
+	videos [][]*videoSpec
+	// paths of the Ogg/Opus audio samples
+	audio []string
+	// bitrate of generated noise, instead of audio samples, when set
+	noiseKbps int
+
+	videoIndex atomic.Int64
+	audioIndex atomic.Int64
+}
+
+// MediaManifest describes the media of a library directory.
+// Manifests are written in YAML, or JSON since it is a subset of YAML
+type MediaManifest struct {
+	Videos []*MediaManifestVideo `yaml:"videos"`
+	// Ogg/Opus files
+	Audio []string `yaml:"audio"`
+	// publish generated noise at this bitrate instead of audio files
+	NoiseAudioKbps int `yaml:"noise_audio_kbps"`
+}
+
+type MediaManifestVideo struct {
+	// h264 (Annex B), vp8, vp9 or av1 (IVF). Layers of h264 videos without a file are generated test patterns
+	Codec string `yaml:"codec"`
+	// up to three simulcast layers, from the lowest to the highest resolution.
+	// vp9 and av1 videos have a single layer, published as a single track
+	Layers []*MediaManifestLayer `yaml:"layers"`
+}
+
+type MediaManifestLayer struct {
+	// path relative to the manifest
+	File   string `yaml:"file"`
+	Width  int    `yaml:"width"`
+	Height int    `yaml:"height"`
+	Kbps   int    `yaml:"kbps"`
+	Fps    int    `yaml:"fps"`
+}
+
+// LoadMediaLibrary reads the manifest of a media library, path is either the manifest or the directory containing
+// a manifest.yaml, manifest.yml or manifest.json. Media missing from the manifest is taken from the embedded media
+func LoadMediaLibrary(path string) (*MediaLibrary, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := path
+	if info.IsDir() {
+		manifestPath = ""
+		for _, name := range manifestNames {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				manifestPath = filepath.Join(path, name)
+				break
+			}
+		}
+		if manifestPath == "" {
+			return nil, fmt.Errorf("no manifest in %s, expected one of %v", path, manifestNames)
+		}
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &MediaManifest{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(manifest); err != nil {
+		return nil, fmt.Errorf("could not parse media manifest %s: %w", manifestPath, err)
+	}
+	l, err := manifest.library(os.DirFS(filepath.Dir(manifestPath)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid media manifest %s: %w", manifestPath, err)
+	}
+	return l, nil
+}
+
+func (m *MediaManifest) library(fsys fs.FS) (*MediaLibrary, error) {
+	if len(m.Videos) == 0 && len(m.Audio) == 0 && m.NoiseAudioKbps == 0 {
+		return nil, errors.New("no videos or audio")
+	}
+	if len(m.Audio) > 0 && m.NoiseAudioKbps > 0 {
+		return nil, errors.New("audio files cannot be used with noise_audio_kbps")
+	}
+	if m.NoiseAudioKbps > 0 {
+		// fail early on unsupported bitrates
+		if _, err := NewNoiseAudioLooper(m.NoiseAudioKbps); err != nil {
+			return nil, err
+		}
+	}
+	l := &MediaLibrary{fs: fsys, noiseKbps: m.NoiseAudioKbps}
+	for i, v := range m.Videos {
+		switch v.Codec {
+		case h264Codec, vp8Codec:
+			if len(v.Layers) == 0 || len(v.Layers) > maxVideoLayers {
+				return nil, fmt.Errorf("video %d: expected 1 to %d layers", i+1, maxVideoLayers)
+			}
+		case vp9Codec, av1Codec:
+			if len(v.Layers) != 1 {
+				return nil, fmt.Errorf("video %d: expected a single layer, %s videos are not published with simulcast", i+1, v.Codec)
+			}
+		default:
+			return nil, fmt.Errorf("video %d: unsupported codec %q, expected %s, %s, %s or %s",
+				i+1, v.Codec, h264Codec, vp8Codec, vp9Codec, av1Codec)
+		}
+		specs := make([]*videoSpec, 0, len(v.Layers))
+		for _, layer := range v.Layers {
+			if layer.Width <= 0 || layer.Height <= 0 || layer.Kbps <= 0 || layer.Fps <= 0 {
+				return nil, fmt.Errorf("video %d: width, height, kbps and fps are required", i+1)
+			}
+			generated := layer.File == ""
+			if generated && v.Codec != h264Codec {
+				return nil, fmt.Errorf("video %d: a file is required, test patterns are only generated in %s", i+1, h264Codec)
+			}
+			if !generated {
+				if err := checkMediaFile(fsys, layer.File); err != nil {
+					return nil, err
+				}
+			}
+			specs = append(specs, &videoSpec{
+				codec:     v.Codec,
+				file:      layer.File,
+				width:     layer.Width,
+				height:    layer.Height,
+				kbps:      layer.Kbps,
+				fps:       layer.Fps,
+				generated: generated,
+			})
+		}
+		l.videos = append(l.videos, specs)
+	}
+	for _, file := range m.Audio {
+		if err := checkMediaFile(fsys, file); err != nil {
+			return nil, err
+		}
+		l.audio = append(l.audio, file)
+	}
+	return l, nil
+}
+
+func checkMediaFile(fsys fs.FS, file string) error {
+	if !fs.ValidPath(file) {
+		return fmt.Errorf("%q must be a path relative to the manifest", file)
+	}
+	if _, err := fs.Stat(fsys, file); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *MediaLibrary) videoSpecsForCodec(videoCodec string, index int64) ([]*videoSpec, error) {
+	filtered := make([][]*videoSpec, 0)
+	for _, specs := range l.videos {
+		if videoCodec == "" || specs[0].codec == videoCodec {
+			filtered = append(filtered, specs)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no %s video in media library", videoCodec)
+	}
+	chosen := int((seedOffset.Load() + index) % int64(len(filtered)))
+	return filtered[chosen], nil
+}
+
+// HasVideoCodec returns true when the library has videos of codec, or any video when codec is empty
+func (l *MediaLibrary) HasVideoCodec(codec string) bool {
+	if len(l.videos) == 0 {
+		return embeddedMedia.HasVideoCodec(codec)
+	}
+	_, err := l.videoSpecsForCodec(codec, 0)
+	return err == nil
+}
+
+func (l *MediaLibrary) CreateVideoLoopers(resolution string, codecFilter string, simulcast bool) ([]VideoLooper, error) {
+	return l.CreateVideoLoopersAt(l.videoIndex.Inc(), resolution, codecFilter, simulcast)
+}
+
+// CreateVideoLoopersAt creates the loopers of the video at index in the rotation, so that concurrent
+// publishers pick the same videos from run to run
+func (l *MediaLibrary) CreateVideoLoopersAt(index int64, resolution string, codecFilter string, simulcast bool) ([]VideoLooper, error) {
+	if len(l.videos) == 0 {
+		return embeddedMedia.CreateVideoLoopersAt(index, resolution, codecFilter, simulcast)
+	}
+	specs, err := l.videoSpecsForCodec(codecFilter, index)
+	if err != nil {
+		return nil, err
+	}
+	numToKeep := 0
+	switch resolution {
+	case "medium":
+		numToKeep = 2
+	case "low":
+		numToKeep = 1
+	default:
+		numToKeep = 3
+	}
+	numToKeep = min(numToKeep, len(specs))
+	specs = specs[:numToKeep]
+	if !simulcast {
+		specs = specs[numToKeep-1:]
+	}
+	loopers := make([]VideoLooper, 0)
+	for _, spec := range specs {
+		looper, err := l.openVideoLooper(spec)
+		if err != nil {
+			return nil, err
+		}
+		loopers = append(loopers, looper)
+	}
+	return loopers, nil
+}
+
+// CreateScreenShareLooper creates a looper of the highest resolution video, played back at a low frame rate
+// to resemble a shared screen. Bitrate is scaled down with the frame rate.
+func (l *MediaLibrary) CreateScreenShareLooper(codecFilter string) (VideoLooper, error) {
+	return l.CreateScreenShareLooperAt(l.videoIndex.Inc(), codecFilter)
+}
+
+// CreateScreenShareLooperAt creates the screen share looper of the video at index in the rotation
+func (l *MediaLibrary) CreateScreenShareLooperAt(index int64, codecFilter string) (VideoLooper, error) {
+	if len(l.videos) == 0 {
+		return embeddedMedia.CreateScreenShareLooperAt(index, codecFilter)
+	}
+	specs, err := l.videoSpecsForCodec(codecFilter, index)
+	if err != nil {
+		return nil, err
+	}
+	spec := specs[len(specs)-1]
+	screenSpec := *spec
+	screenSpec.fps = screenShareFps
+	screenSpec.kbps = max(spec.kbps*screenShareFps/spec.fps, 1)
+	return l.openVideoLooper(&screenSpec)
+}
+
+func (l *MediaLibrary) openVideoLooper(spec *videoSpec) (VideoLooper, error) {
+	if spec.generated {
+		return newTestPatternVideoLooper(spec)
+	}
+	f, err := l.fs.Open(spec.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch spec.codec {
+	case h264Codec:
+		return NewH264VideoLooper(f, spec)
+	case vp8Codec:
+		return NewVP8VideoLooper(f, spec)
+	case vp9Codec:
+		return NewVP9VideoLooper(f, spec)
+	case av1Codec:
+		return NewAV1VideoLooper(f, spec)
+	}
+	return nil, fmt.Errorf("unsupported video codec %q", spec.codec)
+}
+
+func (l *MediaLibrary) CreateAudioLooper() (Looper, error) {
+	return l.CreateAudioLooperAt(l.audioIndex.Inc() - 1)
+}
+
+// CreateAudioLooperAt creates a looper of the audio sample at index in the rotation
+func (l *MediaLibrary) CreateAudioLooperAt(index int64) (Looper, error) {
+	if l.noiseKbps > 0 {
+		return NewNoiseAudioLooper(l.noiseKbps)
+	}
+	if len(l.audio) == 0 {
+		return embeddedMedia.openAudioLooperAt(index)
+	}
+	return l.openAudioLooperAt(index)
+}
+
+func (l *MediaLibrary) openAudioLooperAt(index int64) (*OpusAudioLooper, error) {
+	chosen := l.audio[int((seedOffset.Load()+index)%int64(len(l.audio)))]
+	f, err := l.fs.Open(chosen)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewOpusAudioLooper(f)
+}
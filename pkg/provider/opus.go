@@ -0,0 +1,174 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+const (
+	// like libopus, DTX starts after 200ms of inactive frames, and then sends a frame every 400ms
+	dtxHangover = 200 * time.Millisecond
+	dtxInterval = 400 * time.Millisecond
+)
+
+// silkHeader returns the first byte of the first frame of an Opus packet with a SILK layer, which starts with
+// the voice activity flags of each SILK frame and the in-band FEC (LBRR) flag, for each channel
+func silkHeader(packet []byte) (header byte, silkFrames int, channels int, ok bool) {
+	if len(packet) < 2 {
+		return 0, 0, 0, false
+	}
+	toc := packet[0]
+	config := toc >> 3
+	var duration time.Duration
+	switch {
+	case config < 12:
+		// SILK-only, 10, 20, 40 or 60ms
+		duration = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		// hybrid, 10 or 20ms
+		duration = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		// CELT-only
+		return 0, 0, 0, false
+	}
+	silkFrames = max(int(duration/(20*time.Millisecond)), 1)
+	channels = 1
+	if toc&0x04 != 0 {
+		channels = 2
+	}
+
+	frame := packet[1:]
+	switch toc & 0x03 {
+	case 2:
+		// frames of different sizes, the size of the first one comes first
+		if frame[0] >= 252 {
+			if len(frame) < 2 {
+				return 0, 0, 0, false
+			}
+			frame = frame[2:]
+		} else {
+			frame = frame[1:]
+		}
+	case 3:
+		// arbitrary number of frames, not produced by WebRTC encoders
+		return 0, 0, 0, false
+	}
+	if len(frame) == 0 {
+		return 0, 0, 0, false
+	}
+	return frame[0], silkFrames, channels, true
+}
+
+// OpusPacketHasFEC returns true when an Opus packet carries in-band FEC data (LBRR) of the previous packet
+func OpusPacketHasFEC(packet []byte) bool {
+	header, silkFrames, channels, ok := silkHeader(packet)
+	if !ok {
+		return false
+	}
+	for n := 0; n < channels; n++ {
+		if header&(0x80>>((n+1)*(silkFrames+1)-1)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// OpusPacketIsActive returns false when the encoder found no voice activity in an Opus packet,
+// or the packet carries no audio. CELT-only packets have no voice activity flags and are always active
+func OpusPacketIsActive(packet []byte) bool {
+	if len(packet) <= 1 {
+		return false
+	}
+	header, silkFrames, channels, ok := silkHeader(packet)
+	if !ok {
+		return true
+	}
+	for n := 0; n < channels; n++ {
+		for i := 0; i < silkFrames; i++ {
+			if header&(0x80>>(n*(silkFrames+1)+i)) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DTXAudioLooper emulates the discontinuous transmission of an Opus encoder on pre-encoded audio.
+// After 200ms of packets without voice activity, packets are replaced by a single TOC byte every 400ms,
+// until voice activity resumes
+type DTXAudioLooper struct {
+	Looper
+	// inactive audio sent since the last active packet
+	inactive time.Duration
+	pending  *media.Sample
+}
+
+func NewDTXAudioLooper(looper Looper) (*DTXAudioLooper, error) {
+	if mimeType := looper.Codec().MimeType; !strings.EqualFold(mimeType, webrtc.MimeTypeOpus) {
+		return nil, fmt.Errorf("DTX requires Opus audio, not %s", mimeType)
+	}
+	return &DTXAudioLooper{Looper: looper}, nil
+}
+
+func (l *DTXAudioLooper) NextSample(ctx context.Context) (media.Sample, error) {
+	sample, err := l.next(ctx)
+	if err != nil || len(sample.Data) == 0 {
+		return sample, err
+	}
+	if OpusPacketIsActive(sample.Data) {
+		l.inactive = 0
+		return sample, nil
+	}
+	if l.inactive < dtxHangover {
+		l.inactive += sample.Duration
+		return sample, nil
+	}
+
+	// skip the inactive packets of the interval, the timestamp of the next packet follows their duration
+	duration := sample.Duration
+	for duration < dtxInterval {
+		next, err := l.next(ctx)
+		if err != nil {
+			return media.Sample{}, err
+		}
+		if OpusPacketIsActive(next.Data) {
+			l.pending = &next
+			break
+		}
+		duration += next.Duration
+	}
+	l.inactive += duration
+	return media.Sample{
+		// a single frame without data, decoders conceal it
+		Data:     []byte{sample.Data[0] &^ 0x03},
+		Duration: duration,
+	}, nil
+}
+
+func (l *DTXAudioLooper) next(ctx context.Context) (media.Sample, error) {
+	if l.pending != nil {
+		sample := *l.pending
+		l.pending = nil
+		return sample, nil
+	}
+	return l.Looper.NextSample(ctx)
+}
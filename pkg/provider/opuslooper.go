@@ -90,3 +90,20 @@ func (l *OpusAudioLooper) nextSample(rewindEOF bool) (media.Sample, error) {
 	}
 	return sample, nil
 }
+
+// HasFEC returns true when packets of the audio carry in-band FEC data
+func (l *OpusAudioLooper) HasFEC() bool {
+	reader, _, err := oggreader.NewWith(bytes.NewReader(l.buffer))
+	if err != nil {
+		return false
+	}
+	for {
+		pageData, _, err := reader.ParseNextPage()
+		if err != nil {
+			return false
+		}
+		if OpusPacketHasFEC(pageData) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// NewTrack creates a track writing the samples of looper once it is published
+func NewTrack(looper Looper) (webrtc.TrackLocal, error) {
+	// the SDK has no AV1 payloader, pion packetizes AV1 samples instead
+	if strings.EqualFold(looper.Codec().MimeType, webrtc.MimeTypeAV1) {
+		return NewSampleTrack(looper)
+	}
+	track, err := lksdk.NewLocalTrack(looper.Codec())
+	if err != nil {
+		return nil, err
+	}
+	if err := track.StartWrite(looper, nil); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// SampleTrack writes the samples of a looper to a pion track, for codecs that lksdk.LocalTrack cannot packetize.
+// Samples are written while the track is bound to a peer connection
+type SampleTrack struct {
+	*webrtc.TrackLocalStaticSample
+	looper Looper
+
+	lock     sync.Mutex
+	bindings int
+	done     chan struct{}
+}
+
+func NewSampleTrack(looper Looper) (*SampleTrack, error) {
+	track, err := webrtc.NewTrackLocalStaticSample(looper.Codec(), utils.NewGuid("TR_"), utils.NewGuid("ST_"))
+	if err != nil {
+		return nil, err
+	}
+	return &SampleTrack{
+		TrackLocalStaticSample: track,
+		looper:                 looper,
+	}, nil
+}
+
+func (t *SampleTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := t.TrackLocalStaticSample.Bind(ctx)
+	if err != nil {
+		return codec, err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bindings++
+	if t.bindings == 1 {
+		t.done = make(chan struct{})
+		go t.writeWorker(t.done)
+	}
+	return codec, nil
+}
+
+func (t *SampleTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	err := t.TrackLocalStaticSample.Unbind(ctx)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.bindings > 0 {
+		t.bindings--
+		if t.bindings == 0 {
+			close(t.done)
+		}
+	}
+	return err
+}
+
+func (t *SampleTrack) writeWorker(done chan struct{}) {
+	next := time.Now()
+	for {
+		sample, err := t.looper.NextSample(context.Background())
+		if err != nil {
+			logger.Errorw("could not read sample", err, "trackID", t.ID())
+			return
+		}
+		if err := t.WriteSample(sample); err != nil {
+			logger.Errorw("could not write sample", err, "trackID", t.ID())
+			return
+		}
+		if sample.Duration == 0 {
+			continue
+		}
+		next = next.Add(sample.Duration)
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
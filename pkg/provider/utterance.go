@@ -0,0 +1,118 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// Utterance is an Ogg/Opus recording played once, such as a user's turn in a conversation
+type Utterance struct {
+	Name    string
+	Samples []media.Sample
+}
+
+func NewUtterance(name string, input io.Reader) (*Utterance, error) {
+	l, err := NewOpusAudioLooper(input)
+	if err != nil {
+		return nil, err
+	}
+	u := &Utterance{Name: name}
+	for {
+		sample, err := l.nextSample(false)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", name, err)
+		}
+		if bytes.HasPrefix(sample.Data, []byte("OpusTags")) {
+			continue
+		}
+		u.Samples = append(u.Samples, sample)
+	}
+	if len(u.Samples) == 0 {
+		return nil, fmt.Errorf("%s has no audio", name)
+	}
+	return u, nil
+}
+
+func (u *Utterance) Duration() time.Duration {
+	var d time.Duration
+	for _, s := range u.Samples {
+		d += s.Duration
+	}
+	return d
+}
+
+// BuiltinUtterances returns the embedded voice samples
+func BuiltinUtterances() ([]*Utterance, error) {
+	utterances := make([]*Utterance, 0, len(audioNames))
+	for _, name := range audioNames {
+		data, err := res.ReadFile(fmt.Sprintf("resources/%s.ogg", name))
+		if err != nil {
+			return nil, err
+		}
+		u, err := NewUtterance(name, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		utterances = append(utterances, u)
+	}
+	return utterances, nil
+}
+
+// LoadUtterances reads the .ogg and .opus files of dir, in the order of their names
+func LoadUtterances(dir string) ([]*Utterance, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".ogg" || ext == ".opus") {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no .ogg or .opus files in %s", dir)
+	}
+	sort.Strings(names)
+
+	utterances := make([]*Utterance, 0, len(names))
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		u, err := NewUtterance(name, f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		utterances = append(utterances, u)
+	}
+	return utterances, nil
+}
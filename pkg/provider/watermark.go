@@ -0,0 +1,105 @@
+// Copyright 2022-2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// SEI user data carrying the index of the frame that follows it, see WatermarkVideoLooper
+var watermarkUUID = [16]byte{0x6c, 0x6b, 0x2d, 0x77, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x2d, 0x63, 0x6c, 0x69}
+
+// frame index and layer
+const watermarkSize = 8 + 1
+
+// WatermarkVideoLooper stamps the index of each frame of an H.264 looper in a user data SEI, sent in the same sample
+// before the frame, so that subscribers can detect duplicated, skipped and reordered frames. Decoders ignore it.
+// Simulcast layers are numbered by their own looper, the layer is stamped along with the index to tell them apart
+type WatermarkVideoLooper struct {
+	VideoLooper
+	layer uint8
+	frame uint64
+}
+
+func NewWatermarkVideoLooper(looper VideoLooper, layer uint8) (*WatermarkVideoLooper, error) {
+	if mimeType := looper.Codec().MimeType; !strings.EqualFold(mimeType, webrtc.MimeTypeH264) {
+		return nil, fmt.Errorf("watermarks require H.264 video, not %s", mimeType)
+	}
+	return &WatermarkVideoLooper{
+		VideoLooper: looper,
+		layer:       layer,
+	}, nil
+}
+
+func (l *WatermarkVideoLooper) NextSample(ctx context.Context) (media.Sample, error) {
+	sample, err := l.VideoLooper.NextSample(ctx)
+	// parameter sets are sent without duration, along with the next frame
+	if err != nil || sample.Duration == 0 {
+		return sample, err
+	}
+
+	rbsp := []byte{5, 16 + watermarkSize} // user_data_unregistered
+	rbsp = append(rbsp, watermarkUUID[:]...)
+	rbsp = binary.BigEndian.AppendUint64(rbsp, l.frame)
+	rbsp = append(rbsp, l.layer, 0x80)
+	l.frame++
+
+	// in the same sample, the SEI gets the timestamp of the frame and the marker bit stays on the frame's last packet.
+	// Loopers reading files return NAL units without start code
+	data := appendNAL(nil, 0, nalSEI, rbsp)
+	if !bytes.HasPrefix(sample.Data, []byte{0, 0, 1}) && !bytes.HasPrefix(sample.Data, []byte{0, 0, 0, 1}) {
+		data = append(data, 0, 0, 0, 1)
+	}
+	sample.Data = append(data, sample.Data...)
+	return sample, nil
+}
+
+// ParseWatermark returns the frame index and layer stamped by a WatermarkVideoLooper in a NAL unit,
+// ok is false for other NAL units
+func ParseWatermark(nal []byte) (index uint64, layer uint8, ok bool) {
+	const size = 1 + 2 + 16 + watermarkSize
+	if len(nal) < size || nal[0]&0x1f != nalSEI {
+		return 0, 0, false
+	}
+	// remove the emulation prevention bytes of the watermark
+	rbsp := make([]byte, 0, size)
+	zeros := 0
+	for _, b := range nal[1:] {
+		if len(rbsp) == size-1 {
+			break
+		}
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		rbsp = append(rbsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	if len(rbsp) < size-1 || rbsp[0] != 5 || rbsp[1] != 16+watermarkSize || !bytes.Equal(rbsp[2:18], watermarkUUID[:]) {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(rbsp[18:26]), rbsp[26], true
+}